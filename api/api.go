@@ -5,24 +5,25 @@ import (
 	"crypto/rsa"
 	"encoding/base64"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"strings"
 
-	"cloud.google.com/go/firestore"
 	"github.com/joho/godotenv"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/minsoo-gold/fairplay-ksm/cryptos"
 	"github.com/minsoo-gold/fairplay-ksm/ksm"
 	"github.com/minsoo-gold/fairplay-ksm/logger"
-	"google.golang.org/api/option"
 )
 
 type SpcMessage struct {
 	Spc     string `json:"spc" binding:"required"`
 	AssetID string `json:"assetID"`
+	Offline bool   `json:"offline" form:"offline" query:"offline"` // 다운로드(오프라인) 재생용 영구 키 요청
+	UserID  string `json:"user_id" form:"user_id" query:"user_id"` // 사용자별 기기 수 제한에 사용 (maxDevices 가 있는 고객사는 필수, 생략 시 403)
 }
 
 type ErrorMessage struct {
@@ -34,11 +35,16 @@ type CkcResult struct {
 	Ckc string `json:"ckc" binding:"required"`
 }
 
-// Firestore 고객사 키 구조
+// 저장소의 고객사 키 구조
 type CustomerKeys struct {
-	Certification string `firestore:"FAIRPLAY_CERTIFICATION"`
-	PrivateKey    string `firestore:"FAIRPLAY_PRIVATE_KEY"`
-	AppServiceKey string `firestore:"FAIRPLAY_APPLICATION_SERVICE_KEY"`
+	Certification string `firestore:"FAIRPLAY_CERTIFICATION" json:"FAIRPLAY_CERTIFICATION"`
+	PrivateKey    string `firestore:"FAIRPLAY_PRIVATE_KEY" json:"FAIRPLAY_PRIVATE_KEY"`
+	AppServiceKey string `firestore:"FAIRPLAY_APPLICATION_SERVICE_KEY" json:"FAIRPLAY_APPLICATION_SERVICE_KEY"`
+	MaxDevices    int64  `firestore:"maxDevices" json:"maxDevices"` // 사용자당 최대 기기 수 (0: 무제한)
+
+	// 인증서 해시 (FAIRPLAY_CERTIFICATION 이 CSR 인 경우 필요) 및 교체 중인 이전 자격 증명
+	CertificateHash     string               `firestore:"FAIRPLAY_CERTIFICATE_HASH" json:"FAIRPLAY_CERTIFICATE_HASH"`
+	PreviousCredentials []CustomerCredential `firestore:"FAIRPLAY_PREVIOUS_CREDENTIALS" json:"FAIRPLAY_PREVIOUS_CREDENTIALS"`
 }
 
 type CustomerKey struct {
@@ -46,13 +52,10 @@ type CustomerKey struct {
 	Certification string `json:"FAIRPLAY_CERTIFICATION"`
 	PrivateKey    string `json:"FAIRPLAY_PRIVATE_KEY"`
 	AppServiceKey string `json:"FAIRPLAY_APPLICATION_SERVICE_KEY"`
-}
+	MaxDevices    int64  `json:"maxDevices"`
 
-type FairplayKeys struct {
-	ClientID string `firestore:"client_id"`
-	KID      string `firestore:"kid"`
-	Key      string `firestore:"key"`
-	IV       string `firestore:"iv"`
+	CertificateHash     string               `json:"FAIRPLAY_CERTIFICATE_HASH"`
+	PreviousCredentials []CustomerCredential `json:"FAIRPLAY_PREVIOUS_CREDENTIALS"`
 }
 
 type FairplayKey struct {
@@ -61,78 +64,50 @@ type FairplayKey struct {
 	KID      string `json:"kid" binding:"required"`
 	Key      string `json:"key" binding:"required"`
 	IV       string `json:"iv" binding:"required"`
+	HDCP     string `json:"hdcp"` // none, type0, type1 (생략 시 HDCP TLLV 미전송)
+
+	// 라이선스 기간 정책 (keyType 생략 시 lease/rental 값으로 추론)
+	LeaseDuration  uint32 `json:"leaseDuration"`
+	RentalDuration uint32 `json:"rentalDuration"`
+	KeyType        string `json:"keyType"` // lease, rental, lease_and_rental, persisted, persisted_limited (persisted* 는 offline 필요)
+
+	// 오프라인(다운로드) 정책 (offline=false 이면 영구 키 요청 거부)
+	Offline          bool   `json:"offline"`
+	StorageDuration  uint32 `json:"storageDuration"`
+	PlaybackDuration uint32 `json:"playbackDuration"`
+	TitleID          string `json:"titleID"`
+
+	// 출력 경로별 정책: allow, deny, 또는 HDCP 요구사항 상향(none, type0, type1)
+	AirPlay   string `json:"airplay"`
+	AVAdapter string `json:"avAdapter"`
+
+	// 클라이언트 보안 수준(baseline, main) 및 필수 기능(hdcp_enforcement, offline_key)
+	MinSecurityLevel     string   `json:"minSecurityLevel"`
+	RequiredCapabilities []string `json:"requiredCapabilities"`
+
+	// true 이면 키는 유지한 채 라이선스 발급 중지 (403)
+	Disabled bool `json:"disabled"`
 }
 
-// Firestore 클라이언트 전역
-var firestoreClient *firestore.Client
+// 로드한 .env 파일 경로 (없으면 ""), 로그 설정 후 main 에서 출력
+var envFile string
 
 func init() {
 	// .env 파일 로드 (로컬 개발용)
 	envPaths := []string{".env", "../.env", "../../.env"}
-	loaded := false
 	for _, path := range envPaths {
 		if err := godotenv.Load(path); err == nil {
-			loaded = true
-			logger.Printf("Loaded .env from: %s", path)
+			envFile = path
 			break
 		}
 	}
-	if !loaded {
-		logger.Println("No .env file found, relying on system environment variables")
-	}
-
-	// Firestore 초기화
-	ctx := context.Background()
-	projectID := os.Getenv("GOOGLE_CLOUD_PROJECT")
-	// dbID := os.Getenv("FIRESTORE_DATABASE_ID")
-	keyPath := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
-	if _, err := os.Stat(keyPath); err == nil {
-		// 로컬 서비스 계정 키 사용
-		client, err := firestore.NewClient(ctx, projectID, option.WithCredentialsFile(keyPath))
-		if err != nil {
-			panic(fmt.Sprintf("Failed to init Firestore client: %v", err))
-		}
-		firestoreClient = client
-	} else {
-		// Cloud Run 내장 서비스 계정 사용
-		client, err := firestore.NewClient(ctx, projectID)
-		if err != nil {
-			panic(fmt.Sprintf("Failed to init Firestore client: %v", err))
-		}
-		firestoreClient = client
-	}
-}
-
-// contentKey.go꺼 사용함. 이건 미사용.
-func getFairplayKeys(ctx context.Context, docID string) (*FairplayKeys, error) {
-	doc, err := firestoreClient.Collection("fairplay").Doc(docID).Get(ctx)
-	if err != nil {
-		return nil, err
-	}
-	var keys FairplayKeys
-	if err := doc.DataTo(&keys); err != nil {
-		return nil, err
-	}
-	return &keys, nil
-}
-
-func getCustomerKeys(ctx context.Context, docID string) (*CustomerKeys, error) {
-	doc, err := firestoreClient.Collection("customer").Doc(docID).Get(ctx)
-	if err != nil {
-		return nil, err
-	}
-	var keys CustomerKeys
-	if err := doc.DataTo(&keys); err != nil {
-		return nil, err
-	}
-	return &keys, nil
 }
 
 // Base64 Decode
 func envBase64Decode(s string) []byte {
 	data, err := base64.StdEncoding.DecodeString(s)
 	if err != nil {
-		fmt.Println("Base64 Decode Error: ", err)
+		logger.Warn(context.Background(), "base64 decode error", "error", err)
 		return []byte{}
 	}
 	return data
@@ -164,8 +139,99 @@ func ReadASk(keys *CustomerKeys) []byte {
 	return ask
 }
 
+// 고객사 키로 Ksm 생성
+func newTenantKsm(ctx context.Context, clientID string) (*ksm.Ksm, error) {
+	store, err := keyStorage()
+	if err != nil {
+		return nil, err
+	}
+	cache, err := credentialCache()
+	if err != nil {
+		return nil, err
+	}
+	tenant, err := cache.Get(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ksm.Ksm{
+		Pub:                tenant.Credential.Pub,
+		Pri:                tenant.Credential.Pri,
+		Decrypter:          tenant.Credential.Decrypter,
+		Keys:               NewStorageContentKey(store),
+		Ask:                tenant.Credential.Ask,
+		D:                  startupConfig.d,
+		MinProtocolVersion: startupConfig.minProtocolVersion,
+		Metrics:            expvarMetrics{},
+		DuplicateTags:      startupConfig.duplicateTags,
+		Devices:            store.Devices(clientID),
+		MaxDevices:         tenant.MaxDevices,
+		Replay:             startupConfig.replay,
+		Credentials:        tenant.Credentials,
+	}, nil
+}
+
+// SPC base64 디코딩 (URL / STD 인코딩 모두 지원)
+func decodeSPC(spc string) ([]byte, string, error) {
+	if strings.Contains(spc, "-") || strings.Contains(spc, "_") {
+		playback, err := base64.URLEncoding.DecodeString(spc)
+		return playback, "URL", err
+	} else if strings.Contains(spc, " ") && strings.Contains(spc, "/") {
+		playback, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(spc, " ", "+"))
+		return playback, "STD", err
+	}
+	playback, err := base64.StdEncoding.DecodeString(spc)
+	return playback, "STD", err
+}
+
+// 잘못된 SPC는 클라이언트 오류(4xx)로 응답
+func licenseErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ksm.ErrSPCTruncated),
+		errors.Is(err, ksm.ErrSPCVersion),
+		errors.Is(err, ksm.ErrSPCPayloadLength),
+		errors.Is(err, ksm.ErrTLLVOverrun),
+		errors.Is(err, ksm.ErrTLLVBlockLength),
+		errors.Is(err, ksm.ErrTLLVMissing),
+		errors.Is(err, ksm.ErrDuplicateTag),
+		errors.Is(err, ksm.ErrProtocolVersion),
+		errors.Is(err, ksm.ErrSPCReplayed),
+		errors.Is(err, ksm.ErrSPCExpired),
+		errors.Is(err, ksm.ErrUnknownCertificate),
+		errors.Is(err, errUnknownTenant),
+		errors.Is(err, errAmbiguousTenant):
+		return http.StatusBadRequest
+	case errors.Is(err, ksm.ErrAssetNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ksm.ErrPolicyDenied),
+		errors.Is(err, ksm.ErrAssetDisabled):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
 func main() {
-	defer firestoreClient.Close()
+	if err := loadConfig(); err != nil {
+		logger.Error(context.Background(), "invalid configuration", "error", err)
+		os.Exit(1)
+	}
+	if envFile != "" {
+		logger.Info(context.Background(), "loaded .env", "path", envFile)
+	} else {
+		logger.Info(context.Background(), "no .env file found, relying on system environment variables")
+	}
+	if err := startAdminServer(os.Getenv("ADMIN_LISTEN")); err != nil {
+		logger.Error(context.Background(), "failed to start admin server", "error", err)
+		os.Exit(1)
+	}
+
+	store, err := keyStorage()
+	if err != nil {
+		logger.Error(context.Background(), "failed to open key storage", "error", err)
+		os.Exit(1)
+	}
+	defer store.Close()
 
 	e := echo.New()
 	e.Use(middleware.Logger())
@@ -179,29 +245,12 @@ func main() {
 		return ctx.String(http.StatusOK, "KSM OK")
 	})
 
-	e.POST("/license", func(ctx echo.Context) error {
-		client_id := ctx.QueryParam("client_id")
-		if client_id == "" {
-			return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "client_id query param required"})
-		}
-
-		//고객사 정보 가져오기
-		customerKeys, err := getCustomerKeys(ctx.Request().Context(), client_id)
-		if err != nil {
-			return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to load customer keys: %v", err)})
-		}
-		fmt.Println("getCustomerKeys:", customerKeys)
-
-		// FirestoreContentKey 인스턴스 생성
-		contentKey := NewFirestoreContentKey(ctx.Request().Context())
+	e.POST("/license/batch", batchLicenseHandler)
 
-		k := &ksm.Ksm{
-			Pub: ReadPublicCert(customerKeys),
-			Pri: ReadPriKey(customerKeys),
-			Rck: contentKey,
-			Ask: ReadASk(customerKeys),
-		}
+	e.GET("/devices", listDevicesHandler)
+	e.DELETE("/devices/:device_id", removeDeviceHandler)
 
+	e.POST("/license", func(ctx echo.Context) error {
 		spcMessage := new(SpcMessage)
 		contentType := ctx.Request().Header.Get("Content-Type")
 		if err := ctx.Bind(spcMessage); err != nil {
@@ -209,27 +258,26 @@ func main() {
 			return ctx.JSON(http.StatusBadRequest, errorMessage)
 		}
 
-		var playback []byte
-		var base64EncodingMethod string
+		playback, base64EncodingMethod, err := decodeSPC(spcMessage.Spc)
+		if err != nil {
+			return ctx.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Failed to decode SPC: %v", err)})
+		}
 
-		if strings.Contains(spcMessage.Spc, "-") || strings.Contains(spcMessage.Spc, "_") {
-			base64EncodingMethod = "URL"
-			playback, err = base64.URLEncoding.DecodeString(spcMessage.Spc)
-		} else if strings.Contains(spcMessage.Spc, " ") && strings.Contains(spcMessage.Spc, "/") {
-			base64EncodingMethod = "STD"
-			playback, err = base64.StdEncoding.DecodeString(strings.ReplaceAll(spcMessage.Spc, " ", "+"))
-		} else {
-			base64EncodingMethod = "STD"
-			playback, err = base64.StdEncoding.DecodeString(spcMessage.Spc)
+		// client_id 생략 시 SPC 인증서 해시로 고객사 판별
+		client_id, err := resolveClientID(ctx.Request().Context(), ctx.QueryParam("client_id"), playback)
+		if err != nil {
+			return ctx.JSON(licenseErrorStatus(err), map[string]string{"error": fmt.Sprintf("Failed to find customer: %v", err)})
 		}
 
+		k, err := newTenantKsm(ctx.Request().Context(), client_id)
 		if err != nil {
-			return ctx.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Failed to decode SPC: %v", err)})
+			return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to load customer keys: %v", err)})
 		}
 
-		ckc, err := k.GenCKC(playback)
+		requestCtx := logger.With(ctx.Request().Context(), "tenant", client_id)
+		ckc, err := k.GenCKCContext(requestCtx, playback, ksm.CKCOptions{Offline: spcMessage.Offline, UserID: spcMessage.UserID})
 		if err != nil {
-			return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to generate CKC: %v", err)})
+			return ctx.JSON(licenseErrorStatus(err), map[string]string{"error": fmt.Sprintf("Failed to generate CKC: %v", err)})
 		}
 
 		var result string
@@ -262,17 +310,44 @@ func main() {
 				"error": "doc_id required",
 			})
 		}
+		if c.MaxDevices < 0 {
+			return ctx.JSON(http.StatusBadRequest, map[string]string{
+				"error": "maxDevices must not be negative",
+			})
+		}
 
-		_, err := firestoreClient.Collection("customer").Doc(c.DocID).Set(ctx.Request().Context(), map[string]interface{}{
-			"FAIRPLAY_CERTIFICATION":           c.Certification,
-			"FAIRPLAY_PRIVATE_KEY":             c.PrivateKey,
-			"FAIRPLAY_APPLICATION_SERVICE_KEY": c.AppServiceKey,
-		})
+		keys := &CustomerKeys{
+			Certification:       c.Certification,
+			PrivateKey:          c.PrivateKey,
+			AppServiceKey:       c.AppServiceKey,
+			MaxDevices:          c.MaxDevices,
+			CertificateHash:     c.CertificateHash,
+			PreviousCredentials: c.PreviousCredentials,
+		}
+		for _, credential := range keys.credentials() {
+			if _, err := newCredential(ctx.Request().Context(), credential); err != nil {
+				return ctx.JSON(http.StatusBadRequest, map[string]string{
+					"error": fmt.Sprintf("Invalid credential: %v", err),
+				})
+			}
+		}
+
+		// 인증서 해시로 고객사를 판별하므로 다른 고객사와 같은 인증서는 저장소가 거부
+		err := store.SaveCustomer(ctx.Request().Context(), c.DocID, keys)
+		if errors.Is(err, errCertificateInUse) {
+			return ctx.JSON(http.StatusConflict, map[string]string{
+				"error": fmt.Sprintf("The certificate is already used: %v", err),
+			})
+		}
 		if err != nil {
 			return ctx.JSON(http.StatusInternalServerError, map[string]string{
 				"error": fmt.Sprintf("Failed to save customer keys: %v", err),
 			})
 		}
+		certificateTenants.invalidate()
+		if cache, err := credentialCache(); err == nil {
+			cache.Invalidate(c.DocID)
+		}
 
 		return ctx.JSON(http.StatusOK, map[string]string{
 			"status": "success",
@@ -296,11 +371,64 @@ func main() {
 			})
 		}
 
-		_, err := firestoreClient.Collection("fairplay").Doc(fp.DocID).Set(ctx.Request().Context(), map[string]interface{}{
-			"client_id": fp.ClientID,
-			"kid":       fp.KID,
-			"key":       fp.Key,
-			"iv":        fp.IV,
+		if _, err := ksm.ParseHDCPType(fp.HDCP); err != nil {
+			return ctx.JSON(http.StatusBadRequest, map[string]string{
+				"error": err.Error(),
+			})
+		}
+
+		for _, rule := range []string{fp.AirPlay, fp.AVAdapter} {
+			if _, err := ksm.ParseOutputRule(rule); err != nil {
+				return ctx.JSON(http.StatusBadRequest, map[string]string{
+					"error": err.Error(),
+				})
+			}
+		}
+
+		if _, err := ksm.ParseSecurityLevel(fp.MinSecurityLevel); err != nil {
+			return ctx.JSON(http.StatusBadRequest, map[string]string{
+				"error": err.Error(),
+			})
+		}
+		for _, name := range fp.RequiredCapabilities {
+			if _, err := ksm.ParseCapability(name); err != nil {
+				return ctx.JSON(http.StatusBadRequest, map[string]string{
+					"error": err.Error(),
+				})
+			}
+		}
+
+		keyType, err := ksm.ParseContentKeyType(fp.KeyType)
+		if err == nil && keyType.Persistable() && !fp.Offline {
+			err = fmt.Errorf("keyType %s requires offline", fp.KeyType)
+		}
+		if err == nil && keyType != 0 {
+			_, err = ksm.NewCkcContentKeyDurationBlockWithKeyType(fp.LeaseDuration, fp.RentalDuration, keyType)
+		}
+		if err != nil {
+			return ctx.JSON(http.StatusBadRequest, map[string]string{
+				"error": err.Error(),
+			})
+		}
+
+		err = store.SaveAsset(ctx.Request().Context(), fp.DocID, map[string]interface{}{
+			"client_id":            fp.ClientID,
+			"kid":                  fp.KID,
+			"key":                  fp.Key,
+			"iv":                   fp.IV,
+			"hdcp":                 fp.HDCP,
+			"leaseDuration":        int64(fp.LeaseDuration),
+			"rentalDuration":       int64(fp.RentalDuration),
+			"keyType":              fp.KeyType,
+			"offline":              fp.Offline,
+			"storageDuration":      int64(fp.StorageDuration),
+			"playbackDuration":     int64(fp.PlaybackDuration),
+			"titleID":              fp.TitleID,
+			"airplay":              fp.AirPlay,
+			"avAdapter":            fp.AVAdapter,
+			"minSecurityLevel":     fp.MinSecurityLevel,
+			"requiredCapabilities": fp.RequiredCapabilities,
+			"disabled":             fp.Disabled,
 		})
 		if err != nil {
 			return ctx.JSON(http.StatusInternalServerError, map[string]string{
@@ -319,6 +447,6 @@ func main() {
 		port = "8082" // 로컬 기본 포트
 	}
 
-	fmt.Printf("Starting server on port %s...\n", port)
+	logger.Info(context.Background(), "starting server", "port", port)
 	e.Logger.Fatal(e.Start(":" + port))
 }
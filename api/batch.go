@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/minsoo-gold/fairplay-ksm/ksm"
+	"github.com/minsoo-gold/fairplay-ksm/logger"
+)
+
+// Apple fairplay-streaming-request JSON 포맷 (AVContentKeySession 배치 요청)
+type StreamingRequest struct {
+	Request *StreamingRequestBody `json:"fairplay-streaming-request"`
+}
+
+type StreamingRequestBody struct {
+	Version       int                 `json:"version"`
+	CreateTime    int64               `json:"create-time"`
+	StreamingKeys []StreamingKeyEntry `json:"streaming-keys"`
+}
+
+type StreamingKeyEntry struct {
+	ID      int64  `json:"id"`
+	URI     string `json:"uri"`
+	Spc     string `json:"spc"`
+	Offline bool   `json:"offline,omitempty"` // 영구 키 요청
+}
+
+// Apple fairplay-streaming-response JSON 포맷
+type StreamingResponse struct {
+	Response StreamingResponseBody `json:"fairplay-streaming-response"`
+}
+
+type StreamingResponseBody struct {
+	Version       int                  `json:"version"`
+	CreateTime    int64                `json:"create-time"`
+	StreamingKeys []StreamingKeyResult `json:"streaming-keys"`
+}
+
+// Status는 성공 시 0, 실패 시 /license 와 동일한 HTTP 상태 코드
+type StreamingKeyResult struct {
+	ID     int64  `json:"id"`
+	Status int    `json:"status"`
+	Ckc    string `json:"ckc,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// 한 요청에 담을 수 있는 최대 키 개수
+const maxStreamingKeys = 64
+
+// POST /license/batch?client_id=...&user_id=... (client_id 생략 가능)
+// 고객사 키는 배치당 한 번만 읽고, 각 SPC 마다 CKC 또는 개별 오류를 반환
+func batchLicenseHandler(ctx echo.Context) error {
+	var req StreamingRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, &ErrorMessage{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+	if req.Request == nil || len(req.Request.StreamingKeys) == 0 {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "fairplay-streaming-request.streaming-keys required"})
+	}
+	if len(req.Request.StreamingKeys) > maxStreamingKeys {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("too many streaming-keys, max %d", maxStreamingKeys)})
+	}
+
+	// client_id 생략 시 첫 SPC 의 인증서 해시로 고객사 판별
+	client_id := ctx.QueryParam("client_id")
+	if client_id == "" {
+		playback, _, err := decodeSPC(req.Request.StreamingKeys[0].Spc)
+		if err != nil {
+			return ctx.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Failed to decode SPC: %v", err)})
+		}
+		if client_id, err = resolveClientID(ctx.Request().Context(), "", playback); err != nil {
+			return ctx.JSON(licenseErrorStatus(err), map[string]string{"error": fmt.Sprintf("Failed to find customer: %v", err)})
+		}
+	}
+
+	k, err := newTenantKsm(ctx.Request().Context(), client_id)
+	if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to load customer keys: %v", err)})
+	}
+
+	results := make([]StreamingKeyResult, 0, len(req.Request.StreamingKeys))
+	for _, key := range req.Request.StreamingKeys {
+		result := StreamingKeyResult{ID: key.ID}
+
+		playback, _, err := decodeSPC(key.Spc)
+		if err == nil && len(playback) == 0 {
+			err = errors.New("spc is empty")
+		}
+		if err != nil {
+			result.Status = http.StatusBadRequest
+			result.Error = fmt.Sprintf("Failed to decode SPC: %v", err)
+			results = append(results, result)
+			continue
+		}
+
+		keyCtx := logger.With(ctx.Request().Context(), "tenant", client_id, "batch_key_id", key.ID)
+		ckc, err := k.GenCKCContext(keyCtx, playback, ksm.CKCOptions{Offline: key.Offline, UserID: ctx.QueryParam("user_id")})
+		if err != nil {
+			result.Status = licenseErrorStatus(err)
+			result.Error = fmt.Sprintf("Failed to generate CKC: %v", err)
+			results = append(results, result)
+			continue
+		}
+
+		result.Ckc = base64.StdEncoding.EncodeToString(ckc)
+		results = append(results, result)
+	}
+
+	return ctx.JSON(http.StatusOK, &StreamingResponse{
+		Response: StreamingResponseBody{
+			Version:       req.Request.Version,
+			CreateTime:    time.Now().Unix(),
+			StreamingKeys: results,
+		},
+	})
+}
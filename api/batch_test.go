@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// 캡처한 SPC 의 asset ID (testdata/FPS)
+const batchTestAssetID = "skd://fps.ezdrm.com/;e5685e08-7214-4a2b-8741-b0473e1ee5e4"
+
+// 새 저장소에 testdata 인증서와 개인키로 고객사, SPC 의 asset 저장
+func saveBatchTestCustomer(t *testing.T) Storage {
+	certificate, err := os.ReadFile("../testdata/Development Credentials/fairplay.cer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey, err := os.ReadFile("../testdata/FPS/fairplay_private_key.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	store := useTestStorage(t)
+	err = store.SaveCustomer(ctx, "batch-customer", &CustomerKeys{
+		Certification: base64.StdEncoding.EncodeToString(certificate),
+		PrivateKey:    base64.StdEncoding.EncodeToString(privateKey),
+		AppServiceKey: "2c6b3114ca8831cb01fb26a0646f96e8",
+	})
+	if err != nil {
+		t.Fatalf("SaveCustomer failed: %v", err)
+	}
+	err = store.SaveAsset(ctx, batchTestAssetID, map[string]interface{}{
+		"kid": "00112233445566778899aabbccddeeff",
+		"key": "00112233445566778899aabbccddeeff",
+		"iv":  "00112233445566778899aabbccddeeff",
+	})
+	if err != nil {
+		t.Fatalf("SaveAsset failed: %v", err)
+	}
+	return store
+}
+
+func readSPC(t *testing.T, path string) string {
+	spc, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(spc)
+}
+
+func postBatch(t *testing.T, query string, keys []StreamingKeyEntry) (int, *StreamingResponse) {
+	body, err := json.Marshal(&StreamingRequest{Request: &StreamingRequestBody{Version: 1, StreamingKeys: keys}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+	e.POST("/license/batch", batchLicenseHandler)
+
+	req := httptest.NewRequest(http.MethodPost, "/license/batch"+query, bytes.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	var res StreamingResponse
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatalf("Invalid response %s: %v", rec.Body, err)
+		}
+	}
+	return rec.Code, &res
+}
+
+// client_id 없이 첫 SPC 로 고객사를 찾고, 키마다 CKC 또는 개별 오류
+func TestBatchLicenseHandler(t *testing.T) {
+	saveBatchTestCustomer(t)
+
+	code, res := postBatch(t, "", []StreamingKeyEntry{
+		{ID: 1, Spc: readSPC(t, "../testdata/FPS/spc1.bin")},
+		{ID: 2, Spc: "not base64!"},
+		{ID: 3, Spc: base64.StdEncoding.EncodeToString([]byte("truncated"))},
+		{ID: 4, Spc: readSPC(t, "../testdata/FPS/spc2.bin")},
+	})
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if res.Response.Version != 1 {
+		t.Errorf("Expected version 1, got %d", res.Response.Version)
+	}
+	want := []struct {
+		id     int64
+		status int
+	}{{1, 0}, {2, http.StatusBadRequest}, {3, http.StatusBadRequest}, {4, 0}}
+	if len(res.Response.StreamingKeys) != len(want) {
+		t.Fatalf("Expected %d keys, got %+v", len(want), res.Response.StreamingKeys)
+	}
+	for i, w := range want {
+		key := res.Response.StreamingKeys[i]
+		if key.ID != w.id || key.Status != w.status {
+			t.Errorf("Expected key %d with status %d, got %+v", w.id, w.status, key)
+		}
+		if (key.Status == 0) != (key.Ckc != "") || (key.Status == 0) == (key.Error != "") {
+			t.Errorf("Expected a CKC or an error for key %d, got %+v", w.id, key)
+		}
+	}
+
+	// 다른 인증서의 SPC 는 고객사를 찾을 수 없음
+	code, _ = postBatch(t, "", []StreamingKeyEntry{{ID: 1, Spc: readSPC(t, "../testdata/FPS/old/spc1.bin")}})
+	if code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown certificate, got %d", code)
+	}
+}
+
+// CKC 생성 오류의 상태 코드는 /license 와 동일
+func TestBatchLicenseHandler_KeyStatus(t *testing.T) {
+	store := saveBatchTestCustomer(t)
+	if err := store.SaveAsset(context.Background(), batchTestAssetID, map[string]interface{}{"disabled": true}); err != nil {
+		t.Fatalf("SaveAsset failed: %v", err)
+	}
+
+	code, res := postBatch(t, "?client_id=batch-customer", []StreamingKeyEntry{
+		{ID: 7, Spc: readSPC(t, "../testdata/FPS/spc1.bin")},
+	})
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if len(res.Response.StreamingKeys) != 1 || res.Response.StreamingKeys[0].Status != http.StatusForbidden {
+		t.Errorf("Expected 403 for a disabled asset, got %+v", res.Response.StreamingKeys)
+	}
+}
+
+func TestBatchLicenseHandler_Limit(t *testing.T) {
+	saveBatchTestCustomer(t)
+
+	keys := make([]StreamingKeyEntry, maxStreamingKeys+1)
+	for i := range keys {
+		keys[i] = StreamingKeyEntry{ID: int64(i), Spc: base64.StdEncoding.EncodeToString([]byte("truncated"))}
+	}
+	if code, _ := postBatch(t, "?client_id=batch-customer", keys); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for %d keys, got %d", len(keys), code)
+	}
+
+	code, res := postBatch(t, "?client_id=batch-customer", keys[:maxStreamingKeys])
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200 for %d keys, got %d", maxStreamingKeys, code)
+	}
+	if len(res.Response.StreamingKeys) != maxStreamingKeys {
+		t.Errorf("Expected %d keys, got %d", maxStreamingKeys, len(res.Response.StreamingKeys))
+	}
+
+	if code, _ := postBatch(t, "?client_id=batch-customer", nil); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without keys, got %d", code)
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minsoo-gold/fairplay-ksm/cryptos"
+	"github.com/minsoo-gold/fairplay-ksm/keydaemon"
+	"github.com/minsoo-gold/fairplay-ksm/ksm"
+	"github.com/minsoo-gold/fairplay-ksm/logger"
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/grpc"
+)
+
+// 시작할 때 한 번 읽어 검증하는 설정 (main 에서 loadConfig 호출), 요청마다 다시 읽지 않음
+var startupConfig struct {
+	minProtocolVersion uint32
+	d                  ksm.DFunction // nil: 참조 구현
+	duplicateTags      ksm.DuplicateTagPolicy
+	replay             *ksm.ReplayGuard // nil: 재전송 검사 안 함
+}
+
+// 설정이 잘못되면 서버를 시작하지 않도록 오류 반환
+func loadConfig() error {
+	if err := configureLogging(); err != nil {
+		return err
+	}
+	var err error
+	if startupConfig.minProtocolVersion, err = minProtocolVersion(); err != nil {
+		return err
+	}
+	if startupConfig.duplicateTags, err = duplicateTagPolicy(); err != nil {
+		return err
+	}
+	if startupConfig.replay, err = replayGuard(); err != nil {
+		return err
+	}
+	if startupConfig.d, err = dFunction(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// MIN_PROTOCOL_VERSION 환경 변수 (비어 있으면 0, 즉 최소 버전 제한 없음)
+func minProtocolVersion() (uint32, error) {
+	value := os.Getenv("MIN_PROTOCOL_VERSION")
+	if value == "" {
+		return 0, nil
+	}
+	version, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid MIN_PROTOCOL_VERSION %q: %w", value, err)
+	}
+	return uint32(version), nil
+}
+
+// DUPLICATE_TLLV 환경 변수 (warn: 로그만 남김, reject: 400 응답)
+func duplicateTagPolicy() (ksm.DuplicateTagPolicy, error) {
+	policy, err := ksm.ParseDuplicateTagPolicy(os.Getenv("DUPLICATE_TLLV"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid DUPLICATE_TLLV: %w", err)
+	}
+	return policy, nil
+}
+
+// REPLAY_GUARD=true 이면 같은 SPC 재사용 거부
+// REPLAY_WINDOW (예: 5m) 가 있으면 SPC 생성 시각이 범위를 벗어날 때도 거부
+// 검사용 저장소는 인스턴스 내 모든 요청이 공유
+func replayGuard() (*ksm.ReplayGuard, error) {
+	enabled, _ := strconv.ParseBool(os.Getenv("REPLAY_GUARD"))
+	if !enabled {
+		return nil, nil
+	}
+
+	guard := &ksm.ReplayGuard{Store: ksm.NewMemoryReplayStore()}
+	if value := os.Getenv("REPLAY_WINDOW"); value != "" {
+		window, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid REPLAY_WINDOW %q: %w", value, err)
+		}
+		guard.Window = window
+	}
+	return guard, nil
+}
+
+// D 함수 구현 선택 (시작할 때 한 번만 로드, 실패하면 서버를 시작하지 않음)
+// D_FUNCTION_PROCESS: 외부 프로그램 경로와 인자 (stdin/stdout 프로토콜)
+// D_FUNCTION_LIBRARY: 공유 라이브러리 경로 (cgo, dlopen 태그 빌드 필요), D_FUNCTION_SYMBOL 로 심볼 지정
+// 둘 다 없으면 nil, 즉 참조 구현 사용
+func dFunction() (ksm.DFunction, error) {
+	if command := strings.Fields(os.Getenv("D_FUNCTION_PROCESS")); len(command) > 0 {
+		d, err := ksm.NewProcessDFunction(command[0], command[1:]...)
+		if err != nil {
+			return nil, fmt.Errorf("invalid D_FUNCTION_PROCESS: %w", err)
+		}
+		return d, nil
+	}
+	if path := os.Getenv("D_FUNCTION_LIBRARY"); path != "" {
+		d, err := ksm.LoadSharedDFunction(path, os.Getenv("D_FUNCTION_SYMBOL"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid D_FUNCTION_LIBRARY: %w", err)
+		}
+		return d, nil
+	}
+	return nil, nil
+}
+
+var (
+	storageOnce sync.Once
+	storageImpl Storage
+	storageErr  error
+)
+
+// 키 저장소 선택 (프로세스 당 하나, 처음 사용할 때 연결)
+// STORAGE: firestore(기본, GOOGLE_CLOUD_PROJECT 필요), memory(재시작하면 사라짐), file(STORAGE_FILE 경로의 JSON 파일)
+func keyStorage() (Storage, error) {
+	storageOnce.Do(func() {
+		switch backend := os.Getenv("STORAGE"); backend {
+		case "", "firestore":
+			storageImpl, storageErr = newFirestoreStorage(context.Background())
+		case "memory":
+			storageImpl = newMemoryStorage()
+		case "file":
+			path := os.Getenv("STORAGE_FILE")
+			if path == "" {
+				storageErr = errors.New("STORAGE=file requires STORAGE_FILE")
+				return
+			}
+			storageImpl, storageErr = newFileStorage(path)
+		default:
+			storageErr = fmt.Errorf("invalid STORAGE %q, must be firestore, memory or file", backend)
+		}
+	})
+	return storageImpl, storageErr
+}
+
+var (
+	credentialCacheOnce sync.Once
+	credentialCacheImpl *ksm.CredentialCache
+	credentialCacheErr  error
+)
+
+// 고객사 자격 증명 캐시 (프로세스 당 하나)
+// CREDENTIAL_CACHE_TTL (예: 10m, 기본 5m), 음수이면 캐시하지 않음
+// /customer 로 키를 저장하면 해당 고객사만 즉시 무효화
+func credentialCache() (*ksm.CredentialCache, error) {
+	credentialCacheOnce.Do(func() {
+		var ttl time.Duration
+		if value := os.Getenv("CREDENTIAL_CACHE_TTL"); value != "" {
+			var err error
+			ttl, err = time.ParseDuration(value)
+			if err != nil {
+				credentialCacheErr = fmt.Errorf("invalid CREDENTIAL_CACHE_TTL %q: %w", value, err)
+				return
+			}
+			if ttl == 0 {
+				ttl = -1
+			}
+		}
+		credentialCacheImpl = ksm.NewCredentialCache(ttl, loadTenant)
+	})
+	return credentialCacheImpl, credentialCacheErr
+}
+
+// 프로세스 밖 개인키 (키 ID: 인증서 해시 hex), 키마다 한 번만 연결
+// 잠금은 공유 연결과 맵에만 사용, 키별 연결과 로그인은 singleflight 로 다른 키를 막지 않음
+var remoteKeys = struct {
+	sync.Mutex
+	daemon  *grpc.ClientConn
+	module  *cryptos.PKCS11Module
+	byKeyID map[string]crypto.Decrypter
+	loads   singleflight.Group
+}{byKeyID: make(map[string]crypto.Decrypter)}
+
+// KEY_DAEMON: 키 데몬 주소 (예: unix:///run/keydaemon.sock, cmd/keydaemon 참고)
+// PKCS11_MODULE: PKCS#11 모듈 경로 (cgo, pkcs11 태그 빌드 필요), PKCS11_TOKEN 토큰 라벨, PKCS11_PIN
+// PKCS#11 개인키 라벨은 인증서 해시 hex
+func remotePrivateKey(ctx context.Context, keyID string) (crypto.Decrypter, error) {
+	remoteKeys.Lock()
+	d, ok := remoteKeys.byKeyID[keyID]
+	remoteKeys.Unlock()
+	if ok {
+		return d, nil
+	}
+
+	// 첫 요청이 취소되어도 같이 기다리는 요청은 계속 진행
+	loaded, err, _ := remoteKeys.loads.Do(keyID, func() (interface{}, error) {
+		d, err := loadRemotePrivateKey(context.WithoutCancel(ctx), keyID)
+		if err != nil {
+			return nil, err
+		}
+		remoteKeys.Lock()
+		remoteKeys.byKeyID[keyID] = d
+		remoteKeys.Unlock()
+		return d, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return loaded.(crypto.Decrypter), nil
+}
+
+func loadRemotePrivateKey(ctx context.Context, keyID string) (crypto.Decrypter, error) {
+	if target := os.Getenv("KEY_DAEMON"); target != "" {
+		conn, err := keyDaemonConn(target)
+		if err != nil {
+			return nil, err
+		}
+		return keydaemon.NewDecrypter(ctx, conn, keyID)
+	}
+	if path := os.Getenv("PKCS11_MODULE"); path != "" {
+		module, err := pkcs11Module(path)
+		if err != nil {
+			return nil, err
+		}
+		return module.Decrypter(os.Getenv("PKCS11_TOKEN"), os.Getenv("PKCS11_PIN"), keyID)
+	}
+	return nil, errors.New("FAIRPLAY_PRIVATE_KEY is empty and neither KEY_DAEMON nor PKCS11_MODULE is set")
+}
+
+// 키 데몬 연결은 모든 키가 공유 (grpc.NewClient 는 실제 연결을 기다리지 않음)
+func keyDaemonConn(target string) (*grpc.ClientConn, error) {
+	remoteKeys.Lock()
+	defer remoteKeys.Unlock()
+
+	if remoteKeys.daemon == nil {
+		conn, err := keydaemon.Dial(target)
+		if err != nil {
+			return nil, fmt.Errorf("invalid KEY_DAEMON: %w", err)
+		}
+		remoteKeys.daemon = conn
+	}
+	return remoteKeys.daemon, nil
+}
+
+// PKCS#11 모듈은 한 번만 로드, 토큰 로그인은 키마다 Decrypter 에서
+func pkcs11Module(path string) (*cryptos.PKCS11Module, error) {
+	remoteKeys.Lock()
+	defer remoteKeys.Unlock()
+
+	if remoteKeys.module == nil {
+		module, err := cryptos.OpenPKCS11Module(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PKCS11_MODULE: %w", err)
+		}
+		remoteKeys.module = module
+	}
+	return remoteKeys.module, nil
+}
+
+// 로그 설정
+// LOG_LEVEL: debug, info(기본), warn, error
+// LOG_FORMAT: text(기본) 또는 json
+// LOG_SECRETS=true: 키 값(SK, DASk 등)을 debug 로그에 출력. 테스트 자격 증명으로 디버깅할 때만 사용
+func configureLogging() error {
+	level, err := logger.ParseLevel(os.Getenv("LOG_LEVEL"))
+	if err != nil {
+		return fmt.Errorf("invalid LOG_LEVEL: %w", err)
+	}
+	logger.SetLevel(level)
+
+	options := &slog.HandlerOptions{Level: logger.Level()}
+	switch format := os.Getenv("LOG_FORMAT"); format {
+	case "", "text":
+		logger.SetHandler(slog.NewTextHandler(os.Stdout, options))
+	case "json":
+		logger.SetHandler(slog.NewJSONHandler(os.Stdout, options))
+	default:
+		return fmt.Errorf("invalid LOG_FORMAT %q, must be text or json", format)
+	}
+
+	secrets, _ := strconv.ParseBool(os.Getenv("LOG_SECRETS"))
+	if secrets && level > slog.LevelDebug {
+		return fmt.Errorf("LOG_SECRETS requires LOG_LEVEL=debug")
+	}
+	logger.UnlockSecrets(secrets)
+	return nil
+}
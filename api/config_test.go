@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/minsoo-gold/fairplay-ksm/keydaemon"
+	"github.com/minsoo-gold/fairplay-ksm/ksm"
+	"google.golang.org/grpc"
+)
+
+// 잘못된 설정은 요청마다 500 이 아니라 시작할 때 오류
+func TestLoadConfig(t *testing.T) {
+	saved := startupConfig
+	t.Cleanup(func() { startupConfig = saved })
+
+	t.Setenv("MIN_PROTOCOL_VERSION", "2")
+	if err := loadConfig(); err != nil {
+		t.Fatalf("loadConfig failed: %v", err)
+	}
+	if startupConfig.minProtocolVersion != 2 {
+		t.Errorf("Expected min protocol version 2, got %d", startupConfig.minProtocolVersion)
+	}
+
+	t.Setenv("MIN_PROTOCOL_VERSION", "two")
+	if err := loadConfig(); err == nil {
+		t.Error("Expected an error for an invalid MIN_PROTOCOL_VERSION")
+	}
+
+	t.Setenv("MIN_PROTOCOL_VERSION", "")
+	if err := loadConfig(); err != nil {
+		t.Fatalf("loadConfig failed: %v", err)
+	}
+
+	// 잘못된 로그 설정도 panic 이 아니라 오류
+	t.Setenv("LOG_LEVEL", "verbose")
+	if err := loadConfig(); err == nil {
+		t.Error("Expected an error for an invalid LOG_LEVEL")
+	}
+	t.Setenv("LOG_LEVEL", "")
+
+	// D 함수를 로드할 수 없으면 시작하지 않음
+	t.Setenv("D_FUNCTION_PROCESS", "/nonexistent/d-function")
+	if err := loadConfig(); err == nil {
+		t.Error("Expected an error for a missing D_FUNCTION_PROCESS program")
+	}
+	t.Setenv("D_FUNCTION_PROCESS", "")
+	if err := loadConfig(); err != nil || startupConfig.d != nil {
+		t.Fatalf("Expected the reference D function, got %v, %v", startupConfig.d, err)
+	}
+}
+
+// DUPLICATE_TLLV, REPLAY_GUARD, REPLAY_WINDOW 도 시작할 때 한 번만 검증
+func TestLoadConfig_SPCChecks(t *testing.T) {
+	saved := startupConfig
+	t.Cleanup(func() { startupConfig = saved })
+
+	t.Setenv("DUPLICATE_TLLV", "reject")
+	t.Setenv("REPLAY_GUARD", "true")
+	t.Setenv("REPLAY_WINDOW", "5m")
+	if err := loadConfig(); err != nil {
+		t.Fatalf("loadConfig failed: %v", err)
+	}
+	if startupConfig.duplicateTags != ksm.DuplicateTagReject {
+		t.Errorf("Expected the reject policy, got %v", startupConfig.duplicateTags)
+	}
+	if startupConfig.replay == nil || startupConfig.replay.Window != 5*time.Minute {
+		t.Errorf("Expected a replay guard with a 5m window, got %+v", startupConfig.replay)
+	}
+
+	t.Setenv("REPLAY_WINDOW", "five minutes")
+	if err := loadConfig(); err == nil {
+		t.Error("Expected an error for an invalid REPLAY_WINDOW")
+	}
+	t.Setenv("REPLAY_WINDOW", "")
+	t.Setenv("DUPLICATE_TLLV", "ignore")
+	if err := loadConfig(); err == nil {
+		t.Error("Expected an error for an invalid DUPLICATE_TLLV")
+	}
+
+	t.Setenv("DUPLICATE_TLLV", "")
+	t.Setenv("REPLAY_GUARD", "")
+	if err := loadConfig(); err != nil || startupConfig.replay != nil {
+		t.Fatalf("Expected no replay guard, got %+v, %v", startupConfig.replay, err)
+	}
+}
+
+// 키 데몬의 개인키는 키마다 한 번만 연결하고, 실패한 키는 다음 요청에서 다시 시도
+func TestRemotePrivateKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := keydaemon.NewServer()
+	if err := server.AddKey("fps", key); err != nil {
+		t.Fatal(err)
+	}
+	g := grpc.NewServer()
+	server.Register(g)
+	socket := filepath.Join(t.TempDir(), "keydaemon.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go g.Serve(listener)
+	t.Cleanup(g.Stop)
+
+	t.Setenv("KEY_DAEMON", "unix://"+socket)
+	t.Cleanup(func() {
+		remoteKeys.Lock()
+		defer remoteKeys.Unlock()
+		if remoteKeys.daemon != nil {
+			remoteKeys.daemon.Close()
+		}
+		remoteKeys.daemon, remoteKeys.byKeyID = nil, make(map[string]crypto.Decrypter)
+	})
+
+	ctx := context.Background()
+	keys := make([]crypto.Decrypter, 8)
+	var wg sync.WaitGroup
+	for i := range keys {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			d, err := remotePrivateKey(ctx, "fps")
+			if err != nil {
+				t.Errorf("remotePrivateKey failed: %v", err)
+			}
+			keys[i] = d
+		}(i)
+	}
+	wg.Wait()
+	for _, d := range keys {
+		if d == nil || d != keys[0] {
+			t.Fatalf("Expected one decrypter for the key, got %v", keys)
+		}
+	}
+	if !key.PublicKey.Equal(keys[0].Public()) {
+		t.Error("Expected the public key of the daemon key")
+	}
+
+	if _, err := remotePrivateKey(ctx, "missing"); err == nil {
+		t.Error("Expected an error for a key unknown to the daemon")
+	}
+	if err := server.AddKey("missing", key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := remotePrivateKey(ctx, "missing"); err != nil {
+		t.Errorf("Expected the failed key to be loaded again, got %v", err)
+	}
+}
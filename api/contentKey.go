@@ -6,34 +6,113 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/minsoo-gold/fairplay-ksm/ksm"
 )
 
-type FirestoreContentKey struct {
-	ctx context.Context
+// StorageContentKey: 저장소의 asset 문서에서 키와 라이선스 정책을 가져오는 ksm.ContentKeyProvider
+// 요청마다 새로 만들어 쓰며, 요청 안에서 같은 asset 은 문서를 한 번만 읽음 (배치 요청 등)
+type StorageContentKey struct {
+	store Storage
+
+	mu     sync.Mutex
+	assets map[string]*assetLookup
+}
+
+// 요청 내 asset 조회 결과 (없는/비활성 asset 오류도 재사용)
+type assetLookup struct {
+	done chan struct{}
+	key  *ksm.AssetKey
+	err  error
 }
 
-// Firestore 초기화 (main에서 호출)
-// tenantID를 고정해서 이 인스턴스는 특정 테넌트만 다루도록 합니다.
-func NewFirestoreContentKey(ctx context.Context) *FirestoreContentKey {
-	return &FirestoreContentKey{ctx: ctx}
+func NewStorageContentKey(store Storage) *StorageContentKey {
+	return &StorageContentKey{store: store}
+}
+
+// FetchAssetKey: 요청 컨텍스트로 키, 정책, (재생 상태가 있으면) 기간을 가져오기
+func (f *StorageContentKey) FetchAssetKey(ctx context.Context, spc *ksm.SPC) (*ksm.AssetKey, error) {
+	assetKey, err := f.lookup(ctx, spc.AssetID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 조회 결과는 공유하므로 복사해서 반환
+	key := *assetKey
+	if spc.PlaybackState == nil {
+		key.Duration = nil
+	}
+	return &key, nil
+}
+
+// lookup: asset 문서를 읽어 키, 기간, 정책을 한꺼번에 해석 (요청 내 캐시)
+func (f *StorageContentKey) lookup(ctx context.Context, assetID []byte) (*ksm.AssetKey, error) {
+	f.mu.Lock()
+	if l, ok := f.assets[string(assetID)]; ok {
+		f.mu.Unlock()
+		<-l.done
+		observeAssetLookupCached()
+		return l.key, l.err
+	}
+	if f.assets == nil {
+		f.assets = map[string]*assetLookup{}
+	}
+	l := &assetLookup{done: make(chan struct{})}
+	f.assets[string(assetID)] = l
+	f.mu.Unlock()
+
+	start := time.Now()
+	data, err := f.readAsset(ctx, assetID)
+	if err == nil {
+		l.key, err = parseAssetKey(data)
+	}
+	l.err = err
+	observeAssetLookup(time.Since(start), err)
+
+	// 일시적인 오류는 이후 조회에서 다시 읽도록 캐시에서 제거
+	if err != nil && !errors.Is(err, ksm.ErrAssetNotFound) && !errors.Is(err, ksm.ErrAssetDisabled) {
+		f.mu.Lock()
+		delete(f.assets, string(assetID))
+		f.mu.Unlock()
+	}
+	close(l.done)
+	return l.key, l.err
 }
 
-// (선택) 종료 시 호출
-// func (f *FirestoreContentKey) Close() error {
-// 	return f.client.Close()
-// }
+// asset 문서 읽기
+// 문서가 없으면 ksm.ErrAssetNotFound, disabled 필드가 true 면 ksm.ErrAssetDisabled
+func (f *StorageContentKey) readAsset(ctx context.Context, assetID []byte) (map[string]interface{}, error) {
+	data, err := f.store.Asset(ctx, string(assetID))
+	if err != nil {
+		return nil, err
+	}
+	if disabled, _ := data["disabled"].(bool); disabled {
+		return nil, fmt.Errorf("%w: %s", ksm.ErrAssetDisabled, assetID)
+	}
+	return data, nil
+}
 
-// FetchContentKey: Firestore에서 contentKey, IV 가져오기
-// 경로: tenants/{tenantID}/asset_keys/{assetID}
-func (f *FirestoreContentKey) FetchContentKey(assetID []byte) ([]byte, []byte, []byte, error) {
-	doc, err := firestoreClient.Collection("fairplay").Doc(string(assetID)).Get(f.ctx)
+// parseAssetKey: asset 문서 하나에서 키, 기간, 정책 해석
+func parseAssetKey(data map[string]interface{}) (*ksm.AssetKey, error) {
+	kid, key, iv, err := parseContentKey(data)
+	if err != nil {
+		return nil, err
+	}
+	duration, err := parseContentKeyDuration(data)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, err
 	}
-	data := doc.Data()
+	policy, err := parseAssetPolicy(data)
+	if err != nil {
+		return nil, err
+	}
+	return &ksm.AssetKey{KID: kid, Key: key, IV: iv, Duration: duration, Policy: policy}, nil
+}
 
+// parseContentKey: asset 문서의 kid, contentKey, IV
+func parseContentKey(data map[string]interface{}) ([]byte, []byte, []byte, error) {
 	//kid 추가
 	kidBytes, err := toBytes(data["kid"])
 	if err != nil {
@@ -62,16 +141,8 @@ func (f *FirestoreContentKey) FetchContentKey(assetID []byte) ([]byte, []byte, [
 	return kidBytes, keyBytes, ivBytes, nil
 }
 
-// FetchContentKeyDuration: Firestore에서 Lease/RentalDuration 가져오기
-// 경로: tenants/{tenantID}/license_policy/{assetID}
-func (f *FirestoreContentKey) FetchContentKeyDuration(assetID []byte) (*ksm.CkcContentKeyDurationBlock, error) {
-	doc, err := firestoreClient.Collection("fairplay").Doc(string(assetID)).Get(f.ctx)
-	if err != nil {
-		// 문서가 없거나 필드가 없으면 0으로 처리
-		return ksm.NewCkcContentKeyDurationBlock(0, 0), nil
-	}
-	data := doc.Data()
-
+// parseContentKeyDuration: asset 문서의 Lease/RentalDuration (필드가 없으면 0)
+func parseContentKeyDuration(data map[string]interface{}) (*ksm.CkcContentKeyDurationBlock, error) {
 	lease, err := toUint32(data["leaseDuration"])
 	if err != nil {
 		lease = 0
@@ -81,12 +152,80 @@ func (f *FirestoreContentKey) FetchContentKeyDuration(assetID []byte) (*ksm.CkcC
 		rental = 0
 	}
 
-	return ksm.NewCkcContentKeyDurationBlock(lease, rental), nil
+	// keyType 이 없으면 lease/rental 값으로 추론, 둘 다 없으면 기간 TLLV 미전송
+	keyTypeName, _ := data["keyType"].(string)
+	keyType, err := ksm.ParseContentKeyType(keyTypeName)
+	if err != nil {
+		return nil, err
+	}
+	if keyType == 0 {
+		return ksm.NewCkcContentKeyDurationBlock(lease, rental), nil
+	}
+	// 영구 키 유형은 오프라인(다운로드)이 허용된 asset 만
+	if offline, _ := data["offline"].(bool); keyType.Persistable() && !offline {
+		return nil, fmt.Errorf("%w: keyType %q requires offline", ksm.ErrContentKeyType, keyTypeName)
+	}
+
+	return ksm.NewCkcContentKeyDurationBlockWithKeyType(lease, rental, keyType)
+}
+
+// parseAssetPolicy: asset 문서의 라이선스 정책(HDCP, 오프라인, 출력 경로, 보안 수준)
+func parseAssetPolicy(data map[string]interface{}) (*ksm.AssetPolicy, error) {
+	hdcpName, _ := data["hdcp"].(string)
+	hdcp, err := ksm.ParseHDCPType(hdcpName)
+	if err != nil {
+		return nil, err
+	}
+	policy := &ksm.AssetPolicy{HDCP: hdcp}
+
+	// 오프라인(다운로드) 허용 여부, 기간은 없으면 0(무제한)
+	if offline, _ := data["offline"].(bool); offline {
+		storage, _ := toUint32(data["storageDuration"])
+		playback, _ := toUint32(data["playbackDuration"])
+		titleID, _ := data["titleID"].(string)
+		policy.Offline = &ksm.OfflinePolicy{
+			StorageDuration:  storage,
+			PlaybackDuration: playback,
+			TitleID:          titleID,
+		}
+	}
+
+	// 출력 경로별 정책 (AirPlay, Apple 디지털 AV 어댑터)
+	for output, field := range map[ksm.OutputPath]string{ksm.OutputAirPlay: "airplay", ksm.OutputAVAdapter: "avAdapter"} {
+		name, _ := data[field].(string)
+		rule, err := ksm.ParseOutputRule(name)
+		if err != nil {
+			return nil, err
+		}
+		if rule != (ksm.OutputRule{}) {
+			if policy.Outputs == nil {
+				policy.Outputs = map[ksm.OutputPath]ksm.OutputRule{}
+			}
+			policy.Outputs[output] = rule
+		}
+	}
+
+	// 클라이언트 보안 수준 / 필수 기능
+	levelName, _ := data["minSecurityLevel"].(string)
+	if policy.MinSecurityLevel, err = ksm.ParseSecurityLevel(levelName); err != nil {
+		return nil, err
+	}
+	capabilities, _ := data["requiredCapabilities"].([]interface{})
+	for _, v := range capabilities {
+		name, _ := v.(string)
+		capability, err := ksm.ParseCapability(name)
+		if err != nil {
+			return nil, err
+		}
+		policy.RequiredCapabilities |= capability
+	}
+
+	return policy, nil
 }
 
 // ---------- 유틸리티 ----------
 
-// Firestore에 저장된 값을 []byte로 변환
+// 저장소의 값을 []byte로 변환
 // - []byte (native)
 // - string (hex 또는 base64) 를 지원
 func toBytes(v interface{}) ([]byte, error) {
@@ -108,8 +247,8 @@ func toBytes(v interface{}) ([]byte, error) {
 	}
 }
 
-// Firestore 숫자 필드 → uint32
-// Firestore는 숫자를 int64(float64) 로 돌려줄 수 있으므로 호환 처리
+// 저장소 숫자 필드 → uint32
+// Firestore는 숫자를 int64(float64) 로, 메모리/파일 저장소는 float64 로 돌려주므로 호환 처리
 func toUint32(v interface{}) (uint32, error) {
 	switch n := v.(type) {
 	case int64:
@@ -157,7 +296,6 @@ func (RandomContentKey) FetchContentKey(assetID []byte) ([]byte, []byte, error)
 
 // Implement FetchContentKeyDuration func
 func (RandomContentKey) FetchContentKeyDuration(assetID []byte) (*ksm.CkcContentKeyDurationBlock, error) {
-
 	LeaseDuration := rand.Uint32()  // The duration of the lease, if any, in seconds.
 	RentalDuration := rand.Uint32() // The duration of the rental, if any, in seconds.
 
@@ -2,7 +2,12 @@ package main
 
 import (
 	"context"
+	"errors"
+	"os"
 	"testing"
+	"time"
+
+	"github.com/minsoo-gold/fairplay-ksm/ksm"
 )
 
 // 단위 테스트
@@ -13,44 +18,152 @@ func TestFirestoreContentKey_RealData(t *testing.T) {
 	realAssetID := "GRYCzx5wxnkYXliJ|;12132091-d0ef-4f6f-8cca-34989edd0a2b"
 
 	ctx := context.Background()
-	contentKey := NewFirestoreContentKey(ctx)
+	contentKey := NewStorageContentKey(testFirestoreStorage(t))
 
-	kidBytes, keyBytes, ivBytes, err := contentKey.FetchContentKey([]byte(realAssetID))
+	// 재생 상태가 있는 SPC 는 기간도 함께 가져옴
+	spc := &ksm.SPC{AssetID: []byte(realAssetID), PlaybackState: &ksm.MediaPlaybackState{CreationTime: time.Now()}}
+	assetKey, err := contentKey.FetchAssetKey(ctx, spc)
 
 	if err != nil {
-		t.Fatalf("FetchContentKey failed: %v", err)
+		t.Fatalf("FetchAssetKey failed: %v", err)
 	}
 
 	//kid 사용여부 확인.
-	if len(kidBytes) != 16 {
-		t.Errorf("Expected kid length 16, got %d", len(kidBytes))
+	if len(assetKey.KID) != 16 {
+		t.Errorf("Expected kid length 16, got %d", len(assetKey.KID))
 	}
 
-	if len(keyBytes) != 16 {
-		t.Errorf("Expected key length 16, got %d", len(keyBytes))
+	if len(assetKey.Key) != 16 {
+		t.Errorf("Expected key length 16, got %d", len(assetKey.Key))
 	}
 
-	if len(ivBytes) != 16 {
-		t.Errorf("Expected IV length 16, got %d", len(ivBytes))
+	if len(assetKey.IV) != 16 {
+		t.Errorf("Expected IV length 16, got %d", len(assetKey.IV))
 	}
 
 	t.Logf("asset: %s", realAssetID)
-	t.Logf("Kid: %x", kidBytes)
-	t.Logf("Key: %x", keyBytes)
-	t.Logf("IV: %x", ivBytes)
+	t.Logf("Kid: %x", assetKey.KID)
+	t.Logf("Key: %x", assetKey.Key)
+	t.Logf("IV: %x", assetKey.IV)
+
+	if assetKey.Duration == nil {
+		t.Fatal("Expected non-nil duration")
+	}
 
-	// FetchContentKeyDuration 테스트
-	duration, err := contentKey.FetchContentKeyDuration([]byte(realAssetID))
+	t.Logf("Lease Duration: %d", assetKey.Duration.LeaseDuration)
+	t.Logf("Rental Duration: %d", assetKey.Duration.RentalDuration)
+}
 
+// 없는 asset 은 ksm.ErrAssetNotFound
+func TestFirestoreContentKey_NotFound(t *testing.T) {
+	spc := &ksm.SPC{AssetID: []byte("no-such-asset-9f1c2e")}
+	_, err := NewStorageContentKey(testFirestoreStorage(t)).FetchAssetKey(context.Background(), spc)
+	if !errors.Is(err, ksm.ErrAssetNotFound) {
+		t.Fatalf("Expected ErrAssetNotFound, got %v", err)
+	}
+}
+
+// GOOGLE_CLOUD_PROJECT 가 없으면 Firestore 테스트는 건너뜀
+func testFirestoreStorage(t *testing.T) Storage {
+	if os.Getenv("GOOGLE_CLOUD_PROJECT") == "" {
+		t.Skip("GOOGLE_CLOUD_PROJECT not set")
+	}
+	store, err := newFirestoreStorage(context.Background())
 	if err != nil {
-		t.Fatalf("FetchContentKeyDuration failed: %v", err)
+		t.Fatalf("newFirestoreStorage failed: %v", err)
 	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
 
-	if duration == nil {
-		t.Fatal("Expected non-nil duration")
+// asset 읽기 횟수를 세는 저장소
+type countingStorage struct {
+	Storage
+	reads int
+}
+
+func (s *countingStorage) Asset(ctx context.Context, assetID string) (map[string]interface{}, error) {
+	s.reads++
+	return s.Storage.Asset(ctx, assetID)
+}
+
+// 요청 안에서 같은 asset 은 문서를 한 번만 읽고, 재생 상태가 없으면 기간은 빠짐
+func TestStorageContentKey_SingleRead(t *testing.T) {
+	ctx := context.Background()
+	store := &countingStorage{Storage: newMemoryStorage()}
+	err := store.SaveAsset(ctx, "asset", map[string]interface{}{
+		"kid":           "00112233445566778899aabbccddeeff",
+		"key":           "00112233445566778899aabbccddeeff",
+		"iv":            "00112233445566778899aabbccddeeff",
+		"hdcp":          "type1",
+		"leaseDuration": int64(3600),
+	})
+	if err != nil {
+		t.Fatalf("SaveAsset failed: %v", err)
 	}
+	f := NewStorageContentKey(store)
 
-	t.Logf("asset: %s", realAssetID)
-	t.Logf("Lease Duration: %d", duration.LeaseDuration)
-	t.Logf("Rental Duration: %d", duration.RentalDuration)
+	withState := &ksm.SPC{AssetID: []byte("asset"), PlaybackState: &ksm.MediaPlaybackState{CreationTime: time.Now()}}
+	assetKey, err := f.FetchAssetKey(ctx, withState)
+	if err != nil {
+		t.Fatalf("FetchAssetKey failed: %v", err)
+	}
+	if assetKey.Duration == nil || assetKey.Duration.LeaseDuration != 3600 {
+		t.Errorf("Expected lease duration 3600, got %+v", assetKey.Duration)
+	}
+	if assetKey.Policy.HDCP != ksm.HDCPType1 {
+		t.Errorf("Expected HDCP type 1, got %v", assetKey.Policy.HDCP)
+	}
+
+	assetKey, err = f.FetchAssetKey(ctx, &ksm.SPC{AssetID: []byte("asset")})
+	if err != nil {
+		t.Fatalf("FetchAssetKey failed: %v", err)
+	}
+	if assetKey.Duration != nil {
+		t.Errorf("Expected no duration without playback state, got %+v", assetKey.Duration)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := f.FetchAssetKey(ctx, &ksm.SPC{AssetID: []byte("missing")}); !errors.Is(err, ksm.ErrAssetNotFound) {
+			t.Fatalf("Expected ErrAssetNotFound, got %v", err)
+		}
+	}
+	if store.reads != 2 {
+		t.Errorf("Expected 2 reads, got %d", store.reads)
+	}
+}
+
+// disabled asset 은 ksm.ErrAssetDisabled
+func TestStorageContentKey_Disabled(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStorage()
+	store.SaveAsset(ctx, "asset", map[string]interface{}{"disabled": true})
+
+	_, err := NewStorageContentKey(store).FetchAssetKey(ctx, &ksm.SPC{AssetID: []byte("asset")})
+	if !errors.Is(err, ksm.ErrAssetDisabled) {
+		t.Fatalf("Expected ErrAssetDisabled, got %v", err)
+	}
+}
+
+// 기간이 없으면 기간 TLLV 미전송, 영구 키 유형은 offline asset 만
+func TestParseContentKeyDuration_KeyType(t *testing.T) {
+	duration, err := parseContentKeyDuration(map[string]interface{}{})
+	if err != nil || duration != nil {
+		t.Errorf("Expected no duration, got %+v, %v", duration, err)
+	}
+
+	for _, keyType := range []string{"persisted", "persisted_limited"} {
+		_, err := parseContentKeyDuration(map[string]interface{}{"keyType": keyType, "rentalDuration": int64(3600)})
+		if !errors.Is(err, ksm.ErrContentKeyType) {
+			t.Errorf("Expected ErrContentKeyType for %s without offline, got %v", keyType, err)
+		}
+	}
+
+	duration, err = parseContentKeyDuration(map[string]interface{}{"keyType": "persisted", "offline": true})
+	if err != nil {
+		t.Fatalf("parseContentKeyDuration failed: %v", err)
+	}
+	if duration.KeyType != ksm.KeyTypePersisted {
+		t.Errorf("Expected persisted key type, got %v", duration.KeyType)
+	}
 }
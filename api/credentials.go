@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/minsoo-gold/fairplay-ksm/cryptos"
+	"github.com/minsoo-gold/fairplay-ksm/ksm"
+	"github.com/minsoo-gold/fairplay-ksm/logger"
+	"golang.org/x/sync/singleflight"
+)
+
+// 고객사 인증서(자격 증명) 하나
+// FAIRPLAY_CERTIFICATION 이 CSR 이면 인증서 해시를 알 수 없으므로 CertificateHash(SHA-1 hex) 필요
+type CustomerCredential struct {
+	Certification   string `firestore:"FAIRPLAY_CERTIFICATION" json:"FAIRPLAY_CERTIFICATION"`
+	PrivateKey      string `firestore:"FAIRPLAY_PRIVATE_KEY" json:"FAIRPLAY_PRIVATE_KEY"`
+	AppServiceKey   string `firestore:"FAIRPLAY_APPLICATION_SERVICE_KEY" json:"FAIRPLAY_APPLICATION_SERVICE_KEY"`
+	CertificateHash string `firestore:"FAIRPLAY_CERTIFICATE_HASH" json:"FAIRPLAY_CERTIFICATE_HASH"`
+}
+
+// 현재 자격 증명 + 교체 중인 이전 자격 증명
+func (keys *CustomerKeys) credentials() []CustomerCredential {
+	current := CustomerCredential{
+		Certification:   keys.Certification,
+		PrivateKey:      keys.PrivateKey,
+		AppServiceKey:   keys.AppServiceKey,
+		CertificateHash: keys.CertificateHash,
+	}
+	return append([]CustomerCredential{current}, keys.PreviousCredentials...)
+}
+
+// 자격 증명의 인증서 해시 (CSR 만 있고 FAIRPLAY_CERTIFICATE_HASH 도 없으면 nil)
+func credentialHash(c CustomerCredential) ([]byte, error) {
+	if c.CertificateHash != "" {
+		hash, err := hex.DecodeString(c.CertificateHash)
+		if err != nil || len(hash) != 20 {
+			return nil, fmt.Errorf("invalid FAIRPLAY_CERTIFICATE_HASH %q, must be a hex SHA-1", c.CertificateHash)
+		}
+		return hash, nil
+	}
+	hash, err := ksm.CertificateHash(envBase64Decode(c.Certification))
+	if err != nil {
+		// CSR 만 저장된 기존 고객사: 해시 없이 기본 자격 증명으로만 사용
+		return nil, nil
+	}
+	return hash, nil
+}
+
+// 자격 증명을 ksm.Credential 로 변환 (인증서 해시를 알 수 없으면 CertificateHash 가 nil)
+// FAIRPLAY_PRIVATE_KEY 가 비어 있으면 개인키는 키 데몬 또는 PKCS#11 토큰에 있음 (인증서 해시로 조회)
+func newCredential(ctx context.Context, c CustomerCredential) (*ksm.Credential, error) {
+	certificate := envBase64Decode(c.Certification)
+	ask, err := hex.DecodeString(c.AppServiceKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid FAIRPLAY_APPLICATION_SERVICE_KEY: %w", err)
+	}
+	hash, err := credentialHash(c)
+	if err != nil {
+		return nil, err
+	}
+
+	var pri *rsa.PrivateKey
+	var decrypter crypto.Decrypter
+	if c.PrivateKey != "" {
+		pri, err = cryptos.DecryptPriKey(envBase64Decode(c.PrivateKey), []byte("axissoft1@"))
+		if err != nil {
+			return nil, err
+		}
+		decrypter = pri
+	} else {
+		if hash == nil {
+			return nil, errors.New("FAIRPLAY_PRIVATE_KEY or the certificate hash of the remote private key required")
+		}
+		decrypter, err = remotePrivateKey(ctx, hex.EncodeToString(hash))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if c.CertificateHash == "" && hash != nil {
+		if pri != nil {
+			return ksm.NewCredential(certificate, pri, ask)
+		}
+		return ksm.NewCredentialWithDecrypter(certificate, decrypter, ask)
+	}
+
+	// CSR: 공개키만 확인
+	pub, err := cryptos.ParsePublicCertification(certificate)
+	if err != nil {
+		return nil, err
+	}
+	if !pub.Equal(decrypter.Public()) {
+		return nil, errors.New("FAIRPLAY_CERTIFICATION doesn't match the private key")
+	}
+	if pri != nil {
+		decrypter = nil
+	}
+	return &ksm.Credential{Pub: pub, Pri: pri, Decrypter: decrypter, Ask: ask, CertificateHash: hash}, nil
+}
+
+// 고객사 문서를 읽어 자격 증명 파싱 (개인키 복호화 포함, 캐시 미스일 때만 호출)
+func loadTenant(ctx context.Context, clientID string) (*ksm.Tenant, error) {
+	store, err := keyStorage()
+	if err != nil {
+		return nil, err
+	}
+	keys, err := store.Customer(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	set, _ := ksm.NewCredentialSet()
+	tenant := &ksm.Tenant{ID: clientID, Credentials: set, MaxDevices: int(keys.MaxDevices)}
+	for i, c := range keys.credentials() {
+		credential, err := newCredential(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			tenant.Credential = credential
+		}
+		if credential.CertificateHash != nil {
+			if err := set.Add(credential); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return tenant, nil
+}
+
+// 인증서 해시 -> client_id 색인 (client_id 없이 요청한 경우 고객사 판별용)
+// 저장소를 읽는 동안 잠그지 않음, 동시에 요청이 와도 한 번만 읽고 새 색인으로 교체
+type tenantIndex struct {
+	mu         sync.Mutex
+	byHash     map[string]string
+	refreshed  time.Time
+	generation uint64 // invalidate 마다 증가, 그 전에 시작한 읽기 결과는 버림
+	loads      singleflight.Group
+}
+
+var certificateTenants = &tenantIndex{}
+
+// 색인에 없는 해시가 와도 최소 이 간격으로만 저장소를 다시 읽음
+const tenantIndexRefreshInterval = time.Minute
+
+var (
+	errUnknownTenant   = errors.New("no customer has the SPC certificate")
+	errAmbiguousTenant = errors.New("several customers have the SPC certificate, client_id required")
+)
+
+// SPC 인증서 해시로 client_id 찾기
+func (idx *tenantIndex) resolve(ctx context.Context, hash []byte) (string, error) {
+	key := hex.EncodeToString(hash)
+
+	idx.mu.Lock()
+	byHash, refreshed, generation := idx.byHash, idx.refreshed, idx.generation
+	idx.mu.Unlock()
+
+	if _, ok := byHash[key]; !ok && time.Since(refreshed) >= tenantIndexRefreshInterval {
+		// 첫 요청이 취소되어도 같이 기다리는 요청은 계속 진행
+		loaded, err, _ := idx.loads.Do("", func() (interface{}, error) {
+			return loadTenantIndex(context.WithoutCancel(ctx))
+		})
+		if err != nil {
+			return "", err
+		}
+		byHash = loaded.(map[string]string)
+
+		idx.mu.Lock()
+		if idx.generation == generation {
+			idx.byHash = byHash
+			idx.refreshed = time.Now()
+		}
+		idx.mu.Unlock()
+	}
+
+	clientID, ok := byHash[key]
+	switch {
+	case !ok:
+		return "", fmt.Errorf("%w: %s", errUnknownTenant, key)
+	case clientID == "":
+		return "", fmt.Errorf("%w: %s", errAmbiguousTenant, key)
+	}
+	return clientID, nil
+}
+
+// 고객사 키가 바뀌면 다음 요청에서 색인을 다시 읽음
+func (idx *tenantIndex) invalidate() {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.byHash = nil
+	idx.refreshed = time.Time{}
+	idx.generation++
+}
+
+// 고객사 전체를 읽어 해시 색인 생성
+// 여러 고객사가 같은 인증서를 쓰면 어느 쪽인지 알 수 없으므로 client_id 를 "" 로 표시
+func loadTenantIndex(ctx context.Context) (map[string]string, error) {
+	store, err := keyStorage()
+	if err != nil {
+		return nil, err
+	}
+	customers, err := store.Customers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	byHash := make(map[string]string)
+	for clientID, keys := range customers {
+		// 해시만 필요하므로 개인키는 복호화하지 않음
+		for _, c := range keys.credentials() {
+			hash, err := credentialHash(c)
+			if err != nil {
+				logger.Warn(ctx, "invalid customer credential", "tenant", clientID, "error", err)
+				continue
+			}
+			if hash == nil {
+				continue
+			}
+			key := hex.EncodeToString(hash)
+			if other, ok := byHash[key]; ok && other != clientID {
+				logger.Warn(ctx, "certificate shared by several customers", "tenant", clientID, "certificate_hash", key)
+				byHash[key] = ""
+				continue
+			}
+			byHash[key] = clientID
+		}
+	}
+	return byHash, nil
+}
+
+// keys 의 인증서 해시 (hex), 해시를 알 수 없는 자격 증명은 제외
+func certificateHashes(keys *CustomerKeys) ([]string, error) {
+	var hashes []string
+	for _, c := range keys.credentials() {
+		hash, err := credentialHash(c)
+		if err != nil {
+			return nil, err
+		}
+		if hash != nil {
+			hashes = append(hashes, hex.EncodeToString(hash))
+		}
+	}
+	return hashes, nil
+}
+
+// keys 의 인증서를 이미 쓰고 있는 customers 의 다른 고객사 (없으면 "")
+// 저장소가 SaveCustomer 안에서 저장과 함께 원자적으로 확인
+func certificateOwner(clientID string, keys *CustomerKeys, customers map[string]*CustomerKeys) (string, error) {
+	hashes, err := certificateHashes(keys)
+	if err != nil {
+		return "", err
+	}
+	used := make(map[string]bool, len(hashes))
+	for _, hash := range hashes {
+		used[hash] = true
+	}
+
+	others := make([]string, 0, len(customers))
+	for other := range customers {
+		if other != clientID {
+			others = append(others, other)
+		}
+	}
+	sort.Strings(others)
+
+	for _, other := range others {
+		for _, c := range customers[other].credentials() {
+			hash, err := credentialHash(c)
+			if err == nil && hash != nil && used[hex.EncodeToString(hash)] {
+				return other, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// client_id 가 없으면 SPC 인증서 해시로 고객사 판별
+func resolveClientID(ctx context.Context, clientID string, playback []byte) (string, error) {
+	if clientID != "" {
+		return clientID, nil
+	}
+	hash, err := ksm.PeekCertificateHash(playback)
+	if err != nil {
+		return "", err
+	}
+	return certificateTenants.resolve(ctx, hash)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// 인증서 해시로 고객사 판별, 같은 인증서를 쓰는 고객사가 여럿이면 client_id 필요
+func TestTenantIndex(t *testing.T) {
+	ctx := context.Background()
+	store := useTestStorage(t)
+	keys := testCustomerKeys(t)
+	if err := store.SaveCustomer(ctx, "index-customer", keys); err != nil {
+		t.Fatalf("SaveCustomer failed: %v", err)
+	}
+	hash, err := credentialHash(keys.credentials()[0])
+	if err != nil {
+		t.Fatalf("credentialHash failed: %v", err)
+	}
+
+	idx := &tenantIndex{}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if clientID, err := idx.resolve(ctx, hash); err != nil || clientID != "index-customer" {
+				t.Errorf("Expected index-customer, got %q, %v", clientID, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// 모르는 해시는 새로 고침 간격 안에서 저장소를 다시 읽지 않음
+	unknown := make([]byte, 20)
+	if _, err := idx.resolve(ctx, unknown); !errors.Is(err, errUnknownTenant) {
+		t.Errorf("Expected errUnknownTenant, got %v", err)
+	}
+
+	// 저장소가 중복을 거부하기 전에 저장된 고객사
+	memory := store.(*memoryStorage)
+	memory.mu.Lock()
+	memory.customers["index-other"] = keys.clone()
+	memory.mu.Unlock()
+	if clientID, err := idx.resolve(ctx, hash); err != nil || clientID != "index-customer" {
+		t.Errorf("Expected the cached index-customer, got %q, %v", clientID, err)
+	}
+	idx.invalidate()
+	if _, err := idx.resolve(ctx, hash); !errors.Is(err, errAmbiguousTenant) {
+		t.Errorf("Expected errAmbiguousTenant, got %v", err)
+	}
+
+	byHash, err := loadTenantIndex(ctx)
+	if err != nil {
+		t.Fatalf("loadTenantIndex failed: %v", err)
+	}
+	if clientID, ok := byHash[hex.EncodeToString(hash)]; !ok || clientID != "" {
+		t.Errorf("Expected the shared certificate to be ambiguous, got %q", clientID)
+	}
+}
+
+// 저장소는 다른 고객사의 인증서를 거부
+func TestSaveCustomer_CertificateInUse(t *testing.T) {
+	ctx := context.Background()
+	store := useTestStorage(t)
+	keys := testCustomerKeys(t)
+	if err := store.SaveCustomer(ctx, "owner-customer", keys); err != nil {
+		t.Fatalf("SaveCustomer failed: %v", err)
+	}
+
+	if err := store.SaveCustomer(ctx, "owner-customer", keys); err != nil {
+		t.Errorf("Expected the owner to update its keys, got %v", err)
+	}
+	if err := store.SaveCustomer(ctx, "owner-other", keys); !errors.Is(err, errCertificateInUse) {
+		t.Errorf("Expected errCertificateInUse, got %v", err)
+	}
+
+	// 이전 자격 증명도 확인
+	rotated := testCustomerKeys(t)
+	rotated.PreviousCredentials = []CustomerCredential{keys.credentials()[0]}
+	if err := store.SaveCustomer(ctx, "owner-other", rotated); !errors.Is(err, errCertificateInUse) {
+		t.Errorf("Expected errCertificateInUse, got %v", err)
+	}
+	if _, err := store.Customer(ctx, "owner-other"); !errors.Is(err, errCustomerNotFound) {
+		t.Errorf("Expected the rejected customer not to be saved, got %v", err)
+	}
+	if err := store.SaveCustomer(ctx, "owner-other", testCustomerKeys(t)); err != nil {
+		t.Errorf("SaveCustomer failed: %v", err)
+	}
+
+	// 동시에 같은 인증서를 저장해도 한 고객사만 성공
+	shared := testCustomerKeys(t)
+	var wg sync.WaitGroup
+	errs := make([]error, 8)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = store.SaveCustomer(ctx, fmt.Sprint("concurrent-", i), shared)
+		}(i)
+	}
+	wg.Wait()
+	saved := 0
+	for _, err := range errs {
+		if err == nil {
+			saved++
+		} else if !errors.Is(err, errCertificateInUse) {
+			t.Errorf("Expected errCertificateInUse, got %v", err)
+		}
+	}
+	if saved != 1 {
+		t.Errorf("Expected one customer saved, got %d", saved)
+	}
+}
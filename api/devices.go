@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/labstack/echo/v4"
+	"github.com/minsoo-gold/fairplay-ksm/ksm"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Firestore 기반 기기 등록부
+// 경로: customer/{clientID}/users/{userID}/devices/{HU hex}
+type FirestoreDeviceRegistry struct {
+	client   *firestore.Client
+	clientID string
+}
+
+func NewFirestoreDeviceRegistry(client *firestore.Client, clientID string) *FirestoreDeviceRegistry {
+	return &FirestoreDeviceRegistry{client: client, clientID: clientID}
+}
+
+type deviceDoc struct {
+	FirstSeen time.Time `firestore:"firstSeen"`
+	LastSeen  time.Time `firestore:"lastSeen"`
+}
+
+type DeviceResult struct {
+	DeviceID  string    `json:"device_id"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+func (r *FirestoreDeviceRegistry) devices(userID string) *firestore.CollectionRef {
+	return r.client.Collection("customer").Doc(r.clientID).Collection("users").Doc(userID).Collection("devices")
+}
+
+// 새 기기는 트랜잭션 안에서 기기 수를 세어 max 초과 시 거부
+func (r *FirestoreDeviceRegistry) RegisterDevice(ctx context.Context, userID string, deviceID []byte, max int) error {
+	devices := r.devices(userID)
+	ref := devices.Doc(hex.EncodeToString(deviceID))
+
+	return r.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		now := time.Now()
+
+		_, err := tx.Get(ref)
+		if err == nil {
+			return tx.Update(ref, []firestore.Update{{Path: "lastSeen", Value: now}})
+		}
+		if status.Code(err) != codes.NotFound {
+			return err
+		}
+
+		if max > 0 {
+			docs, err := tx.Documents(devices).GetAll()
+			if err != nil {
+				return err
+			}
+			if len(docs) >= max {
+				return ksm.ErrDeviceLimit
+			}
+		}
+		return tx.Create(ref, &deviceDoc{FirstSeen: now, LastSeen: now})
+	})
+}
+
+func (r *FirestoreDeviceRegistry) Devices(ctx context.Context, userID string) ([]ksm.Device, error) {
+	docs, err := r.devices(userID).OrderBy("firstSeen", firestore.Asc).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	devices := make([]ksm.Device, 0, len(docs))
+	for _, doc := range docs {
+		id, err := hex.DecodeString(doc.Ref.ID)
+		if err != nil {
+			continue
+		}
+		var d deviceDoc
+		if err := doc.DataTo(&d); err != nil {
+			return nil, err
+		}
+		devices = append(devices, ksm.Device{ID: id, FirstSeen: d.FirstSeen, LastSeen: d.LastSeen})
+	}
+	return devices, nil
+}
+
+func (r *FirestoreDeviceRegistry) RemoveDevice(ctx context.Context, userID string, deviceID []byte) error {
+	ref := r.devices(userID).Doc(hex.EncodeToString(deviceID))
+	if _, err := ref.Get(ctx); err != nil {
+		if status.Code(err) == codes.NotFound {
+			return ksm.ErrDeviceNotFound
+		}
+		return err
+	}
+	_, err := ref.Delete(ctx)
+	return err
+}
+
+// GET /devices?client_id=...&user_id=...
+func listDevicesHandler(ctx echo.Context) error {
+	clientID, userID := ctx.QueryParam("client_id"), ctx.QueryParam("user_id")
+	if clientID == "" || userID == "" {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "client_id and user_id query params required"})
+	}
+
+	store, err := keyStorage()
+	if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	devices, err := store.Devices(clientID).Devices(ctx.Request().Context(), userID)
+	if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to list devices: %v", err)})
+	}
+
+	results := make([]DeviceResult, 0, len(devices))
+	for _, device := range devices {
+		results = append(results, DeviceResult{
+			DeviceID:  hex.EncodeToString(device.ID),
+			FirstSeen: device.FirstSeen,
+			LastSeen:  device.LastSeen,
+		})
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"user_id": userID, "devices": results})
+}
+
+// DELETE /devices/:device_id?client_id=...&user_id=...
+func removeDeviceHandler(ctx echo.Context) error {
+	clientID, userID := ctx.QueryParam("client_id"), ctx.QueryParam("user_id")
+	if clientID == "" || userID == "" {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "client_id and user_id query params required"})
+	}
+	deviceID, err := hex.DecodeString(ctx.Param("device_id"))
+	if err != nil || len(deviceID) == 0 {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "device_id must be hex"})
+	}
+
+	store, err := keyStorage()
+	if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	err = store.Devices(clientID).RemoveDevice(ctx.Request().Context(), userID, deviceID)
+	if errors.Is(err, ksm.ErrDeviceNotFound) {
+		return ctx.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to remove device: %v", err)})
+	}
+
+	return ctx.JSON(http.StatusOK, map[string]string{
+		"status":    "success",
+		"device_id": ctx.Param("device_id"),
+	})
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/minsoo-gold/fairplay-ksm/ksm"
+	"github.com/minsoo-gold/fairplay-ksm/logger"
+)
+
+// /debug/vars 로 노출되는 프로토콜 버전별 요청 수 (거부된 요청은 "_rejected" 접미사)
+var protocolVersionCounts = expvar.NewMap("fairplay_protocol_versions")
+
+type expvarMetrics struct{}
+
+func (expvarMetrics) ObserveProtocolVersion(version uint32, accepted bool) {
+	key := fmt.Sprintf("v%d", version)
+	if !accepted {
+		key += "_rejected"
+	}
+	protocolVersionCounts.Add(key, 1)
+}
+
+// /debug/vars 로 노출되는 asset 키 조회 수
+// reads: 저장소 읽기, cached: 같은 요청 안에서 재사용, not_found / disabled / errors: 실패한 읽기
+var assetLookupCounts = expvar.NewMap("fairplay_asset_lookups")
+
+// asset 키 읽기 지연 시간 분포 (le_{ms} 구간별 건수, 마지막 구간은 le_inf)
+var assetLookupLatency = expvar.NewMap("fairplay_asset_lookup_latency_ms")
+
+var assetLookupBuckets = []time.Duration{
+	5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond, time.Second,
+}
+
+func observeAssetLookup(d time.Duration, err error) {
+	assetLookupCounts.Add("reads", 1)
+	switch {
+	case err == nil:
+	case errors.Is(err, ksm.ErrAssetNotFound):
+		assetLookupCounts.Add("not_found", 1)
+	case errors.Is(err, ksm.ErrAssetDisabled):
+		assetLookupCounts.Add("disabled", 1)
+	default:
+		assetLookupCounts.Add("errors", 1)
+	}
+
+	bucket := "le_inf"
+	for _, b := range assetLookupBuckets {
+		if d <= b {
+			bucket = fmt.Sprintf("le_%d", b.Milliseconds())
+			break
+		}
+	}
+	assetLookupLatency.Add(bucket, 1)
+}
+
+func observeAssetLookupCached() {
+	assetLookupCounts.Add("cached", 1)
+}
+
+// 관리용 서버: GET /debug/vars (expvar, cmdline/memstats 포함)
+// 라이선스 포트에는 노출하지 않음. ADMIN_LISTEN (예: 127.0.0.1:9090) 이 없으면 띄우지 않음
+func startAdminServer(addr string) error {
+	if addr == "" {
+		return nil
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("invalid ADMIN_LISTEN %q: %w", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /debug/vars", expvar.Handler())
+	go func() {
+		err := http.Serve(listener, mux)
+		logger.Error(context.Background(), "admin server stopped", "error", err)
+	}()
+	logger.Info(context.Background(), "admin server listening", "address", listener.Addr().String())
+	return nil
+}
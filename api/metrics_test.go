@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"testing"
+)
+
+func TestStartAdminServer(t *testing.T) {
+	if err := startAdminServer(""); err != nil {
+		t.Fatalf("startAdminServer without address failed: %v", err)
+	}
+
+	// 빈 포트 찾기
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	if err := startAdminServer(addr); err != nil {
+		t.Fatalf("startAdminServer failed: %v", err)
+	}
+	resp, err := http.Get("http://" + addr + "/debug/vars")
+	if err != nil {
+		t.Fatalf("GET /debug/vars failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200, got %d", resp.StatusCode)
+	}
+
+	if err := startAdminServer(addr); err == nil {
+		t.Error("Expected an error for an address in use")
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/minsoo-gold/fairplay-ksm/ksm"
+)
+
+// 키 저장소: 고객사(자격 증명), asset 키, 고객사별 기기 등록부
+// 구현: Firestore(firestoreStorage), 메모리(memoryStorage), 파일(fileStorage), STORAGE 환경 변수로 선택
+type Storage interface {
+	// 고객사 키와 자격 증명 (없으면 errCustomerNotFound)
+	Customer(ctx context.Context, clientID string) (*CustomerKeys, error)
+	// 모든 고객사 (client_id -> 키), 인증서 해시 색인용
+	Customers(ctx context.Context) (map[string]*CustomerKeys, error)
+	// 다른 고객사가 쓰고 있는 인증서면 저장하지 않고 errCertificateInUse (확인과 저장은 원자적)
+	SaveCustomer(ctx context.Context, clientID string, keys *CustomerKeys) error
+
+	// asset 문서 필드 (kid, key, iv, 기간, 정책, disabled), 없으면 ksm.ErrAssetNotFound
+	Asset(ctx context.Context, assetID string) (map[string]interface{}, error)
+	SaveAsset(ctx context.Context, assetID string, asset map[string]interface{}) error
+
+	// 고객사의 기기 등록부
+	Devices(clientID string) ksm.DeviceRegistry
+
+	Close() error
+}
+
+var (
+	errCustomerNotFound = errors.New("customer not found")
+	errCertificateInUse = errors.New("certificate already used by another customer")
+)
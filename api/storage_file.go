@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/minsoo-gold/fairplay-ksm/ksm"
+)
+
+// 파일 저장소: 메모리 저장소 내용(기기 등록부 포함)을 JSON 파일 하나에 보관 (단일 인스턴스용)
+// 쓰기마다 임시 파일에 쓴 뒤 rename 으로 교체하므로 중간에 죽어도 파일이 깨지지 않음
+type fileStorage struct {
+	*memoryStorage
+	path string
+
+	writeMu sync.Mutex
+}
+
+// 파일 형식
+type storageFile struct {
+	Customers map[string]*CustomerKeys           `json:"customers"`
+	Assets    map[string]map[string]interface{}  `json:"assets"`
+	Devices   map[string]map[string][]ksm.Device `json:"devices,omitempty"` // client_id -> user_id -> 기기
+}
+
+// path 의 파일을 읽어 저장소 생성 (파일이 없으면 첫 저장 때 생성)
+func newFileStorage(path string) (*fileStorage, error) {
+	s := &fileStorage{memoryStorage: newMemoryStorage(), path: path}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file storageFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid storage file %s: %w", path, err)
+	}
+	for clientID, keys := range file.Customers {
+		s.customers[clientID] = keys
+	}
+	for assetID, asset := range file.Assets {
+		s.assets[assetID] = asset
+	}
+	for clientID, users := range file.Devices {
+		s.deviceRegistry(clientID).Restore(users)
+	}
+	return s, nil
+}
+
+func (s *fileStorage) SaveCustomer(ctx context.Context, clientID string, keys *CustomerKeys) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if err := s.memoryStorage.SaveCustomer(ctx, clientID, keys); err != nil {
+		return err
+	}
+	return s.flush()
+}
+
+func (s *fileStorage) SaveAsset(ctx context.Context, assetID string, asset map[string]interface{}) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if err := s.memoryStorage.SaveAsset(ctx, assetID, asset); err != nil {
+		return err
+	}
+	return s.flush()
+}
+
+// 기기 등록부도 변경할 때마다 파일에 기록하므로 재시작해도 기기 수 제한 유지
+func (s *fileStorage) Devices(clientID string) ksm.DeviceRegistry {
+	return &fileDeviceRegistry{MemoryDeviceRegistry: s.deviceRegistry(clientID), storage: s}
+}
+
+type fileDeviceRegistry struct {
+	*ksm.MemoryDeviceRegistry
+	storage *fileStorage
+}
+
+func (r *fileDeviceRegistry) RegisterDevice(ctx context.Context, userID string, deviceID []byte, max int) error {
+	r.storage.writeMu.Lock()
+	defer r.storage.writeMu.Unlock()
+
+	if err := r.MemoryDeviceRegistry.RegisterDevice(ctx, userID, deviceID, max); err != nil {
+		return err
+	}
+	return r.storage.flush()
+}
+
+func (r *fileDeviceRegistry) RemoveDevice(ctx context.Context, userID string, deviceID []byte) error {
+	r.storage.writeMu.Lock()
+	defer r.storage.writeMu.Unlock()
+
+	if err := r.MemoryDeviceRegistry.RemoveDevice(ctx, userID, deviceID); err != nil {
+		return err
+	}
+	return r.storage.flush()
+}
+
+// 전체 내용을 파일에 쓰기 (writeMu 잠근 상태에서 호출)
+func (s *fileStorage) flush() error {
+	s.mu.Lock()
+	file := &storageFile{Customers: s.customers, Assets: s.assets, Devices: make(map[string]map[string][]ksm.Device)}
+	for clientID, registry := range s.devices {
+		if users := registry.Users(); len(users) > 0 {
+			file.Devices[clientID] = users
+		}
+	}
+	data, err := json.MarshalIndent(file, "", "  ")
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+
+	"cloud.google.com/go/firestore"
+	"github.com/minsoo-gold/fairplay-ksm/ksm"
+	"github.com/minsoo-gold/fairplay-ksm/logger"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Firestore 저장소
+// 경로: customer/{clientID}, fairplay/{assetID}, customer/{clientID}/users/{userID}/devices/{HU hex}
+// certificate/{인증서 해시 hex}: 인증서를 쓰는 고객사 (고객사 간 인증서 중복 방지)
+type firestoreStorage struct {
+	client *firestore.Client
+}
+
+// GOOGLE_CLOUD_PROJECT 프로젝트의 Firestore 연결
+// GOOGLE_APPLICATION_CREDENTIALS 파일이 있으면 서비스 계정 키, 없으면 Cloud Run 내장 서비스 계정 사용
+func newFirestoreStorage(ctx context.Context) (*firestoreStorage, error) {
+	projectID := os.Getenv("GOOGLE_CLOUD_PROJECT")
+	// dbID := os.Getenv("FIRESTORE_DATABASE_ID")
+	var options []option.ClientOption
+	if keyPath := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); keyPath != "" {
+		if _, err := os.Stat(keyPath); err == nil {
+			options = append(options, option.WithCredentialsFile(keyPath))
+		}
+	}
+
+	client, err := firestore.NewClient(ctx, projectID, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init Firestore client: %w", err)
+	}
+	return &firestoreStorage{client: client}, nil
+}
+
+func (s *firestoreStorage) Customer(ctx context.Context, clientID string) (*CustomerKeys, error) {
+	doc, err := s.client.Collection("customer").Doc(clientID).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, fmt.Errorf("%w: %s", errCustomerNotFound, clientID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var keys CustomerKeys
+	if err := doc.DataTo(&keys); err != nil {
+		return nil, err
+	}
+	return &keys, nil
+}
+
+// 형식이 잘못된 고객사 문서는 건너뜀
+func (s *firestoreStorage) Customers(ctx context.Context) (map[string]*CustomerKeys, error) {
+	customers := make(map[string]*CustomerKeys)
+
+	docs := s.client.Collection("customer").Documents(ctx)
+	defer docs.Stop()
+	for {
+		doc, err := docs.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var keys CustomerKeys
+		if err := doc.DataTo(&keys); err != nil {
+			logger.Warn(ctx, "invalid customer keys", "tenant", doc.Ref.ID, "error", err)
+			continue
+		}
+		customers[doc.Ref.ID] = &keys
+	}
+	return customers, nil
+}
+
+type certificateDoc struct {
+	ClientID string `firestore:"clientID"`
+}
+
+// 인증서 해시 문서와 고객사 문서를 한 트랜잭션에서 확인하고 저장
+// 해시 문서가 없는 기존 고객사는 고객사 문서를 모두 읽어 확인
+func (s *firestoreStorage) SaveCustomer(ctx context.Context, clientID string, keys *CustomerKeys) error {
+	hashes, err := certificateHashes(keys)
+	if err != nil {
+		return err
+	}
+	customers, certificates := s.client.Collection("customer"), s.client.Collection("certificate")
+	refs := make([]*firestore.DocumentRef, len(hashes))
+	for i, hash := range hashes {
+		refs[i] = certificates.Doc(hash)
+	}
+
+	return s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		var docs []*firestore.DocumentSnapshot
+		if len(refs) > 0 {
+			if docs, err = tx.GetAll(refs); err != nil {
+				return err
+			}
+		}
+		for _, doc := range docs {
+			if !doc.Exists() {
+				continue
+			}
+			var certificate certificateDoc
+			if err := doc.DataTo(&certificate); err != nil {
+				return err
+			}
+			if certificate.ClientID != clientID {
+				return fmt.Errorf("%w: %s", errCertificateInUse, certificate.ClientID)
+			}
+		}
+
+		all, err := tx.Documents(customers).GetAll()
+		if err != nil {
+			return err
+		}
+		existing := make(map[string]*CustomerKeys, len(all))
+		for _, doc := range all {
+			var other CustomerKeys
+			if err := doc.DataTo(&other); err == nil {
+				existing[doc.Ref.ID] = &other
+			}
+		}
+		owner, err := certificateOwner(clientID, keys, existing)
+		if err != nil {
+			return err
+		}
+		if owner != "" {
+			return fmt.Errorf("%w: %s", errCertificateInUse, owner)
+		}
+
+		// 더 이상 쓰지 않는 인증서의 해시 문서 삭제
+		if previous, ok := existing[clientID]; ok {
+			if old, err := certificateHashes(previous); err == nil {
+				for _, hash := range old {
+					if !slices.Contains(hashes, hash) {
+						if err := tx.Delete(certificates.Doc(hash)); err != nil {
+							return err
+						}
+					}
+				}
+			}
+		}
+		for _, ref := range refs {
+			if err := tx.Set(ref, &certificateDoc{ClientID: clientID}); err != nil {
+				return err
+			}
+		}
+		return tx.Set(customers.Doc(clientID), keys)
+	})
+}
+
+func (s *firestoreStorage) Asset(ctx context.Context, assetID string) (map[string]interface{}, error) {
+	doc, err := s.client.Collection("fairplay").Doc(assetID).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, fmt.Errorf("%w: %s", ksm.ErrAssetNotFound, assetID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return doc.Data(), nil
+}
+
+func (s *firestoreStorage) SaveAsset(ctx context.Context, assetID string, asset map[string]interface{}) error {
+	_, err := s.client.Collection("fairplay").Doc(assetID).Set(ctx, asset)
+	return err
+}
+
+func (s *firestoreStorage) Devices(clientID string) ksm.DeviceRegistry {
+	return NewFirestoreDeviceRegistry(s.client, clientID)
+}
+
+func (s *firestoreStorage) Close() error {
+	return s.client.Close()
+}
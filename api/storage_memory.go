@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/minsoo-gold/fairplay-ksm/ksm"
+)
+
+// 메모리 저장소 (로컬 실행, 테스트용), 프로세스가 끝나면 사라짐
+// asset 문서는 JSON 으로 정규화해 저장하므로 파일 저장소, Firestore 와 같은 형태로 읽힘
+type memoryStorage struct {
+	mu        sync.Mutex
+	customers map[string]*CustomerKeys
+	assets    map[string]map[string]interface{}
+	devices   map[string]*ksm.MemoryDeviceRegistry
+}
+
+func newMemoryStorage() *memoryStorage {
+	return &memoryStorage{
+		customers: make(map[string]*CustomerKeys),
+		assets:    make(map[string]map[string]interface{}),
+		devices:   make(map[string]*ksm.MemoryDeviceRegistry),
+	}
+}
+
+func (s *memoryStorage) Customer(ctx context.Context, clientID string) (*CustomerKeys, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys, ok := s.customers[clientID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errCustomerNotFound, clientID)
+	}
+	return keys.clone(), nil
+}
+
+func (s *memoryStorage) Customers(ctx context.Context) (map[string]*CustomerKeys, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	customers := make(map[string]*CustomerKeys, len(s.customers))
+	for clientID, keys := range s.customers {
+		customers[clientID] = keys.clone()
+	}
+	return customers, nil
+}
+
+func (s *memoryStorage) SaveCustomer(ctx context.Context, clientID string, keys *CustomerKeys) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	owner, err := certificateOwner(clientID, keys, s.customers)
+	if err != nil {
+		return err
+	}
+	if owner != "" {
+		return fmt.Errorf("%w: %s", errCertificateInUse, owner)
+	}
+	s.customers[clientID] = keys.clone()
+	return nil
+}
+
+func (s *memoryStorage) Asset(ctx context.Context, assetID string) (map[string]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	asset, ok := s.assets[assetID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ksm.ErrAssetNotFound, assetID)
+	}
+	// 호출한 쪽이 수정해도 저장된 값은 그대로
+	return normalizeDocument(asset)
+}
+
+func (s *memoryStorage) SaveAsset(ctx context.Context, assetID string, asset map[string]interface{}) error {
+	doc, err := normalizeDocument(asset)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.assets[assetID] = doc
+	return nil
+}
+
+// 메모리 저장소의 기기는 프로세스가 끝나면 사라지므로 기기 수 제한도 프로세스가 살아 있는 동안만 유효
+func (s *memoryStorage) Devices(clientID string) ksm.DeviceRegistry {
+	return s.deviceRegistry(clientID)
+}
+
+func (s *memoryStorage) deviceRegistry(clientID string) *ksm.MemoryDeviceRegistry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	registry, ok := s.devices[clientID]
+	if !ok {
+		registry = ksm.NewMemoryDeviceRegistry()
+		s.devices[clientID] = registry
+	}
+	return registry
+}
+
+func (s *memoryStorage) Close() error {
+	return nil
+}
+
+// 고객사 키 복사 (이전 자격 증명 슬라이스 포함)
+func (keys *CustomerKeys) clone() *CustomerKeys {
+	c := *keys
+	c.PreviousCredentials = append([]CustomerCredential(nil), keys.PreviousCredentials...)
+	return &c
+}
+
+// JSON 왕복으로 문서 복사 및 정규화 (숫자는 float64, 배열은 []interface{})
+func normalizeDocument(doc map[string]interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var normalized map[string]interface{}
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/minsoo-gold/fairplay-ksm/ksm"
+)
+
+// 테스트는 클라우드 프로젝트 없이 메모리 저장소로 실행
+func TestMain(m *testing.M) {
+	os.Setenv("STORAGE", "memory")
+	os.Exit(m.Run())
+}
+
+// 테스트마다 새 메모리 저장소, 자격 증명 캐시, 인증서 색인 사용
+// 전역 값은 테스트가 끝나면 초기화하므로 테스트 실행 순서와 무관
+func useTestStorage(t *testing.T) Storage {
+	t.Helper()
+
+	reset := func() {
+		storageOnce, storageImpl, storageErr = sync.Once{}, nil, nil
+		credentialCacheOnce, credentialCacheImpl, credentialCacheErr = sync.Once{}, nil, nil
+		certificateTenants = &tenantIndex{}
+	}
+	reset()
+	t.Cleanup(reset)
+
+	store, err := keyStorage()
+	if err != nil {
+		t.Fatalf("keyStorage failed: %v", err)
+	}
+	return store
+}
+
+// 테스트용 고객사 키 (자체 서명 인증서, 암호화하지 않은 개인키)
+func testCustomerKeys(t *testing.T) *CustomerKeys {
+	pri, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "fairplay test"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &pri.PublicKey, pri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	privateKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(pri)})
+	return &CustomerKeys{
+		Certification: base64.StdEncoding.EncodeToString(certificate),
+		PrivateKey:    base64.StdEncoding.EncodeToString(privateKey),
+		AppServiceKey: "2c6b3114ca8831cb01fb26a0646f96e8",
+		MaxDevices:    2,
+	}
+}
+
+func TestFileStorage(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "keys.json")
+
+	store, err := newFileStorage(path)
+	if err != nil {
+		t.Fatalf("newFileStorage failed: %v", err)
+	}
+	keys := testCustomerKeys(t)
+	if err := store.SaveCustomer(ctx, "customer", keys); err != nil {
+		t.Fatalf("SaveCustomer failed: %v", err)
+	}
+	if err := store.SaveAsset(ctx, "asset", map[string]interface{}{"key": "00112233445566778899aabbccddeeff", "leaseDuration": int64(60)}); err != nil {
+		t.Fatalf("SaveAsset failed: %v", err)
+	}
+
+	// 다시 열어도 그대로
+	reopened, err := newFileStorage(path)
+	if err != nil {
+		t.Fatalf("newFileStorage failed: %v", err)
+	}
+	customer, err := reopened.Customer(ctx, "customer")
+	if err != nil {
+		t.Fatalf("Customer failed: %v", err)
+	}
+	if customer.Certification != keys.Certification || customer.PrivateKey != keys.PrivateKey || customer.MaxDevices != 2 {
+		t.Errorf("Expected %+v, got %+v", keys, customer)
+	}
+	asset, err := reopened.Asset(ctx, "asset")
+	if err != nil {
+		t.Fatalf("Asset failed: %v", err)
+	}
+	if lease, _ := toUint32(asset["leaseDuration"]); lease != 60 {
+		t.Errorf("Expected lease duration 60, got %v", asset["leaseDuration"])
+	}
+
+	if _, err := reopened.Customer(ctx, "other"); !errors.Is(err, errCustomerNotFound) {
+		t.Errorf("Expected errCustomerNotFound, got %v", err)
+	}
+	if _, err := reopened.Asset(ctx, "other"); !errors.Is(err, ksm.ErrAssetNotFound) {
+		t.Errorf("Expected ErrAssetNotFound, got %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newFileStorage(path); err == nil {
+		t.Error("Expected an error for a corrupted storage file")
+	}
+}
+
+// 파일 저장소의 기기는 재시작해도 기기 수 제한에 포함
+func TestFileStorage_Devices(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "keys.json")
+
+	store, err := newFileStorage(path)
+	if err != nil {
+		t.Fatalf("newFileStorage failed: %v", err)
+	}
+	for _, device := range []string{"device-1", "device-2", "device-3"} {
+		if err := store.Devices("customer").RegisterDevice(ctx, "user", []byte(device), 0); err != nil {
+			t.Fatalf("RegisterDevice failed: %v", err)
+		}
+	}
+	if err := store.Devices("customer").RemoveDevice(ctx, "user", []byte("device-3")); err != nil {
+		t.Fatalf("RemoveDevice failed: %v", err)
+	}
+
+	reopened, err := newFileStorage(path)
+	if err != nil {
+		t.Fatalf("newFileStorage failed: %v", err)
+	}
+	devices, err := reopened.Devices("customer").Devices(ctx, "user")
+	if err != nil {
+		t.Fatalf("Devices failed: %v", err)
+	}
+	if len(devices) != 2 || string(devices[0].ID) != "device-1" || string(devices[1].ID) != "device-2" {
+		t.Errorf("Expected device-1 and device-2, got %+v", devices)
+	}
+	if err := reopened.Devices("customer").RegisterDevice(ctx, "user", []byte("device-3"), 2); !errors.Is(err, ksm.ErrDeviceLimit) {
+		t.Errorf("Expected ErrDeviceLimit, got %v", err)
+	}
+	if err := reopened.Devices("other").RegisterDevice(ctx, "user", []byte("device-3"), 2); err != nil {
+		t.Errorf("Expected the limit per customer, got %v", err)
+	}
+}
+
+// 저장소에 저장한 고객사를 client_id 와 인증서 해시로 찾기
+func TestLoadTenant(t *testing.T) {
+	ctx := context.Background()
+	store, err := keyStorage()
+	if err != nil {
+		t.Fatalf("keyStorage failed: %v", err)
+	}
+	keys := testCustomerKeys(t)
+	if err := store.SaveCustomer(ctx, "customer", keys); err != nil {
+		t.Fatalf("SaveCustomer failed: %v", err)
+	}
+
+	tenant, err := loadTenant(ctx, "customer")
+	if err != nil {
+		t.Fatalf("loadTenant failed: %v", err)
+	}
+	if tenant.MaxDevices != 2 || tenant.Credential == nil || tenant.Credential.Pri == nil {
+		t.Fatalf("Unexpected tenant %+v", tenant)
+	}
+
+	byHash, err := loadTenantIndex(ctx)
+	if err != nil {
+		t.Fatalf("loadTenantIndex failed: %v", err)
+	}
+	if clientID := byHash[hex.EncodeToString(tenant.Credential.CertificateHash)]; clientID != "customer" {
+		t.Errorf("Expected customer, got %q", clientID)
+	}
+
+	if _, err := loadTenant(ctx, "other"); !errors.Is(err, errCustomerNotFound) {
+		t.Errorf("Expected errCustomerNotFound, got %v", err)
+	}
+}
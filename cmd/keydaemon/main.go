@@ -0,0 +1,121 @@
+//go:build unix
+
+// Command keydaemon serves the RSA-OAEP decryption of FairPlay private keys over gRPC, so the KSM
+// doesn't hold them. Each key is served under the hex SHA-1 hash of its application certificate:
+//
+//	KEYDAEMON_PASSPHRASE=... keydaemon -listen unix:///run/keydaemon.sock -key fairplay.cer,privatekey.pem
+//
+// The daemon has no authentication, so it only listens on a unix socket, created with mode 0600.
+// Run it as the user of the KSM, or change the owner of the socket to that user.
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/minsoo-gold/fairplay-ksm/cryptos"
+	"github.com/minsoo-gold/fairplay-ksm/keydaemon"
+	"github.com/minsoo-gold/fairplay-ksm/ksm"
+	"github.com/minsoo-gold/fairplay-ksm/logger"
+	"google.golang.org/grpc"
+)
+
+type keyFlags []string
+
+func (k *keyFlags) String() string {
+	return strings.Join(*k, " ")
+}
+
+func (k *keyFlags) Set(value string) error {
+	*k = append(*k, value)
+	return nil
+}
+
+func main() {
+	listen := flag.String("listen", "unix:///run/keydaemon.sock", "the unix socket to listen on, unix://<path>")
+	var keys keyFlags
+	flag.Var(&keys, "key", "an application certificate and its PEM private key, as <certificate>,<private key>; repeatable")
+	flag.Parse()
+
+	ctx := context.Background()
+	if err := run(ctx, *listen, keys, []byte(os.Getenv("KEYDAEMON_PASSPHRASE"))); err != nil {
+		logger.Error(ctx, "key daemon stopped", "error", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, listen string, keys []string, passphrase []byte) error {
+	s := keydaemon.NewServer()
+	for _, key := range keys {
+		certificatePath, keyPath, ok := strings.Cut(key, ",")
+		if !ok {
+			return fmt.Errorf("invalid -key %q, must be <certificate>,<private key>", key)
+		}
+		credential, err := loadCredential(certificatePath, keyPath, passphrase)
+		if err != nil {
+			return err
+		}
+		id := hex.EncodeToString(credential.CertificateHash)
+		if err := s.AddKey(id, credential.Pri); err != nil {
+			return err
+		}
+		logger.Info(ctx, "serving key", "key_id", id, "certificate", certificatePath)
+	}
+
+	path, ok := strings.CutPrefix(listen, "unix://")
+	if !ok {
+		return fmt.Errorf("invalid -listen %q, must be unix://<path>: the key daemon has no authentication", listen)
+	}
+	listener, err := listenUnix(path)
+	if err != nil {
+		return err
+	}
+
+	g := grpc.NewServer()
+	s.Register(g)
+	logger.Info(ctx, "key daemon listening", "address", listen)
+	return g.Serve(listener)
+}
+
+// listenUnix listens on a new socket at path, accessible by the user of the daemon only.
+// A socket left at path by a stopped daemon is replaced, anything else is an error.
+func listenUnix(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode().Type() != os.ModeSocket {
+			return nil, fmt.Errorf("%s already exists and isn't a socket", path)
+		}
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is used by a running daemon", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	umask := syscall.Umask(0o177)
+	defer syscall.Umask(umask)
+	return net.Listen("unix", path)
+}
+
+func loadCredential(certificatePath, keyPath string, passphrase []byte) (*ksm.Credential, error) {
+	certificate, err := os.ReadFile(certificatePath)
+	if err != nil {
+		return nil, err
+	}
+	pem, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	pri, err := cryptos.DecryptPriKey(pem, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", keyPath, err)
+	}
+	return ksm.NewCredential(certificate, pri, nil)
+}
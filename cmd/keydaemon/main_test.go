@@ -0,0 +1,44 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListenUnix(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "keydaemon.sock")
+	listener, err := listenUnix(path)
+	assert.NoError(err)
+	info, err := os.Stat(path)
+	assert.NoError(err)
+	assert.Equal(os.FileMode(0o600), info.Mode().Perm())
+
+	_, err = listenUnix(path)
+	assert.ErrorContains(err, "running daemon")
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	listener.Close()
+
+	// A socket left by a stopped daemon is replaced.
+	listener, err = listenUnix(path)
+	assert.NoError(err)
+	listener.Close()
+
+	file := filepath.Join(dir, "keys.pem")
+	assert.NoError(os.WriteFile(file, []byte("keep"), 0o600))
+	_, err = listenUnix(file)
+	assert.ErrorContains(err, "isn't a socket")
+	data, _ := os.ReadFile(file)
+	assert.Equal("keep", string(data))
+
+	assert.ErrorContains(run(context.Background(), "localhost:7000", nil, nil), "must be unix://")
+}
@@ -5,18 +5,13 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"fmt"
-
-	"github.com/minsoo-gold/fairplay-ksm/logger"
 )
 
+// pkcs5Padding returns a padded copy of ciphertext, appending in place would overwrite the memory after the caller's slice.
 func pkcs5Padding(ciphertext []byte, blockSize int) []byte {
 	padding := blockSize - len(ciphertext)%blockSize
 	padtext := bytes.Repeat([]byte{byte(padding)}, padding)
-	return append(ciphertext, padtext...)
-}
-
-func pkcs5UnPadding(origData []byte) []byte {
-	return origData[:(len(origData) - int(origData[len(origData)-1]))]
+	return append(ciphertext[:len(ciphertext):len(ciphertext)], padtext...)
 }
 
 // AESCBCEncrypt is given key, iv to encrypt the plainText in AES CBC way.
@@ -25,6 +20,9 @@ func AESCBCEncrypt(key, iv, plainText []byte) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	if len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("iv length %d, must be %d", len(iv), aes.BlockSize)
+	}
 
 	mode := cipher.NewCBCEncrypter(block, iv)
 	if len(plainText)%aes.BlockSize != 0 {
@@ -43,24 +41,26 @@ func AESCBCDecrypt(key, iv, cipherText []byte) ([]byte, error) {
 		return nil, fmt.Errorf("ciphertext can't be plain")
 	}
 
+	if len(cipherText)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("ciphertext length %d is not a multiple of the block size", len(cipherText))
+	}
+
 	block, err := aes.NewCipher(key)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	if len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("iv length %d, must be %d", len(iv), aes.BlockSize)
 	}
 
 	mode := cipher.NewCBCDecrypter(block, iv)
 	plainText := make([]byte, len(cipherText))
 	mode.CryptBlocks(plainText, cipherText)
-	logger.Println("AES-CBC Decrpypt: PlainText Length:", len(plainText))
-	if len(cipherText)%aes.BlockSize == 0 {
-		return plainText, nil
-	}
-	return pkcs5UnPadding(plainText), nil
+	return plainText, nil
 }
 
 // AESECBEncrypt is given key to encrypt the plainText in AES ECB way.
 func AESECBEncrypt(key, plainText []byte) ([]byte, error) {
-	logger.Println("AES-ECB Encrpypt: PlainText Length:", len(plainText))
 	if len(plainText)%aes.BlockSize != 0 {
 		return nil, fmt.Errorf("need a multiple of the blocksize")
 	}
@@ -81,7 +81,6 @@ func AESECBEncrypt(key, plainText []byte) ([]byte, error) {
 
 // AESECBDecrypt is given key to decrypt the cipherText in AES ECB way.
 func AESECBDecrypt(key, cipherText []byte) ([]byte, error) {
-	logger.Println("AES-ECB: cipherText Length:", len(cipherText))
 	if len(cipherText)%aes.BlockSize != 0 {
 		return nil, fmt.Errorf("input not full blocks")
 	}
@@ -24,3 +24,30 @@ func TestCBCEncryptAndDecrypt(t *testing.T) {
 	assert.NoError(err)
 	assert.Equal([]byte(plainText), decryptedPlainText)
 }
+
+func TestAESCBCDecrypt_Malformed(t *testing.T) {
+	assert := assert.New(t)
+
+	key := make([]byte, 16)
+	iv := make([]byte, 16)
+
+	// Each of these used to panic.
+	_, err := AESCBCDecrypt(make([]byte, 15), iv, make([]byte, 16))
+	assert.Error(err)
+	_, err = AESCBCDecrypt(key, iv[:8], make([]byte, 16))
+	assert.Error(err)
+	_, err = AESCBCDecrypt(key, iv, make([]byte, 17))
+	assert.Error(err)
+	_, err = AESCBCEncrypt(key, iv[:8], make([]byte, 16))
+	assert.Error(err)
+}
+
+func TestAESCBCEncrypt_DoesNotModifyInput(t *testing.T) {
+	key := make([]byte, 16)
+	buffer := []byte("plain text followed by other data")
+	plainText := buffer[:10]
+
+	_, err := AESCBCEncrypt(key, key, plainText)
+	assert.NoError(t, err)
+	assert.Equal(t, "plain text followed by other data", string(buffer))
+}
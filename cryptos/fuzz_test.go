@@ -0,0 +1,61 @@
+package cryptos
+
+import (
+	"bytes"
+	"testing"
+)
+
+// The AES helpers take keys, IVs and ciphertexts from SPC and CKC messages, so no input may panic.
+
+func FuzzAESCBCDecrypt(f *testing.F) {
+	f.Add(make([]byte, 16), make([]byte, 16), make([]byte, 32))
+	f.Add(make([]byte, 32), make([]byte, 16), make([]byte, 17))
+	f.Add(make([]byte, 15), make([]byte, 8), []byte{})
+
+	f.Fuzz(func(t *testing.T, key, iv, cipherText []byte) {
+		AESCBCDecrypt(key, iv, cipherText)
+	})
+}
+
+func FuzzAESCBCRoundTrip(f *testing.F) {
+	f.Add(make([]byte, 16), make([]byte, 16), []byte("change this pass"))
+
+	f.Fuzz(func(t *testing.T, key, iv, plainText []byte) {
+		cipherText, err := AESCBCEncrypt(key, iv, plainText)
+		if err != nil {
+			return
+		}
+		if len(plainText)%16 != 0 {
+			// AESCBCEncrypt pads partial blocks, AESCBCDecrypt doesn't remove the padding.
+			plainText = pkcs5Padding(plainText, 16)
+		}
+		if len(plainText) == 0 {
+			return
+		}
+		decrypted, err := AESCBCDecrypt(key, iv, cipherText)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decrypted, plainText) {
+			t.Fatalf("got %x, want %x", decrypted, plainText)
+		}
+	})
+}
+
+func FuzzAESECB(f *testing.F) {
+	f.Add(make([]byte, 16), make([]byte, 16))
+
+	f.Fuzz(func(t *testing.T, key, text []byte) {
+		cipherText, err := AESECBEncrypt(key, text)
+		if err != nil {
+			return
+		}
+		plainText, err := AESECBDecrypt(key, cipherText)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(plainText, text) {
+			t.Fatalf("got %x, want %x", plainText, text)
+		}
+	})
+}
@@ -2,12 +2,11 @@ package cryptos
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha1"
 	"fmt"
-
-	"github.com/minsoo-gold/fairplay-ksm/logger"
 )
 
 func OAEPDecrypt(pub *rsa.PublicKey, pri *rsa.PrivateKey, cipherText []byte) ([]byte, error) {
@@ -26,9 +25,27 @@ func OAEPDecrypt(pub *rsa.PublicKey, pri *rsa.PrivateKey, cipherText []byte) ([]
 	return buffer.Bytes(), nil
 }
 
+// OAEPDecryptWith decrypts one RSA-OAEP SHA-1 block with d. Unlike OAEPDecrypt, the private key
+// doesn't have to be in memory: d can be a PKCS11Decrypter or a key daemon client.
+func OAEPDecryptWith(d crypto.Decrypter, cipherText []byte) ([]byte, error) {
+	if len(cipherText) == 0 {
+		return nil, fmt.Errorf("cipherText can not be empty string")
+	}
+	return d.Decrypt(rand.Reader, cipherText, &rsa.OAEPOptions{Hash: crypto.SHA1})
+}
+
+// CheckOAEPSHA1 returns an error unless opts are RSA-OAEP SHA-1 options without label,
+// the only scheme the decrypters of keys kept outside the process support.
+func CheckOAEPSHA1(opts crypto.DecrypterOpts) error {
+	oaep, ok := opts.(*rsa.OAEPOptions)
+	if !ok || oaep.Hash != crypto.SHA1 || (oaep.MGFHash != 0 && oaep.MGFHash != crypto.SHA1) || len(oaep.Label) > 0 {
+		return fmt.Errorf("unsupported decrypter options %+v, only RSA-OAEP SHA-1 without label", opts)
+	}
+	return nil
+}
+
 func grouping(src []byte, size int) [][]byte {
 	var groups [][]byte
-	logger.Println(size)
 	srcSize := len(src)
 	if srcSize <= size {
 		groups = append(groups, src)
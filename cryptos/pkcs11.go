@@ -0,0 +1,276 @@
+//go:build cgo && pkcs11
+
+package cryptos
+
+/*
+#cgo CFLAGS: -I/usr/include/p11-kit-1
+#cgo LDFLAGS: -ldl
+#include <dlfcn.h>
+#include <stdlib.h>
+#include <string.h>
+#include <p11-kit/pkcs11.h>
+
+static CK_RV p11_get_function_list(void *fn, CK_FUNCTION_LIST_PTR *list) {
+	return ((CK_C_GetFunctionList)fn)(list);
+}
+
+static CK_RV p11_initialize(CK_FUNCTION_LIST_PTR p) {
+	CK_C_INITIALIZE_ARGS args;
+	memset(&args, 0, sizeof(args));
+	args.flags = CKF_OS_LOCKING_OK;
+	return p->C_Initialize(&args);
+}
+
+static CK_RV p11_finalize(CK_FUNCTION_LIST_PTR p) {
+	return p->C_Finalize(NULL);
+}
+
+// p11_find_slot finds the slot of the token labeled label, padded with spaces to 32 bytes.
+static CK_RV p11_find_slot(CK_FUNCTION_LIST_PTR p, const unsigned char *label, CK_SLOT_ID *slot) {
+	CK_ULONG n = 0;
+	CK_RV rv = p->C_GetSlotList(CK_TRUE, NULL, &n);
+	if (rv != CKR_OK) {
+		return rv;
+	}
+	CK_SLOT_ID *slots = calloc(n ? n : 1, sizeof(CK_SLOT_ID));
+	rv = p->C_GetSlotList(CK_TRUE, slots, &n);
+	for (CK_ULONG i = 0; rv == CKR_OK && i < n; i++) {
+		CK_TOKEN_INFO info;
+		if (p->C_GetTokenInfo(slots[i], &info) == CKR_OK && memcmp(info.label, label, 32) == 0) {
+			*slot = slots[i];
+			free(slots);
+			return CKR_OK;
+		}
+	}
+	free(slots);
+	return rv == CKR_OK ? CKR_TOKEN_NOT_PRESENT : rv;
+}
+
+static CK_RV p11_open_session(CK_FUNCTION_LIST_PTR p, CK_SLOT_ID slot, unsigned char *pin, CK_ULONG pin_len, CK_SESSION_HANDLE *session) {
+	CK_RV rv = p->C_OpenSession(slot, CKF_SERIAL_SESSION, NULL, NULL, session);
+	if (rv != CKR_OK) {
+		return rv;
+	}
+	rv = p->C_Login(*session, CKU_USER, pin, pin_len);
+	if (rv != CKR_OK && rv != CKR_USER_ALREADY_LOGGED_IN) {
+		p->C_CloseSession(*session);
+		return rv;
+	}
+	return CKR_OK;
+}
+
+static CK_RV p11_close_session(CK_FUNCTION_LIST_PTR p, CK_SESSION_HANDLE session) {
+	return p->C_CloseSession(session);
+}
+
+// p11_find_key finds the private key labeled label.
+static CK_RV p11_find_key(CK_FUNCTION_LIST_PTR p, CK_SESSION_HANDLE session, unsigned char *label, CK_ULONG label_len, CK_OBJECT_HANDLE *key) {
+	CK_OBJECT_CLASS class = CKO_PRIVATE_KEY;
+	CK_ATTRIBUTE match[] = {
+		{CKA_CLASS, &class, sizeof(class)},
+		{CKA_LABEL, label, label_len},
+	};
+	CK_RV rv = p->C_FindObjectsInit(session, match, 2);
+	if (rv != CKR_OK) {
+		return rv;
+	}
+	CK_ULONG found = 0;
+	rv = p->C_FindObjects(session, key, 1, &found);
+	p->C_FindObjectsFinal(session);
+	if (rv == CKR_OK && found == 0) {
+		return CKR_KEY_HANDLE_INVALID;
+	}
+	return rv;
+}
+
+// p11_get_attribute reads an attribute of key, its length first if buf is NULL.
+static CK_RV p11_get_attribute(CK_FUNCTION_LIST_PTR p, CK_SESSION_HANDLE session, CK_OBJECT_HANDLE key, CK_ATTRIBUTE_TYPE type, void *buf, CK_ULONG *len) {
+	CK_ATTRIBUTE attribute = {type, buf, *len};
+	CK_RV rv = p->C_GetAttributeValue(session, key, &attribute, 1);
+	*len = attribute.ulValueLen;
+	return rv;
+}
+
+static CK_RV p11_decrypt_oaep(CK_FUNCTION_LIST_PTR p, CK_SESSION_HANDLE session, CK_OBJECT_HANDLE key, unsigned char *in, CK_ULONG in_len, unsigned char *out, CK_ULONG *out_len) {
+	CK_RSA_PKCS_OAEP_PARAMS oaep = {CKM_SHA_1, CKG_MGF1_SHA1, CKZ_DATA_SPECIFIED, NULL, 0};
+	CK_MECHANISM mechanism = {CKM_RSA_PKCS_OAEP, &oaep, sizeof(oaep)};
+	CK_RV rv = p->C_DecryptInit(session, &mechanism, key);
+	if (rv != CKR_OK) {
+		return rv;
+	}
+	return p->C_Decrypt(session, in, in_len, out, out_len);
+}
+*/
+import "C"
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"sync"
+	"unsafe"
+)
+
+// PKCS11Module is a PKCS#11 module, such as the library of an HSM, loaded with dlopen.
+type PKCS11Module struct {
+	handle unsafe.Pointer
+	list   C.CK_FUNCTION_LIST_PTR
+}
+
+// OpenPKCS11Module loads and initializes the PKCS#11 module at path.
+func OpenPKCS11Module(path string) (*PKCS11Module, error) {
+	cPath := C.CString(path)
+	defer C.free(unsafe.Pointer(cPath))
+	handle := C.dlopen(cPath, C.RTLD_NOW|C.RTLD_LOCAL)
+	if handle == nil {
+		return nil, fmt.Errorf("dlopen %s: %s", path, C.GoString(C.dlerror()))
+	}
+
+	cSymbol := C.CString("C_GetFunctionList")
+	defer C.free(unsafe.Pointer(cSymbol))
+	fn := C.dlsym(handle, cSymbol)
+	if fn == nil {
+		C.dlclose(handle)
+		return nil, fmt.Errorf("%s is not a PKCS#11 module: no C_GetFunctionList", path)
+	}
+
+	m := &PKCS11Module{handle: handle}
+	if err := pkcs11Error("C_GetFunctionList", C.p11_get_function_list(fn, &m.list)); err != nil {
+		C.dlclose(handle)
+		return nil, err
+	}
+	if rv := C.p11_initialize(m.list); rv != C.CKR_OK && rv != C.CKR_CRYPTOKI_ALREADY_INITIALIZED {
+		C.dlclose(handle)
+		return nil, pkcs11Error("C_Initialize", rv)
+	}
+	return m, nil
+}
+
+// Close finalizes and unloads the module. The decrypters of the module must be closed first.
+func (m *PKCS11Module) Close() error {
+	err := pkcs11Error("C_Finalize", C.p11_finalize(m.list))
+	C.dlclose(m.handle)
+	return err
+}
+
+// Decrypter logs in the token labeled token with pin, and returns the decrypter of its RSA private key labeled key.
+// The key must allow CKM_RSA_PKCS_OAEP decryption, and its modulus and public exponent must be readable.
+func (m *PKCS11Module) Decrypter(token, pin, key string) (*PKCS11Decrypter, error) {
+	if len(token) > 32 {
+		return nil, fmt.Errorf("pkcs11: token label %q is longer than 32 bytes", token)
+	}
+	label := C.CString(token + strings.Repeat(" ", 32-len(token)))
+	defer C.free(unsafe.Pointer(label))
+
+	var slot C.CK_SLOT_ID
+	if err := pkcs11Error("C_GetSlotList", C.p11_find_slot(m.list, (*C.uchar)(unsafe.Pointer(label)), &slot)); err != nil {
+		return nil, fmt.Errorf("%w (token %q)", err, token)
+	}
+
+	d := &PKCS11Decrypter{module: m}
+	cPin := C.CBytes([]byte(pin))
+	defer C.free(cPin)
+	if err := pkcs11Error("C_OpenSession", C.p11_open_session(m.list, slot, (*C.uchar)(cPin), C.CK_ULONG(len(pin)), &d.session)); err != nil {
+		return nil, err
+	}
+
+	cKey := C.CBytes([]byte(key))
+	defer C.free(cKey)
+	if err := pkcs11Error("C_FindObjects", C.p11_find_key(m.list, d.session, (*C.uchar)(cKey), C.CK_ULONG(len(key)), &d.key)); err != nil {
+		d.Close()
+		return nil, fmt.Errorf("%w (key %q)", err, key)
+	}
+
+	modulus, err := d.attribute(C.CKA_MODULUS)
+	if err != nil {
+		d.Close()
+		return nil, err
+	}
+	exponent, err := d.attribute(C.CKA_PUBLIC_EXPONENT)
+	if err != nil {
+		d.Close()
+		return nil, err
+	}
+	d.pub = &rsa.PublicKey{N: new(big.Int).SetBytes(modulus), E: int(new(big.Int).SetBytes(exponent).Int64())}
+	return d, nil
+}
+
+// PKCS11Decrypter is a crypto.Decrypter of an RSA private key kept in a PKCS#11 token.
+// It only decrypts RSA-OAEP SHA-1, the scheme of SPCK. It is safe for concurrent use.
+type PKCS11Decrypter struct {
+	module *PKCS11Module
+	pub    *rsa.PublicKey
+
+	mu      sync.Mutex // A session runs one operation at a time.
+	session C.CK_SESSION_HANDLE
+	key     C.CK_OBJECT_HANDLE
+	closed  bool
+}
+
+// Public implements crypto.Decrypter.
+func (d *PKCS11Decrypter) Public() crypto.PublicKey {
+	return d.pub
+}
+
+// Decrypt implements crypto.Decrypter. opts must be *rsa.OAEPOptions with SHA-1 and no label.
+func (d *PKCS11Decrypter) Decrypt(rand io.Reader, ciphertext []byte, opts crypto.DecrypterOpts) ([]byte, error) {
+	if err := CheckOAEPSHA1(opts); err != nil {
+		return nil, err
+	}
+	if len(ciphertext) == 0 {
+		return nil, errors.New("pkcs11: empty ciphertext")
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return nil, errors.New("pkcs11: decrypter closed")
+	}
+
+	in := C.CBytes(ciphertext)
+	defer C.free(in)
+	out := make([]byte, d.pub.Size())
+	outLen := C.CK_ULONG(len(out))
+	rv := C.p11_decrypt_oaep(d.module.list, d.session, d.key, (*C.uchar)(in), C.CK_ULONG(len(ciphertext)), (*C.uchar)(unsafe.Pointer(&out[0])), &outLen)
+	if err := pkcs11Error("C_Decrypt", rv); err != nil {
+		return nil, err
+	}
+	return out[:outLen], nil
+}
+
+// Close closes the session of the decrypter.
+func (d *PKCS11Decrypter) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return nil
+	}
+	d.closed = true
+	return pkcs11Error("C_CloseSession", C.p11_close_session(d.module.list, d.session))
+}
+
+func (d *PKCS11Decrypter) attribute(attribute C.CK_ATTRIBUTE_TYPE) ([]byte, error) {
+	var n C.CK_ULONG
+	if err := pkcs11Error("C_GetAttributeValue", C.p11_get_attribute(d.module.list, d.session, d.key, attribute, nil, &n)); err != nil {
+		return nil, err
+	}
+	if n == 0 || n > 1024 {
+		return nil, fmt.Errorf("pkcs11: unexpected attribute length %d", n)
+	}
+	value := make([]byte, n)
+	if err := pkcs11Error("C_GetAttributeValue", C.p11_get_attribute(d.module.list, d.session, d.key, attribute, unsafe.Pointer(&value[0]), &n)); err != nil {
+		return nil, err
+	}
+	return value[:n], nil
+}
+
+func pkcs11Error(function string, rv C.CK_RV) error {
+	if rv == C.CKR_OK {
+		return nil
+	}
+	return fmt.Errorf("pkcs11: %s: CKR 0x%x", function, uint64(rv))
+}
@@ -0,0 +1,49 @@
+//go:build !cgo || !pkcs11
+
+package cryptos
+
+import (
+	"crypto"
+	"errors"
+	"io"
+)
+
+var errNoPKCS11 = errors.New("pkcs11 requires a cgo build with the pkcs11 build tag")
+
+// PKCS11Module is a PKCS#11 module, such as the library of an HSM.
+// It is only available in cgo builds with the pkcs11 build tag.
+type PKCS11Module struct{}
+
+// OpenPKCS11Module returns an error, build with cgo and the pkcs11 build tag to load PKCS#11 modules.
+func OpenPKCS11Module(path string) (*PKCS11Module, error) {
+	return nil, errNoPKCS11
+}
+
+// Close implements io.Closer.
+func (m *PKCS11Module) Close() error {
+	return nil
+}
+
+// Decrypter returns an error, build with cgo and the pkcs11 build tag to load PKCS#11 modules.
+func (m *PKCS11Module) Decrypter(token, pin, key string) (*PKCS11Decrypter, error) {
+	return nil, errNoPKCS11
+}
+
+// PKCS11Decrypter is a crypto.Decrypter of an RSA private key kept in a PKCS#11 token.
+// It is only available in cgo builds with the pkcs11 build tag.
+type PKCS11Decrypter struct{}
+
+// Public implements crypto.Decrypter.
+func (d *PKCS11Decrypter) Public() crypto.PublicKey {
+	return nil
+}
+
+// Decrypt implements crypto.Decrypter.
+func (d *PKCS11Decrypter) Decrypt(rand io.Reader, ciphertext []byte, opts crypto.DecrypterOpts) ([]byte, error) {
+	return nil, errNoPKCS11
+}
+
+// Close implements io.Closer.
+func (d *PKCS11Decrypter) Close() error {
+	return nil
+}
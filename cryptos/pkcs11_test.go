@@ -0,0 +1,84 @@
+//go:build cgo && pkcs11
+
+package cryptos
+
+import (
+	"crypto"
+	cryptorand "crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// openStandinModule compiles testdata/pkcs11_standin.c and loads it with the key privateKey.
+func openStandinModule(t *testing.T) *PKCS11Module {
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("no C compiler")
+	}
+
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "libpkcs11standin.so")
+	out, err := exec.Command(cc, "-shared", "-fPIC", "-I/usr/include/p11-kit-1", "-o", lib, "testdata/pkcs11_standin.c", "-lcrypto").CombinedOutput()
+	if err != nil {
+		t.Skipf("the stand-in module needs the OpenSSL and p11-kit headers: %v\n%s", err, out)
+	}
+
+	keyPath := filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(keyPath, []byte(privateKey), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PKCS11_STANDIN_KEY", keyPath)
+
+	m, err := OpenPKCS11Module(lib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+func TestPKCS11Decrypter(t *testing.T) {
+	assert := assert.New(t)
+	m := openStandinModule(t)
+
+	_, err := m.Decrypter("fairplay", "0000", "fps")
+	assert.ErrorContains(err, "C_OpenSession")
+	_, err = m.Decrypter("other", "1234", "fps")
+	assert.ErrorContains(err, `token "other"`)
+
+	d, err := m.Decrypter("fairplay", "1234", "fps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	_, err = m.Decrypter("fairplay", "1234", "missing")
+	assert.ErrorContains(err, `key "missing"`)
+
+	key, err := DecryptPriKey([]byte(privateKey), nil)
+	assert.NoError(err)
+	assert.True(key.PublicKey.Equal(d.Public()))
+
+	spck := []byte("0123456789abcdef")
+	wrapped, err := rsa.EncryptOAEP(sha1.New(), cryptorand.Reader, &key.PublicKey, spck, nil)
+	assert.NoError(err)
+
+	plain, err := OAEPDecryptWith(d, wrapped)
+	assert.NoError(err)
+	assert.Equal(spck, plain)
+
+	_, err = d.Decrypt(cryptorand.Reader, wrapped, &rsa.OAEPOptions{Hash: crypto.SHA256})
+	assert.Error(err)
+	_, err = d.Decrypt(cryptorand.Reader, wrapped[1:], &rsa.OAEPOptions{Hash: crypto.SHA1})
+	assert.Error(err)
+
+	d.Close()
+	_, err = OAEPDecryptWith(d, wrapped)
+	assert.ErrorContains(err, "closed")
+}
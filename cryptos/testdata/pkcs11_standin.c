@@ -0,0 +1,199 @@
+// A stand-in PKCS#11 module for the PKCS11Decrypter tests. It has one token labeled "fairplay",
+// PIN "1234", holding one RSA private key labeled "fps", read from the PEM file PKCS11_STANDIN_KEY.
+// Only the functions used by PKCS11Decrypter are implemented, and only RSA-OAEP SHA-1 decryption.
+//
+// cc -shared -fPIC -I/usr/include/p11-kit-1 -o libpkcs11standin.so pkcs11_standin.c -lcrypto
+
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+#include <openssl/evp.h>
+#include <openssl/pem.h>
+#include <openssl/bn.h>
+#include <openssl/core_names.h>
+#include <p11-kit/pkcs11.h>
+
+#define SLOT 1
+#define SESSION 1
+#define KEY 1
+
+static EVP_PKEY *pkey;
+static int logged_in, find_pending, decrypt_pending;
+
+static CK_RV standin_initialize(void *args) {
+	const char *path = getenv("PKCS11_STANDIN_KEY");
+	FILE *f = path ? fopen(path, "r") : NULL;
+	if (!f) {
+		return CKR_GENERAL_ERROR;
+	}
+	pkey = PEM_read_PrivateKey(f, NULL, NULL, NULL);
+	fclose(f);
+	return pkey ? CKR_OK : CKR_GENERAL_ERROR;
+}
+
+static CK_RV standin_finalize(void *reserved) {
+	EVP_PKEY_free(pkey);
+	pkey = NULL;
+	logged_in = 0;
+	return CKR_OK;
+}
+
+static CK_RV standin_get_slot_list(CK_BBOOL present, CK_SLOT_ID *slots, CK_ULONG *n) {
+	if (slots && *n < 1) {
+		*n = 1;
+		return CKR_BUFFER_TOO_SMALL;
+	}
+	if (slots) {
+		slots[0] = SLOT;
+	}
+	*n = 1;
+	return CKR_OK;
+}
+
+static CK_RV standin_get_token_info(CK_SLOT_ID slot, CK_TOKEN_INFO *info) {
+	if (slot != SLOT) {
+		return CKR_SLOT_ID_INVALID;
+	}
+	memset(info, 0, sizeof(*info));
+	memset(info->label, ' ', sizeof(info->label));
+	memcpy(info->label, "fairplay", 8);
+	return CKR_OK;
+}
+
+static CK_RV standin_open_session(CK_SLOT_ID slot, CK_FLAGS flags, void *app, CK_NOTIFY notify, CK_SESSION_HANDLE *session) {
+	if (slot != SLOT) {
+		return CKR_SLOT_ID_INVALID;
+	}
+	*session = SESSION;
+	return CKR_OK;
+}
+
+static CK_RV standin_close_session(CK_SESSION_HANDLE session) {
+	return CKR_OK;
+}
+
+static CK_RV standin_login(CK_SESSION_HANDLE session, CK_USER_TYPE user, unsigned char *pin, CK_ULONG pin_len) {
+	if (logged_in) {
+		return CKR_USER_ALREADY_LOGGED_IN;
+	}
+	if (pin_len != 4 || memcmp(pin, "1234", 4) != 0) {
+		return CKR_PIN_INCORRECT;
+	}
+	logged_in = 1;
+	return CKR_OK;
+}
+
+static CK_RV standin_find_objects_init(CK_SESSION_HANDLE session, CK_ATTRIBUTE *match, CK_ULONG n) {
+	int found = 1;
+	for (CK_ULONG i = 0; i < n; i++) {
+		if (match[i].type == CKA_CLASS) {
+			found &= *(CK_OBJECT_CLASS *)match[i].pValue == CKO_PRIVATE_KEY;
+		} else if (match[i].type == CKA_LABEL) {
+			found &= match[i].ulValueLen == 3 && memcmp(match[i].pValue, "fps", 3) == 0;
+		}
+	}
+	find_pending = found && logged_in;
+	return CKR_OK;
+}
+
+static CK_RV standin_find_objects(CK_SESSION_HANDLE session, CK_OBJECT_HANDLE *objects, CK_ULONG max, CK_ULONG *n) {
+	*n = 0;
+	if (find_pending && max > 0) {
+		objects[0] = KEY;
+		*n = 1;
+		find_pending = 0;
+	}
+	return CKR_OK;
+}
+
+static CK_RV standin_find_objects_final(CK_SESSION_HANDLE session) {
+	find_pending = 0;
+	return CKR_OK;
+}
+
+static CK_RV standin_get_attribute_value(CK_SESSION_HANDLE session, CK_OBJECT_HANDLE key, CK_ATTRIBUTE *attributes, CK_ULONG n) {
+	for (CK_ULONG i = 0; i < n; i++) {
+		const char *name = NULL;
+		if (attributes[i].type == CKA_MODULUS) {
+			name = OSSL_PKEY_PARAM_RSA_N;
+		} else if (attributes[i].type == CKA_PUBLIC_EXPONENT) {
+			name = OSSL_PKEY_PARAM_RSA_E;
+		} else {
+			return CKR_ATTRIBUTE_TYPE_INVALID;
+		}
+
+		BIGNUM *bn = NULL;
+		if (!EVP_PKEY_get_bn_param(pkey, name, &bn)) {
+			return CKR_GENERAL_ERROR;
+		}
+		CK_ULONG len = BN_num_bytes(bn);
+		if (attributes[i].pValue) {
+			if (attributes[i].ulValueLen < len) {
+				BN_free(bn);
+				return CKR_BUFFER_TOO_SMALL;
+			}
+			BN_bn2bin(bn, attributes[i].pValue);
+		}
+		attributes[i].ulValueLen = len;
+		BN_free(bn);
+	}
+	return CKR_OK;
+}
+
+static CK_RV standin_decrypt_init(CK_SESSION_HANDLE session, CK_MECHANISM *mechanism, CK_OBJECT_HANDLE key) {
+	if (!logged_in) {
+		return CKR_USER_NOT_LOGGED_IN;
+	}
+	if (mechanism->mechanism != CKM_RSA_PKCS_OAEP || mechanism->ulParameterLen != sizeof(CK_RSA_PKCS_OAEP_PARAMS)) {
+		return CKR_MECHANISM_INVALID;
+	}
+	CK_RSA_PKCS_OAEP_PARAMS *oaep = mechanism->pParameter;
+	if (oaep->hashAlg != CKM_SHA_1 || oaep->mgf != CKG_MGF1_SHA1 || oaep->ulSourceDataLen != 0) {
+		return CKR_MECHANISM_PARAM_INVALID;
+	}
+	decrypt_pending = 1;
+	return CKR_OK;
+}
+
+static CK_RV standin_decrypt(CK_SESSION_HANDLE session, unsigned char *in, CK_ULONG in_len, unsigned char *out, CK_ULONG *out_len) {
+	if (!decrypt_pending) {
+		return CKR_OPERATION_NOT_INITIALIZED;
+	}
+	decrypt_pending = 0;
+
+	EVP_PKEY_CTX *ctx = EVP_PKEY_CTX_new(pkey, NULL);
+	size_t len = *out_len;
+	int ok = ctx && EVP_PKEY_decrypt_init(ctx) > 0 &&
+		EVP_PKEY_CTX_set_rsa_padding(ctx, RSA_PKCS1_OAEP_PADDING) > 0 &&
+		EVP_PKEY_CTX_set_rsa_oaep_md(ctx, EVP_sha1()) > 0 &&
+		EVP_PKEY_CTX_set_rsa_mgf1_md(ctx, EVP_sha1()) > 0 &&
+		EVP_PKEY_decrypt(ctx, out, &len, in, in_len) > 0;
+	EVP_PKEY_CTX_free(ctx);
+	if (!ok) {
+		return CKR_ENCRYPTED_DATA_INVALID;
+	}
+	*out_len = len;
+	return CKR_OK;
+}
+
+static CK_FUNCTION_LIST functions = {
+	.version = {2, 40},
+	.C_Initialize = standin_initialize,
+	.C_Finalize = standin_finalize,
+	.C_GetSlotList = standin_get_slot_list,
+	.C_GetTokenInfo = standin_get_token_info,
+	.C_OpenSession = standin_open_session,
+	.C_CloseSession = standin_close_session,
+	.C_Login = standin_login,
+	.C_FindObjectsInit = standin_find_objects_init,
+	.C_FindObjects = standin_find_objects,
+	.C_FindObjectsFinal = standin_find_objects_final,
+	.C_GetAttributeValue = standin_get_attribute_value,
+	.C_DecryptInit = standin_decrypt_init,
+	.C_Decrypt = standin_decrypt,
+};
+
+CK_RV C_GetFunctionList(CK_FUNCTION_LIST **list) {
+	*list = &functions;
+	return CKR_OK;
+}
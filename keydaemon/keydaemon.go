@@ -0,0 +1,236 @@
+// Package keydaemon keeps FairPlay private keys in a separate process and serves their RSA-OAEP
+// decryption over gRPC. A KSM then holds a Decrypter, a crypto.Decrypter, instead of the key.
+//
+// The service uses well-known protobuf messages, so no generated code is needed:
+//
+//	service KeyDaemon {
+//	  // The PKIX DER public key.
+//	  rpc PublicKey(google.protobuf.Empty) returns (google.protobuf.BytesValue);
+//	  // RSA-OAEP SHA-1 decryption of the ciphertext, the wrapped SPCK of an SPC.
+//	  rpc Decrypt(google.protobuf.BytesValue) returns (google.protobuf.BytesValue);
+//	}
+//
+// The key of a call is chosen by its key-id metadata, the hex certificate hash of the credential.
+package keydaemon
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minsoo-gold/fairplay-ksm/cryptos"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const (
+	serviceName = "fairplay.keydaemon.v1.KeyDaemon"
+
+	// KeyIDMetadata is the metadata key choosing the key of a call.
+	KeyIDMetadata = "key-id"
+)
+
+// DefaultTimeout is the time a Decrypter waits for the daemon when Timeout is zero.
+const DefaultTimeout = 5 * time.Second
+
+// Server serves the decryption of its keys. It is safe for concurrent use.
+type Server struct {
+	mu   sync.RWMutex
+	keys map[string]crypto.Decrypter
+}
+
+// NewServer returns a Server without keys.
+func NewServer() *Server {
+	return &Server{keys: make(map[string]crypto.Decrypter)}
+}
+
+// AddKey serves the RSA key d as id, replacing the key with the same id.
+func (s *Server) AddKey(id string, d crypto.Decrypter) error {
+	if _, ok := d.Public().(*rsa.PublicKey); !ok {
+		return fmt.Errorf("key %s is not RSA", id)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[id] = d
+	return nil
+}
+
+// RemoveKey stops serving key id.
+func (s *Server) RemoveKey(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, id)
+}
+
+// Register registers the KeyDaemon service of s on g.
+func (s *Server) Register(g *grpc.Server) {
+	g.RegisterService(&serviceDesc, s)
+}
+
+func (s *Server) key(ctx context.Context) (crypto.Decrypter, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ids := md.Get(KeyIDMetadata)
+	if len(ids) != 1 {
+		return nil, status.Errorf(codes.InvalidArgument, "one %s metadata required", KeyIDMetadata)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	d, ok := s.keys[ids[0]]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "unknown key %s", ids[0])
+	}
+	return d, nil
+}
+
+func (s *Server) publicKey(ctx context.Context, _ *emptypb.Empty) (*wrapperspb.BytesValue, error) {
+	d, err := s.key(ctx)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKIXPublicKey(d.Public())
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return wrapperspb.Bytes(der), nil
+}
+
+func (s *Server) decrypt(ctx context.Context, in *wrapperspb.BytesValue) (*wrapperspb.BytesValue, error) {
+	d, err := s.key(ctx)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := d.Decrypt(rand.Reader, in.GetValue(), &rsa.OAEPOptions{Hash: crypto.SHA1})
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return wrapperspb.Bytes(plaintext), nil
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*any)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "PublicKey", Handler: publicKeyHandler},
+		{MethodName: "Decrypt", Handler: decryptHandler},
+	},
+	Metadata: "keydaemon.proto",
+}
+
+// The handlers are written as protoc-gen-go-grpc would generate them.
+
+func publicKeyHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(*Server).publicKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + serviceName + "/PublicKey"}
+	return interceptor(ctx, in, info, func(ctx context.Context, req any) (any, error) {
+		return srv.(*Server).publicKey(ctx, req.(*emptypb.Empty))
+	})
+}
+
+func decryptHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(wrapperspb.BytesValue)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(*Server).decrypt(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + serviceName + "/Decrypt"}
+	return interceptor(ctx, in, info, func(ctx context.Context, req any) (any, error) {
+		return srv.(*Server).decrypt(ctx, req.(*wrapperspb.BytesValue))
+	})
+}
+
+// Dial connects to the key daemon at target, such as unix:///run/keydaemon.sock.
+// Without opts the connection has no transport security, so target must be a unix socket.
+func Dial(target string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	if len(opts) == 0 {
+		if !strings.HasPrefix(target, "unix:") {
+			return nil, fmt.Errorf("keydaemon: %s isn't a unix socket, transport credentials required", target)
+		}
+		opts = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+	return grpc.NewClient(target, opts...)
+}
+
+// Decrypter is the crypto.Decrypter of a key served by a key daemon.
+type Decrypter struct {
+	conn    grpc.ClientConnInterface
+	id      string
+	pub     *rsa.PublicKey
+	Timeout time.Duration // The maximum time to answer a request, DefaultTimeout if zero.
+}
+
+// NewDecrypter returns the decrypter of key id served at conn, after fetching its public key.
+func NewDecrypter(ctx context.Context, conn grpc.ClientConnInterface, id string) (*Decrypter, error) {
+	d := &Decrypter{conn: conn, id: id}
+
+	ctx, cancel := context.WithTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	out := new(wrapperspb.BytesValue)
+	if err := d.invoke(ctx, "PublicKey", &emptypb.Empty{}, out); err != nil {
+		return nil, err
+	}
+	pub, err := x509.ParsePKIXPublicKey(out.GetValue())
+	if err != nil {
+		return nil, fmt.Errorf("key daemon: public key of %s: %w", id, err)
+	}
+	rsaPub, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("key daemon: key %s is not RSA", id)
+	}
+	d.pub = rsaPub
+	return d, nil
+}
+
+// Public implements crypto.Decrypter.
+func (d *Decrypter) Public() crypto.PublicKey {
+	return d.pub
+}
+
+// Decrypt implements crypto.Decrypter. opts must be *rsa.OAEPOptions with SHA-1 and no label,
+// the only scheme the daemon serves.
+func (d *Decrypter) Decrypt(_ io.Reader, ciphertext []byte, opts crypto.DecrypterOpts) ([]byte, error) {
+	if err := cryptos.CheckOAEPSHA1(opts); err != nil {
+		return nil, fmt.Errorf("key daemon: %w", err)
+	}
+
+	timeout := d.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	out := new(wrapperspb.BytesValue)
+	if err := d.invoke(ctx, "Decrypt", wrapperspb.Bytes(ciphertext), out); err != nil {
+		return nil, err
+	}
+	return out.GetValue(), nil
+}
+
+func (d *Decrypter) invoke(ctx context.Context, method string, in, out any) error {
+	ctx = metadata.AppendToOutgoingContext(ctx, KeyIDMetadata, d.id)
+	if err := d.conn.Invoke(ctx, "/"+serviceName+"/"+method, in, out); err != nil {
+		return fmt.Errorf("key daemon: %s: %w", method, err)
+	}
+	return nil
+}
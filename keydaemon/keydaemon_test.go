@@ -0,0 +1,80 @@
+package keydaemon
+
+import (
+	"context"
+	"crypto"
+	cryptorand "crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"net"
+	"testing"
+
+	"github.com/minsoo-gold/fairplay-ksm/cryptos"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// serve starts a daemon serving keys on an in-memory listener and returns a connection to it.
+func serve(t *testing.T, keys map[string]crypto.Decrypter) *grpc.ClientConn {
+	s := NewServer()
+	for id, key := range keys {
+		if err := s.AddKey(id, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	g := grpc.NewServer()
+	s.Register(g)
+
+	listener := bufconn.Listen(1 << 16)
+	go g.Serve(listener)
+	t.Cleanup(g.Stop)
+
+	conn, err := Dial("passthrough:///keydaemon",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestDecrypter(t *testing.T) {
+	assert := assert.New(t)
+
+	key, err := rsa.GenerateKey(cryptorand.Reader, 1024)
+	assert.NoError(err)
+	conn := serve(t, map[string]crypto.Decrypter{"fps": key})
+
+	_, err = NewDecrypter(context.Background(), conn, "missing")
+	assert.ErrorContains(err, "unknown key missing")
+
+	d, err := NewDecrypter(context.Background(), conn, "fps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(key.PublicKey.Equal(d.Public()))
+
+	spck := []byte("0123456789abcdef")
+	wrapped, err := rsa.EncryptOAEP(sha1.New(), cryptorand.Reader, &key.PublicKey, spck, nil)
+	assert.NoError(err)
+	plain, err := cryptos.OAEPDecryptWith(d, wrapped)
+	assert.NoError(err)
+	assert.Equal(spck, plain)
+
+	_, err = d.Decrypt(nil, wrapped, &rsa.OAEPOptions{Hash: crypto.SHA256})
+	assert.Error(err)
+	_, err = cryptos.OAEPDecryptWith(d, wrapped[1:])
+	assert.ErrorContains(err, "InvalidArgument")
+}
+
+func TestDial(t *testing.T) {
+	_, err := Dial("localhost:7000")
+	assert.ErrorContains(t, err, "transport credentials required")
+
+	conn, err := Dial("unix:///run/keydaemon.sock")
+	assert.NoError(t, err)
+	conn.Close()
+}
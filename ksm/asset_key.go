@@ -0,0 +1,92 @@
+package ksm
+
+import (
+	"context"
+	"fmt"
+)
+
+// AssetKey represents the content key of an asset and the license policy it is delivered with.
+type AssetKey struct {
+	KID []byte // The key ID, only logged.
+	Key []byte // The 16-byte content key.
+	IV  []byte // The 16-byte content IV.
+
+	// Duration is sent in the content key duration TLLV of SPCs carrying a media playback state.
+	// Nil sends no content key duration TLLV.
+	Duration *CkcContentKeyDurationBlock
+
+	// Policy holds the HDCP, output, offline and client requirements of the asset. Nil is an empty policy.
+	Policy *AssetPolicy
+}
+
+// ContentKeyProvider returns the content keys of assets. It supersedes ContentKey: the key and its
+// policy are returned together, and the request context and the whole SPC are available.
+//
+// FetchAssetKey returns an error matching ErrAssetNotFound if the asset of spc is unknown,
+// and ErrAssetDisabled if it exists but no license may be issued for it.
+type ContentKeyProvider interface {
+	FetchAssetKey(ctx context.Context, spc *SPC) (*AssetKey, error)
+}
+
+// AdaptContentKey returns a ContentKeyProvider fetching the keys and policies of ck. The optional
+// AssetPolicyProvider and ProtocolVersionObserver interfaces of ck are used when implemented.
+func AdaptContentKey(ck ContentKey) ContentKeyProvider {
+	return contentKeyAdapter{ck}
+}
+
+type contentKeyAdapter struct {
+	ck ContentKey
+}
+
+// FetchAssetKey implements ContentKeyProvider. The duration is only fetched for SPCs carrying a media playback state.
+func (a contentKeyAdapter) FetchAssetKey(ctx context.Context, spc *SPC) (*AssetKey, error) {
+	if observer, ok := a.ck.(ProtocolVersionObserver); ok {
+		observer.ObserveProtocolVersion(spc.AssetID, spc.ProtocolVersion)
+	}
+
+	policy, err := fetchAssetPolicy(spc.AssetID, a.ck)
+	if err != nil {
+		return nil, err
+	}
+	kid, key, iv, err := a.ck.FetchContentKey(spc.AssetID)
+	if err != nil {
+		return nil, err
+	}
+	assetKey := &AssetKey{KID: kid, Key: key, IV: iv, Policy: policy}
+
+	if spc.PlaybackState != nil {
+		if assetKey.Duration, err = a.ck.FetchContentKeyDuration(spc.AssetID); err != nil {
+			return nil, err
+		}
+	}
+	return assetKey, nil
+}
+
+// contentKeyProvider returns the provider of the content keys: Keys if set, Rck adapted otherwise.
+func (k *Ksm) contentKeyProvider() ContentKeyProvider {
+	if k.Keys != nil {
+		return k.Keys
+	}
+	return AdaptContentKey(k.Rck)
+}
+
+// fetchAssetKey fetches and checks the asset key of spc.
+func (k *Ksm) fetchAssetKey(ctx context.Context, spc *SPC) (*AssetKey, error) {
+	assetKey, err := k.contentKeyProvider().FetchAssetKey(ctx, spc)
+	if err != nil {
+		return nil, err
+	}
+	if assetKey == nil {
+		return nil, fmt.Errorf("%w: no content key for asset %q", ErrAssetNotFound, spc.AssetID)
+	}
+	if len(assetKey.Key) != 16 {
+		return nil, fmt.Errorf("content key of asset %q is %d bytes, must be 16", spc.AssetID, len(assetKey.Key))
+	}
+	if len(assetKey.IV) != 16 {
+		return nil, fmt.Errorf("content IV of asset %q is %d bytes, must be 16", spc.AssetID, len(assetKey.IV))
+	}
+	if assetKey.Policy == nil {
+		assetKey.Policy = &AssetPolicy{}
+	}
+	return assetKey, nil
+}
@@ -0,0 +1,127 @@
+package ksm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type tenantKey struct{}
+
+// mapKeys is a ContentKeyProvider of the assets in a map, served to the tenant of the context only.
+type mapKeys struct {
+	tenant   string
+	assets   map[string]*AssetKey
+	disabled map[string]bool
+	spcs     []*SPC
+}
+
+func (m *mapKeys) FetchAssetKey(ctx context.Context, spc *SPC) (*AssetKey, error) {
+	m.spcs = append(m.spcs, spc)
+	if ctx.Value(tenantKey{}) != m.tenant {
+		return nil, fmt.Errorf("%w: wrong tenant", ErrAssetNotFound)
+	}
+	if m.disabled[string(spc.AssetID)] {
+		return nil, fmt.Errorf("%w: %s", ErrAssetDisabled, spc.AssetID)
+	}
+	key, ok := m.assets[string(spc.AssetID)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrAssetNotFound, spc.AssetID)
+	}
+	return key, nil
+}
+
+func TestGenCKC_ContentKeyProvider(t *testing.T) {
+	assert := assert.New(t)
+
+	e, k := testEmulator(t)
+	key := &AssetKey{
+		KID:      randomBytes(16),
+		Key:      randomBytes(16),
+		IV:       randomBytes(16),
+		Duration: NewCkcContentKeyDurationBlock(3600, 0),
+		Policy:   &AssetPolicy{HDCP: HDCPType1},
+	}
+	keys := &mapKeys{
+		tenant:   "customer",
+		assets:   map[string]*AssetKey{"asset-1": key, "asset-2": {Key: randomBytes(16), IV: randomBytes(16)}},
+		disabled: map[string]bool{"asset-3": true},
+	}
+	k.Rck, k.Keys = nil, keys
+	ctx := context.WithValue(context.Background(), tenantKey{}, "customer")
+	state := &MediaPlaybackState{CreationTime: time.Now(), State: PlaybackStatePlaying}
+
+	spc := e.build(t, spcRequest{AssetID: []byte("asset-1"), PlaybackState: state})
+	out, err := k.GenCKCContext(ctx, spc.Playback, CKCOptions{})
+	assert.NoError(err)
+	ckc, err := DecodeCKC(out, spc.Secrets)
+	assert.NoError(err)
+	assert.Equal(key.Key, ckc.ContentKey)
+	assert.Equal(key.IV, ckc.ContentIV)
+	assert.Equal(HDCPType1, ckc.HDCP)
+	if assert.NotNil(ckc.Duration) {
+		assert.Equal(uint32(3600), ckc.Duration.LeaseDuration)
+	}
+	if assert.Len(keys.spcs, 1) {
+		assert.Equal([]byte("asset-1"), keys.spcs[0].AssetID)
+		assert.Equal(spc.HU, keys.spcs[0].DeviceID)
+	}
+
+	// Without duration or policy, neither TLLV is sent.
+	spc = e.build(t, spcRequest{AssetID: []byte("asset-2"), PlaybackState: state})
+	out, err = k.GenCKCContext(ctx, spc.Playback, CKCOptions{})
+	assert.NoError(err)
+	ckc, err = DecodeCKC(out, spc.Secrets)
+	assert.NoError(err)
+	assert.Nil(ckc.Duration)
+	assert.Zero(ckc.HDCP)
+
+	_, err = k.GenCKCContext(ctx, e.build(t, spcRequest{AssetID: []byte("asset-3")}).Playback, CKCOptions{})
+	assert.ErrorIs(err, ErrAssetDisabled)
+	_, err = k.GenCKCContext(ctx, e.build(t, spcRequest{AssetID: []byte("asset-4")}).Playback, CKCOptions{})
+	assert.ErrorIs(err, ErrAssetNotFound)
+	_, err = k.GenCKC(e.build(t, spcRequest{AssetID: []byte("asset-1")}).Playback)
+	assert.ErrorIs(err, ErrAssetNotFound, "the provider receives the request context")
+
+	// A key of the wrong length is rejected.
+	keys.assets["asset-5"] = &AssetKey{Key: randomBytes(15), IV: randomBytes(16)}
+	_, err = k.GenCKCContext(ctx, e.build(t, spcRequest{AssetID: []byte("asset-5")}).Playback, CKCOptions{})
+	assert.ErrorContains(err, "must be 16")
+}
+
+func TestAdaptContentKey(t *testing.T) {
+	assert := assert.New(t)
+
+	version := &ProtocolVersion{}
+	provider := AdaptContentKey(VersionContentKey{Version: version})
+	spc := &SPC{AssetID: []byte("asset"), ProtocolVersion: ProtocolVersion{Used: 1, Supported: []uint32{1}}}
+
+	key, err := provider.FetchAssetKey(context.Background(), spc)
+	assert.NoError(err)
+	assert.Len(key.Key, 16)
+	assert.Nil(key.Duration, "the duration is only fetched for SPCs with a playback state")
+	assert.Equal(&AssetPolicy{}, key.Policy)
+	assert.Equal(spc.ProtocolVersion, *version)
+
+	spc.PlaybackState = &MediaPlaybackState{}
+	key, err = AdaptContentKey(PolicyContentKey{Policy: AssetPolicy{HDCP: HDCPType0}}).FetchAssetKey(context.Background(), spc)
+	assert.NoError(err)
+	assert.NotNil(key.Duration)
+	assert.Equal(HDCPType0, key.Policy.HDCP)
+
+	_, err = AdaptContentKey(failingContentKey{}).FetchAssetKey(context.Background(), spc)
+	assert.True(errors.Is(err, ErrAssetNotFound))
+}
+
+// failingContentKey is a ContentKey without assets.
+type failingContentKey struct {
+	RandomContentKey
+}
+
+func (failingContentKey) FetchContentKey(assetID []byte) ([]byte, []byte, []byte, error) {
+	return nil, nil, nil, fmt.Errorf("%w: %s", ErrAssetNotFound, assetID)
+}
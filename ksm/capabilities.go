@@ -0,0 +1,130 @@
+package ksm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Capabilities represents the capability flags of the client, sent in the Capabilities TLLV.
+// The flags are defined in the Capabilities TLLV section of the FairPlay Streaming Server SDK
+// Programming Guide. Only the flags listed there are named, other bits are kept undecoded.
+type Capabilities uint64
+
+const (
+	CapabilityHDCPTypeEnforcement Capabilities = 1 << 0 // The client enforces the HDCP enforcement TLLV.
+	CapabilityOfflineKey          Capabilities = 1 << 1 // The client supports the offline key TLLV.
+)
+
+var capabilityNames = []struct {
+	capability Capabilities
+	name       string
+}{
+	{CapabilityHDCPTypeEnforcement, "hdcp_enforcement"},
+	{CapabilityOfflineKey, "offline_key"},
+}
+
+// Has reports whether c has every capability of required.
+func (c Capabilities) Has(required Capabilities) bool {
+	return c&required == required
+}
+
+// String returns the names of the capabilities separated by "|", unnamed flags in hex.
+func (c Capabilities) String() string {
+	var names []string
+	for _, n := range capabilityNames {
+		if c&n.capability != 0 {
+			names = append(names, n.name)
+			c &^= n.capability
+		}
+	}
+	if c != 0 || len(names) == 0 {
+		names = append(names, fmt.Sprintf("0x%x", uint64(c)))
+	}
+	return strings.Join(names, "|")
+}
+
+// ParseCapability parses a capability name ("hdcp_enforcement" or "offline_key").
+func ParseCapability(name string) (Capabilities, error) {
+	for _, n := range capabilityNames {
+		if strings.EqualFold(name, n.name) {
+			return n.capability, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown capability %q, must be hdcp_enforcement or offline_key", name)
+}
+
+// SecurityLevel represents the security level of the client, ordered from the lowest to the highest.
+type SecurityLevel int
+
+const (
+	SecurityLevelNone     SecurityLevel = iota // The client doesn't report a security level.
+	SecurityLevelBaseline                      // The client reports a security level lower than main.
+	SecurityLevelMain                          // The client reports the main security level.
+)
+
+// securityLevelMain is the Security Level Report TLLV value of the main security level.
+const securityLevelMain = 0x4e7fd92421d588b4
+
+// String returns the name of the security level.
+func (l SecurityLevel) String() string {
+	switch l {
+	case SecurityLevelNone:
+		return "none"
+	case SecurityLevelBaseline:
+		return "baseline"
+	case SecurityLevelMain:
+		return "main"
+	default:
+		return fmt.Sprintf("SecurityLevel(%d)", int(l))
+	}
+}
+
+// ParseSecurityLevel parses a stored security level name ("baseline" or "main").
+// An empty name returns SecurityLevelNone, which every client satisfies.
+func ParseSecurityLevel(name string) (SecurityLevel, error) {
+	switch strings.ToLower(name) {
+	case "", "none":
+		return SecurityLevelNone, nil
+	case "baseline":
+		return SecurityLevelBaseline, nil
+	case "main":
+		return SecurityLevelMain, nil
+	default:
+		return 0, fmt.Errorf("unknown security level %q, must be baseline or main", name)
+	}
+}
+
+// SecurityLevelReport represents the decoded Security Level Report TLLV.
+type SecurityLevelReport struct {
+	Version uint32        // The version of the report.
+	Value   uint64        // The raw security level value.
+	Level   SecurityLevel // The security level of Value.
+}
+
+// decodeCapabilities decodes the 16-byte Capabilities TLLV value, a 128-bit big-endian flag field.
+// Every defined flag is in the last 8 bytes; the first 8 bytes are reserved and not decoded.
+func decodeCapabilities(value []byte) (Capabilities, error) {
+	if len(value) != 16 {
+		return 0, fmt.Errorf("%w: tagCapabilities value length %d, must be 16", ErrTLLVBlockLength, len(value))
+	}
+	return Capabilities(binary.BigEndian.Uint64(value[8:16])), nil
+}
+
+// decodeSecurityLevelReport decodes the Security Level Report TLLV value:
+// version(4), reserved(4), security level(8) and reserved(4).
+func decodeSecurityLevelReport(value []byte) (*SecurityLevelReport, error) {
+	if len(value) < 16 {
+		return nil, fmt.Errorf("%w: tagSecurityLevelReport value length %d", ErrTLLVBlockLength, len(value))
+	}
+
+	report := &SecurityLevelReport{
+		Version: binary.BigEndian.Uint32(value[0:4]),
+		Value:   binary.BigEndian.Uint64(value[8:16]),
+		Level:   SecurityLevelBaseline,
+	}
+	if report.Value == securityLevelMain {
+		report.Level = SecurityLevelMain
+	}
+	return report, nil
+}
@@ -0,0 +1,107 @@
+package ksm
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeCapabilities(t *testing.T) {
+	value, _ := hex.DecodeString("00000000000000000000000000000003")
+	capabilities, err := decodeCapabilities(value)
+	assert.NoError(t, err)
+	assert.True(t, capabilities.Has(CapabilityHDCPTypeEnforcement|CapabilityOfflineKey))
+
+	// The reserved bytes and the undefined bits aren't decoded as named capabilities.
+	value, _ = hex.DecodeString("ffffffffffffffff0000000000000010")
+	capabilities, err = decodeCapabilities(value)
+	assert.NoError(t, err)
+	assert.Equal(t, Capabilities(0x10), capabilities)
+	assert.False(t, capabilities.Has(CapabilityHDCPTypeEnforcement))
+	assert.Equal(t, "0x10", capabilities.String())
+
+	_, err = decodeCapabilities(value[:8])
+	assert.True(t, errors.Is(err, ErrTLLVBlockLength))
+}
+
+func TestCapabilitiesString(t *testing.T) {
+	assert.Equal(t, "hdcp_enforcement|offline_key", (CapabilityHDCPTypeEnforcement | CapabilityOfflineKey).String())
+	assert.Equal(t, "offline_key|0x10", (CapabilityOfflineKey | 0x10).String())
+	assert.Equal(t, "0x0", Capabilities(0).String())
+
+	capability, err := ParseCapability("Offline_Key")
+	assert.NoError(t, err)
+	assert.Equal(t, CapabilityOfflineKey, capability)
+	_, err = ParseCapability("uhd")
+	assert.Error(t, err)
+}
+
+func TestDecodeSecurityLevelReport(t *testing.T) {
+	assert := assert.New(t)
+
+	value, _ := hex.DecodeString("00000001000000004e7fd92421d588b400000000")
+	report, err := decodeSecurityLevelReport(value)
+	assert.NoError(err)
+	assert.Equal(&SecurityLevelReport{Version: 1, Value: securityLevelMain, Level: SecurityLevelMain}, report)
+
+	binary.BigEndian.PutUint64(value[8:16], 0x1234)
+	report, err = decodeSecurityLevelReport(value)
+	assert.NoError(err)
+	assert.Equal(SecurityLevelBaseline, report.Level)
+
+	_, err = decodeSecurityLevelReport(value[:12])
+	assert.True(errors.Is(err, ErrTLLVBlockLength))
+}
+
+func TestAssetPolicyCheck_Client(t *testing.T) {
+	assert := assert.New(t)
+
+	main := &SPC{Capabilities: CapabilityHDCPTypeEnforcement, SecurityLevel: &SecurityLevelReport{Level: SecurityLevelMain}}
+	baseline := &SPC{SecurityLevel: &SecurityLevelReport{Level: SecurityLevelBaseline}}
+	unreported := &SPC{}
+
+	policy := &AssetPolicy{MinSecurityLevel: SecurityLevelMain}
+	assert.NoError(policy.check(main, CKCOptions{}, nil))
+	err := policy.check(baseline, CKCOptions{}, nil)
+	var policyErr *PolicyError
+	assert.True(errors.As(err, &policyErr))
+	assert.Equal("security level baseline is below the main security level required for this asset", policyErr.Reason)
+
+	policy = &AssetPolicy{MinSecurityLevel: SecurityLevelBaseline}
+	assert.NoError(policy.check(baseline, CKCOptions{}, nil))
+	assert.Error(policy.check(unreported, CKCOptions{}, nil))
+
+	policy = &AssetPolicy{RequiredCapabilities: CapabilityHDCPTypeEnforcement | CapabilityOfflineKey}
+	err = policy.check(main, CKCOptions{}, nil)
+	assert.True(errors.As(err, &policyErr))
+	assert.Equal("client capabilities offline_key required for this asset are missing", policyErr.Reason)
+}
+
+func TestGenCKC_SecurityLevel(t *testing.T) {
+	assert := assert.New(t)
+
+	playback := readBin("../testdata/FPS/spc1.bin")
+
+	baseline := resealSPC(t, playback, func(blocks []TLLVBlock) []TLLVBlock {
+		for i, block := range blocks {
+			if block.Tag == tagSecurityLevelReport {
+				value := append([]byte{}, block.Value...)
+				binary.BigEndian.PutUint64(value[8:16], 0x1234)
+				blocks[i].Value = value
+			}
+		}
+		return blocks
+	})
+
+	k := testKsm(t)
+	k.Rck = PolicyContentKey{Policy: AssetPolicy{MinSecurityLevel: SecurityLevelMain}}
+
+	_, err := k.GenCKC(playback)
+	assert.NoError(err)
+
+	_, err = k.GenCKC(baseline)
+	assert.True(errors.Is(err, ErrPolicyDenied))
+}
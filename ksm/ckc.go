@@ -1,5 +1,14 @@
 package ksm
 
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/minsoo-gold/fairplay-ksm/cryptos"
+)
+
 // ContentKey is a interface that fetch asset content key and duration.
 type ContentKey interface {
 	FetchContentKey(assetID []byte) ([]byte, []byte, []byte, error)
@@ -13,3 +22,146 @@ type CKCPayload struct {
 	R1             []byte
 	IntegrityBytes []byte
 }
+
+// CKCSecrets represents the values of the SPC that a CKC is encrypted with.
+// Only the client that created the SPC (or a test emulating it) knows them.
+type CKCSecrets struct {
+	SK             []byte // The 16-byte session key of [SK..R1].
+	R1             []byte // The 44-byte R1 of [SK..R1].
+	AntiReplaySeed []byte // The 16-byte anti-replay seed of the SPC.
+}
+
+// CKC represents a decrypted and decoded CKC message.
+type CKC struct {
+	Container *CKCContainer
+	Blocks    []TLLVBlock // The TLLV blocks in payload order.
+
+	ContentKey    []byte                      // The decrypted 16-byte content key.
+	ContentIV     []byte                      // The 16-byte IV of the content key TLLV.
+	R1            []byte                      // The R1 echoed by the KSM.
+	Duration      *CkcContentKeyDurationBlock // The content key duration, nil if absent.
+	HDCP          HDCPType                    // The HDCP requirement, zero if absent.
+	OfflineKey    []byte                      // The offline key TLLV value, nil if absent.
+	ReturnRequest []TLLVBlock                 // The SPC TLLVs returned at the client's request, in payload order.
+}
+
+// ckcTags are the tags of the TLLVs the KSM writes in a CKC, every other block is a returned SPC TLLV.
+var ckcTags = map[uint64]bool{
+	tagEncryptedCk:        true,
+	tagR1:                 true,
+	tagContentKeyDuration: true,
+	tagHdcpEnforcement:    true,
+	tagOfflineKey:         true,
+}
+
+// DecodeCKC decrypts and decodes a CKC message with the secrets of the SPC it answers.
+// DecodeCKC checks the container, the TLLV block lengths, and the R1 the KSM echoed. The padding of a TLLV is
+// random, so only its length is checked: the block length must be a multiple of 16 bytes.
+// It returns an error matching ErrCKCMalformed, or a TLLV parse error, if the CKC is malformed.
+func DecodeCKC(ckc []byte, secrets CKCSecrets) (*CKC, error) {
+	container, err := parseCKCContainer(ckc)
+	if err != nil {
+		return nil, err
+	}
+	if len(secrets.SK) != 16 || len(secrets.AntiReplaySeed) != 16 || len(secrets.R1) != 44 {
+		return nil, fmt.Errorf("ckc secrets: SK %d bytes, anti-replay seed %d bytes and R1 %d bytes, must be 16, 16 and 44",
+			len(secrets.SK), len(secrets.AntiReplaySeed), len(secrets.R1))
+	}
+
+	arKey, err := getEncryptedArSeed(secrets.R1, secrets.AntiReplaySeed)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := cryptos.AESCBCDecrypt(arKey, container.CKCDataInitV, container.CKCPayload)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks, err := parseTLLVBlocks(payload)
+	if err != nil {
+		return nil, err
+	}
+	result := &CKC{Container: container, Blocks: blocks}
+
+	for _, block := range blocks {
+		if block.BlockLength%16 != 0 {
+			return nil, fmt.Errorf("%w: tag %x block length %d, value length %d, must be padded to a multiple of 16 bytes",
+				ErrCKCMalformed, block.Tag, block.BlockLength, block.ValueLength)
+		}
+
+		switch block.Tag {
+		case tagEncryptedCk:
+			if len(block.Value) != 32 {
+				return nil, fmt.Errorf("%w: content key value length %d, must be 32", ErrCKCMalformed, len(block.Value))
+			}
+			result.ContentIV = block.Value[0:16]
+			if result.ContentKey, err = cryptos.AESCBCDecrypt(secrets.SK, make([]byte, 16), block.Value[16:32]); err != nil {
+				return nil, err
+			}
+		case tagR1:
+			result.R1 = block.Value
+		case tagContentKeyDuration:
+			if result.Duration, err = decodeContentKeyDuration(block); err != nil {
+				return nil, err
+			}
+		case tagHdcpEnforcement:
+			if len(block.Value) != 8 {
+				return nil, fmt.Errorf("%w: HDCP enforcement value length %d, must be 8", ErrCKCMalformed, len(block.Value))
+			}
+			result.HDCP = HDCPType(binary.BigEndian.Uint64(block.Value))
+		case tagOfflineKey:
+			result.OfflineKey = block.Value
+		default:
+			result.ReturnRequest = append(result.ReturnRequest, block)
+		}
+	}
+
+	if result.ContentKey == nil {
+		return nil, fmt.Errorf("%w: content key tllv is missing", ErrCKCMalformed)
+	}
+	if !bytes.Equal(result.R1, secrets.R1) {
+		return nil, fmt.Errorf("%w: R1 doesn't match the SPC", ErrCKCMalformed)
+	}
+
+	return result, nil
+}
+
+// parseCKCContainer splits a CKC message: version(4), reserved(4), IV(16), payload length(4) and payload.
+func parseCKCContainer(ckc []byte) (*CKCContainer, error) {
+	if len(ckc) < 28 {
+		return nil, fmt.Errorf("%w: got %d bytes, need at least 28", ErrCKCMalformed, len(ckc))
+	}
+
+	container := &CKCContainer{
+		CKCVersion:       binary.BigEndian.Uint32(ckc[0:4]),
+		Reserved:         ckc[4:8],
+		CKCDataInitV:     ckc[8:24],
+		CKCPayloadLength: binary.BigEndian.Uint32(ckc[24:28]),
+	}
+	if container.CKCVersion != 1 {
+		return nil, fmt.Errorf("%w: version %d", ErrCKCMalformed, container.CKCVersion)
+	}
+
+	payloadLen := uint64(container.CKCPayloadLength)
+	if payloadLen == 0 || payloadLen%aes.BlockSize != 0 || payloadLen != uint64(len(ckc)-28) {
+		return nil, fmt.Errorf("%w: payload length %d, %d bytes available", ErrCKCMalformed, payloadLen, len(ckc)-28)
+	}
+	container.CKCPayload = ckc[28:]
+
+	return container, nil
+}
+
+// decodeContentKeyDuration decodes the Content Key Duration TLLV: lease(4), rental(4), key type(4) and reserved(4).
+func decodeContentKeyDuration(block TLLVBlock) (*CkcContentKeyDurationBlock, error) {
+	if len(block.Value) != 16 {
+		return nil, fmt.Errorf("%w: content key duration value length %d, must be 16", ErrCKCMalformed, len(block.Value))
+	}
+
+	tllv := block
+	return &CkcContentKeyDurationBlock{
+		TLLVBlock:      &tllv,
+		LeaseDuration:  binary.BigEndian.Uint32(block.Value[0:4]),
+		RentalDuration: binary.BigEndian.Uint32(block.Value[4:8]),
+		KeyType:        ContentKeyType(binary.BigEndian.Uint32(block.Value[8:12])),
+	}, nil
+}
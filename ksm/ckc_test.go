@@ -0,0 +1,82 @@
+package ksm
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testCKCSecrets decrypts the [SK..R1] of an SPC made for the test credential, as the client would know it.
+func testCKCSecrets(t *testing.T, playback []byte) CKCSecrets {
+	k := testKsm(t)
+
+	container, err := ParseSPC(playback, k.Pub, k.Pri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spc, err := DecodeSPC(container)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dask, err := ReferenceDFunction{}.Compute(spc.R2, k.Ask)
+	if err != nil {
+		t.Fatal(err)
+	}
+	skr1, err := decryptSKR1Payload(*spc.SKR1, dask)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return CKCSecrets{SK: skr1.SK, R1: skr1.R1, AntiReplaySeed: spc.AntiReplaySeed}
+}
+
+func TestDecodeCKC(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, test := range spcContainerTests {
+		secrets := testCKCSecrets(t, readBin(test.filePath))
+
+		ckc, err := DecodeCKC(readBin(test.outFilePath), secrets)
+		if !assert.NoError(err, test.outFilePath) {
+			continue
+		}
+		assert.Equal(uint32(1), ckc.Container.CKCVersion)
+		assert.Len(ckc.ContentKey, 16)
+		assert.Len(ckc.ContentIV, 16)
+		assert.Equal(secrets.R1, ckc.R1)
+	}
+}
+
+func TestDecodeCKC_Malformed(t *testing.T) {
+	playback := readBin("../testdata/FPS/spc1.bin")
+	secrets := testCKCSecrets(t, playback)
+	ckc := readBin("../testdata/FPS/ckc1.bin")
+
+	tests := []struct {
+		name    string
+		ckc     []byte
+		secrets CKCSecrets
+	}{
+		{"truncated header", ckc[:20], secrets},
+		{"wrong version", append([]byte{0, 0, 0, 2}, ckc[4:]...), secrets},
+		{"truncated payload", ckc[:len(ckc)-16], secrets},
+		{"partial block", ckc[:len(ckc)-1], secrets},
+		{"missing secrets", ckc, CKCSecrets{R1: secrets.R1}},
+		{"short R1", ckc, CKCSecrets{SK: secrets.SK, AntiReplaySeed: secrets.AntiReplaySeed, R1: secrets.R1[:43]}},
+	}
+	for _, test := range tests {
+		_, err := DecodeCKC(test.ckc, test.secrets)
+		assert.Error(t, err, test.name)
+	}
+
+	// The payload length field must match the message.
+	lengthMismatch := append([]byte{}, ckc...)
+	binary.BigEndian.PutUint32(lengthMismatch[24:28], uint32(len(ckc)-28-16))
+	_, err := DecodeCKC(lengthMismatch, secrets)
+	assert.True(t, errors.Is(err, ErrCKCMalformed))
+
+	// Another SPC's secrets decrypt the payload to garbage.
+	_, err = DecodeCKC(ckc, testCKCSecrets(t, readBin("../testdata/FPS-lease/spc1.bin")))
+	assert.Error(t, err)
+}
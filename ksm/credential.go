@@ -0,0 +1,180 @@
+package ksm
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Credential represents a FairPlay Streaming credential: the key pair of an application certificate and its ASk.
+type Credential struct {
+	Pub *rsa.PublicKey
+	Pri *rsa.PrivateKey
+	Ask []byte
+
+	// Decrypter is used in place of Pri when the private key is kept outside the process.
+	Decrypter crypto.Decrypter
+
+	// CertificateHash is the SHA-1 fingerprint of the DER application certificate,
+	// the value clients send in the SPC to identify the credential.
+	CertificateHash []byte
+}
+
+// NewCredential returns the credential of a PEM or DER encoded application certificate, its private key and ASk.
+// NewCredential returns an error if the certificate can't be parsed or doesn't match the private key.
+func NewCredential(certificate []byte, pri *rsa.PrivateKey, ask []byte) (*Credential, error) {
+	if pri == nil {
+		return nil, errors.New("private key required")
+	}
+	c, err := NewCredentialWithDecrypter(certificate, pri, ask)
+	if err != nil {
+		return nil, err
+	}
+	c.Pri, c.Decrypter = pri, nil
+	return c, nil
+}
+
+// NewCredentialWithDecrypter is like NewCredential for a private key only available as a crypto.Decrypter,
+// such as a key in a PKCS#11 token or a key daemon.
+func NewCredentialWithDecrypter(certificate []byte, d crypto.Decrypter, ask []byte) (*Credential, error) {
+	if d == nil {
+		return nil, errors.New("private key required")
+	}
+	der, err := certificateDER(certificate)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("application certificate: %w", err)
+	}
+	pub, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("application certificate: public key is not RSA")
+	}
+	if !pub.Equal(d.Public()) {
+		return nil, errors.New("application certificate doesn't match the private key")
+	}
+
+	hash := sha1.Sum(der)
+	return &Credential{Pub: pub, Decrypter: d, Ask: ask, CertificateHash: hash[:]}, nil
+}
+
+// CertificateHash returns the SHA-1 hash of a PEM or DER encoded application certificate,
+// the value clients send in their SPCs, without the private key.
+func CertificateHash(certificate []byte) ([]byte, error) {
+	der, err := certificateDER(certificate)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := x509.ParseCertificate(der); err != nil {
+		return nil, fmt.Errorf("application certificate: %w", err)
+	}
+	hash := sha1.Sum(der)
+	return hash[:], nil
+}
+
+func certificateDER(certificate []byte) ([]byte, error) {
+	block, _ := pem.Decode(certificate)
+	if block == nil {
+		return certificate, nil
+	}
+	if block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("application certificate: unsupported PEM type %s", block.Type)
+	}
+	return block.Bytes, nil
+}
+
+// decrypter returns the key unwrapping SPCK: Decrypter if set, Pri otherwise.
+func (c *Credential) decrypter() crypto.Decrypter {
+	if c.Decrypter != nil {
+		return c.Decrypter
+	}
+	return c.Pri
+}
+
+// CredentialSet indexes credentials by certificate hash. It is safe for concurrent use.
+//
+// Several credentials can be active at once, such as the old and the new credential during a rotation.
+type CredentialSet struct {
+	mu     sync.RWMutex
+	byHash map[string]*Credential
+}
+
+// NewCredentialSet returns a CredentialSet of credentials.
+func NewCredentialSet(credentials ...*Credential) (*CredentialSet, error) {
+	s := &CredentialSet{byHash: make(map[string]*Credential)}
+	for _, c := range credentials {
+		if err := s.Add(c); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Add adds c to the set, replacing the credential with the same certificate hash.
+func (s *CredentialSet) Add(c *Credential) error {
+	if len(c.CertificateHash) != sha1.Size {
+		return fmt.Errorf("credential certificate hash length %d, must be %d", len(c.CertificateHash), sha1.Size)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.byHash == nil {
+		s.byHash = make(map[string]*Credential)
+	}
+	s.byHash[string(c.CertificateHash)] = c
+	return nil
+}
+
+// Remove removes the credential of the certificate hash.
+func (s *CredentialSet) Remove(hash []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.byHash, string(hash))
+}
+
+// Lookup returns the credential of the certificate hash.
+func (s *CredentialSet) Lookup(hash []byte) (*Credential, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	c, ok := s.byHash[string(hash)]
+	return c, ok
+}
+
+// Len returns the number of credentials in the set.
+func (s *CredentialSet) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.byHash)
+}
+
+// PeekCertificateHash returns the certificate hash of an SPC message without decrypting it,
+// so the caller can choose the tenant or credential to answer it with.
+func PeekCertificateHash(playback []byte) ([]byte, error) {
+	container, err := parseSPCContainer(playback)
+	if err != nil {
+		return nil, err
+	}
+	return container.CertificateHash, nil
+}
+
+// credential returns the credential to decrypt container with: the credential of its certificate hash,
+// or the Pub, Pri (or Decrypter) and Ask of k if none matches.
+func (k *Ksm) credential(container *SPCContainer) (*Credential, error) {
+	if k.Credentials != nil {
+		if c, ok := k.Credentials.Lookup(container.CertificateHash); ok {
+			return c, nil
+		}
+	}
+	if k.Pri == nil && k.Decrypter == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCertificate, hex.EncodeToString(container.CertificateHash))
+	}
+	return &Credential{Pub: k.Pub, Pri: k.Pri, Decrypter: k.Decrypter, Ask: k.Ask}, nil
+}
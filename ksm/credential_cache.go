@@ -0,0 +1,144 @@
+package ksm
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultCredentialCacheTTL is how long a CredentialCache without TTL keeps a tenant.
+const DefaultCredentialCacheTTL = 5 * time.Minute
+
+// Tenant is a customer of the KSM, with its credentials parsed and ready to build its Ksm.
+type Tenant struct {
+	ID string
+
+	// Credential is the current credential, used for SPCs whose certificate hash isn't in Credentials.
+	Credential *Credential
+
+	// Credentials are the credentials with a known certificate hash, such as the old and the new
+	// credential during a rotation.
+	Credentials *CredentialSet
+
+	MaxDevices int
+}
+
+// TenantLoader loads and parses the credentials of a tenant, typically from a database.
+type TenantLoader func(ctx context.Context, id string) (*Tenant, error)
+
+// CredentialCache keeps the tenants returned by Load, so the certificate isn't parsed and the
+// private key isn't decrypted on every request. It is safe for concurrent use.
+//
+// Concurrent Gets of a tenant that isn't cached share one Load. Errors aren't cached.
+type CredentialCache struct {
+	Load TenantLoader
+
+	// TTL is how long a tenant is kept, DefaultCredentialCacheTTL if zero. A negative TTL disables the cache.
+	TTL time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*credentialCacheEntry
+
+	now func() time.Time
+}
+
+type credentialCacheEntry struct {
+	loaded  chan struct{} // Closed once tenant and err are set.
+	tenant  *Tenant
+	err     error
+	expires time.Time
+}
+
+// NewCredentialCache returns an empty CredentialCache of the tenants returned by load.
+func NewCredentialCache(ttl time.Duration, load TenantLoader) *CredentialCache {
+	return &CredentialCache{Load: load, TTL: ttl, entries: make(map[string]*credentialCacheEntry)}
+}
+
+// Get returns the cached tenant id, or loads it if it isn't cached or has expired.
+func (c *CredentialCache) Get(ctx context.Context, id string) (*Tenant, error) {
+	ttl := c.ttl()
+	if ttl < 0 {
+		return c.Load(ctx, id)
+	}
+
+	c.mu.Lock()
+	if c.entries == nil {
+		c.entries = make(map[string]*credentialCacheEntry)
+	}
+	e, ok := c.entries[id]
+	if ok && (!e.isLoaded() || c.clock().Before(e.expires)) {
+		c.mu.Unlock()
+		return e.wait(ctx)
+	}
+	e = &credentialCacheEntry{loaded: make(chan struct{})}
+	c.entries[id] = e
+	c.mu.Unlock()
+
+	// The load is shared, so it isn't canceled with the request that started it.
+	tenant, err := c.Load(context.WithoutCancel(ctx), id)
+
+	c.mu.Lock()
+	e.tenant, e.err = tenant, err
+	e.expires = c.clock().Add(ttl)
+	if err != nil && c.entries[id] == e {
+		delete(c.entries, id)
+	}
+	c.mu.Unlock()
+	close(e.loaded)
+
+	return tenant, err
+}
+
+// Invalidate removes tenant id from the cache, so the next Get loads it again.
+// Call it when the credentials of the tenant change.
+func (c *CredentialCache) Invalidate(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, id)
+}
+
+// Purge removes every tenant from the cache.
+func (c *CredentialCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]*credentialCacheEntry)
+}
+
+// Len returns the number of tenants in the cache, including expired ones not loaded again yet.
+func (c *CredentialCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+func (c *CredentialCache) ttl() time.Duration {
+	if c.TTL == 0 {
+		return DefaultCredentialCacheTTL
+	}
+	return c.TTL
+}
+
+func (c *CredentialCache) clock() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+func (e *credentialCacheEntry) isLoaded() bool {
+	select {
+	case <-e.loaded:
+		return true
+	default:
+		return false
+	}
+}
+
+func (e *credentialCacheEntry) wait(ctx context.Context) (*Tenant, error) {
+	select {
+	case <-e.loaded:
+		return e.tenant, e.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
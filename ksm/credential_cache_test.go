@@ -0,0 +1,174 @@
+package ksm
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/minsoo-gold/fairplay-ksm/cryptos"
+	"github.com/stretchr/testify/assert"
+)
+
+// loadTestTenant parses the test credential as an API server does for every request without cache.
+func loadTestTenant(ctx context.Context, id string) (*Tenant, error) {
+	priKey, err := cryptos.DecryptPriKey([]byte(pri), []byte("axissoft1@"))
+	if err != nil {
+		return nil, err
+	}
+	ask, _ := hex.DecodeString("2c6b3114ca8831cb01fb26a0646f96e8")
+	c, err := NewCredential(readBin(applicationCertificate), priKey, ask)
+	if err != nil {
+		return nil, err
+	}
+	credentials, err := NewCredentialSet(c)
+	if err != nil {
+		return nil, err
+	}
+	return &Tenant{ID: id, Credential: c, Credentials: credentials}, nil
+}
+
+func TestCredentialCache(t *testing.T) {
+	assert := assert.New(t)
+
+	var loads atomic.Int32
+	now := time.Unix(1700000000, 0)
+	c := NewCredentialCache(time.Minute, func(ctx context.Context, id string) (*Tenant, error) {
+		loads.Add(1)
+		return &Tenant{ID: id}, nil
+	})
+	c.now = func() time.Time { return now }
+
+	first, err := c.Get(context.Background(), "customer")
+	assert.NoError(err)
+	second, err := c.Get(context.Background(), "customer")
+	assert.NoError(err)
+	assert.Same(first, second)
+	assert.Equal(int32(1), loads.Load())
+
+	// An expired tenant is loaded again.
+	now = now.Add(time.Minute)
+	third, err := c.Get(context.Background(), "customer")
+	assert.NoError(err)
+	assert.NotSame(first, third)
+	assert.Equal(int32(2), loads.Load())
+
+	// So is an invalidated one.
+	c.Invalidate("customer")
+	assert.Equal(0, c.Len())
+	_, err = c.Get(context.Background(), "customer")
+	assert.NoError(err)
+	assert.Equal(int32(3), loads.Load())
+
+	c.Purge()
+	assert.Equal(0, c.Len())
+}
+
+func TestCredentialCache_Errors(t *testing.T) {
+	var loads atomic.Int32
+	c := NewCredentialCache(0, func(ctx context.Context, id string) (*Tenant, error) {
+		if loads.Add(1) == 1 {
+			return nil, errors.New("unavailable")
+		}
+		return &Tenant{ID: id}, nil
+	})
+
+	_, err := c.Get(context.Background(), "customer")
+	assert.ErrorContains(t, err, "unavailable")
+	tenant, err := c.Get(context.Background(), "customer")
+	assert.NoError(t, err)
+	assert.Equal(t, "customer", tenant.ID)
+}
+
+func TestCredentialCache_SharedLoad(t *testing.T) {
+	var loads atomic.Int32
+	release := make(chan struct{})
+	c := NewCredentialCache(0, func(ctx context.Context, id string) (*Tenant, error) {
+		loads.Add(1)
+		<-release
+		return &Tenant{ID: id}, nil
+	})
+
+	var wg sync.WaitGroup
+	tenants := make([]*Tenant, 8)
+	for i := range tenants {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tenants[i], _ = c.Get(context.Background(), "customer")
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), loads.Load())
+	for _, tenant := range tenants {
+		assert.Same(t, tenants[0], tenant)
+	}
+
+	// A request canceled while waiting doesn't wait for the load.
+	unblock := make(chan struct{})
+	defer close(unblock)
+	blocked := NewCredentialCache(0, func(ctx context.Context, id string) (*Tenant, error) {
+		<-unblock
+		return &Tenant{ID: id}, nil
+	})
+	go blocked.Get(context.Background(), "customer")
+	time.Sleep(10 * time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := blocked.Get(ctx, "customer")
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestCredentialCache_Disabled(t *testing.T) {
+	var loads atomic.Int32
+	c := NewCredentialCache(-1, func(ctx context.Context, id string) (*Tenant, error) {
+		loads.Add(1)
+		return &Tenant{ID: id}, nil
+	})
+	c.Get(context.Background(), "customer")
+	c.Get(context.Background(), "customer")
+	assert.Equal(t, int32(2), loads.Load())
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestGenCKC_CachedTenant(t *testing.T) {
+	c := NewCredentialCache(0, loadTestTenant)
+	tenant, err := c.Get(context.Background(), "customer")
+	assert.NoError(t, err)
+
+	k := &Ksm{Pub: tenant.Credential.Pub, Pri: tenant.Credential.Pri, Ask: tenant.Credential.Ask, Credentials: tenant.Credentials, Rck: RandomContentKey{}}
+	_, err = k.GenCKC(readBin("../testdata/FPS/spc1.bin"))
+	assert.NoError(t, err)
+}
+
+// BenchmarkCredentialCache compares loading the tenant credentials for every request with the cache.
+//
+//	go test ./ksm -run '^$' -bench CredentialCache
+func BenchmarkCredentialCache(b *testing.B) {
+	ctx := context.Background()
+
+	b.Run("uncached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := loadTestTenant(ctx, "customer"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("cached", func(b *testing.B) {
+		c := NewCredentialCache(time.Hour, loadTestTenant)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if _, err := c.Get(ctx, "customer"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	})
+}
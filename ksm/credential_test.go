@@ -0,0 +1,138 @@
+package ksm
+
+import (
+	"crypto"
+	cryptorand "crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const applicationCertificate = "../testdata/Development Credentials/fairplay.cer"
+
+func testCredential(t *testing.T) *Credential {
+	k := testKsm(t)
+
+	c, err := NewCredential(readBin(applicationCertificate), k.Pri, k.Ask)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestNewCredential(t *testing.T) {
+	assert := assert.New(t)
+
+	c := testCredential(t)
+	assert.Equal("9c4c1e0566f439156167198b18275d4cabbe6d1b", hex.EncodeToString(c.CertificateHash))
+
+	other, err := rsa.GenerateKey(cryptorand.Reader, 1024)
+	assert.NoError(err)
+	_, err = NewCredential(readBin(applicationCertificate), other, c.Ask)
+	assert.ErrorContains(err, "doesn't match the private key")
+
+	_, err = NewCredential([]byte(pub), c.Pri, c.Ask)
+	assert.ErrorContains(err, "unsupported PEM type CERTIFICATE REQUEST")
+
+	_, err = NewCredential(readBin(applicationCertificate), nil, c.Ask)
+	assert.ErrorContains(err, "private key required")
+	_, err = NewCredentialWithDecrypter(readBin(applicationCertificate), nil, c.Ask)
+	assert.ErrorContains(err, "private key required")
+}
+
+func TestPeekCertificateHash(t *testing.T) {
+	hash, err := PeekCertificateHash(readBin("../testdata/FPS/spc1.bin"))
+	assert.NoError(t, err)
+	assert.Equal(t, "9c4c1e0566f439156167198b18275d4cabbe6d1b", hex.EncodeToString(hash))
+
+	_, err = PeekCertificateHash([]byte{0, 0, 0, 1})
+	assert.ErrorIs(t, err, ErrSPCTruncated)
+}
+
+func TestCredentialSet(t *testing.T) {
+	assert := assert.New(t)
+
+	c := testCredential(t)
+	s, err := NewCredentialSet(c)
+	assert.NoError(err)
+	assert.Equal(1, s.Len())
+
+	found, ok := s.Lookup(c.CertificateHash)
+	assert.True(ok)
+	assert.Same(c, found)
+
+	assert.Error(s.Add(&Credential{CertificateHash: []byte{1, 2, 3}}))
+
+	s.Remove(c.CertificateHash)
+	_, ok = s.Lookup(c.CertificateHash)
+	assert.False(ok)
+}
+
+func TestGenCKC_Credentials(t *testing.T) {
+	c := testCredential(t)
+	playback := readBin("../testdata/FPS/spc1.bin")
+
+	// During a rotation the old and the new credential are both configured.
+	next := &Credential{Pri: c.Pri, Pub: c.Pub, Ask: c.Ask, CertificateHash: make([]byte, 20)}
+	credentials, err := NewCredentialSet(next, c)
+	assert.NoError(t, err)
+
+	k := &Ksm{Rck: RandomContentKey{}, Credentials: credentials}
+	_, err = k.GenCKC(playback)
+	assert.NoError(t, err)
+
+	credentials.Remove(c.CertificateHash)
+	_, err = k.GenCKC(playback)
+	assert.ErrorIs(t, err, ErrUnknownCertificate)
+
+	// Pub, Pri and Ask answer the SPCs matching no credential.
+	k.Pub, k.Pri, k.Ask = c.Pub, c.Pri, c.Ask
+	_, err = k.GenCKC(playback)
+	assert.NoError(t, err)
+}
+
+// remoteKey is a crypto.Decrypter hiding the private key, as a PKCS#11 token or a key daemon does.
+type remoteKey struct {
+	key   *rsa.PrivateKey
+	calls int
+}
+
+func (r *remoteKey) Public() crypto.PublicKey {
+	return &r.key.PublicKey
+}
+
+func (r *remoteKey) Decrypt(rand io.Reader, ciphertext []byte, opts crypto.DecrypterOpts) ([]byte, error) {
+	r.calls++
+	return r.key.Decrypt(rand, ciphertext, opts)
+}
+
+func TestGenCKC_Decrypter(t *testing.T) {
+	assert := assert.New(t)
+	c := testCredential(t)
+	playback := readBin("../testdata/FPS/spc1.bin")
+
+	d := &remoteKey{key: c.Pri}
+	remote, err := NewCredentialWithDecrypter(readBin(applicationCertificate), d, c.Ask)
+	assert.NoError(err)
+	assert.Nil(remote.Pri)
+	assert.Equal(c.CertificateHash, remote.CertificateHash)
+
+	credentials, _ := NewCredentialSet(remote)
+	k := &Ksm{Rck: RandomContentKey{}, Credentials: credentials}
+	_, err = k.GenCKC(playback)
+	assert.NoError(err)
+	assert.Equal(1, d.calls)
+
+	// Without credentials, Decrypter replaces Pri.
+	k = &Ksm{Rck: RandomContentKey{}, Pub: c.Pub, Decrypter: d, Ask: c.Ask}
+	_, err = k.GenCKC(playback)
+	assert.NoError(err)
+	assert.Equal(2, d.calls)
+
+	other, _ := rsa.GenerateKey(cryptorand.Reader, 1024)
+	_, err = NewCredentialWithDecrypter(readBin(applicationCertificate), other, c.Ask)
+	assert.ErrorContains(err, "doesn't match the private key")
+}
@@ -14,15 +14,27 @@ const NB_RD = 16
 
 const APPLE_TESTING_ASk = "d87ce7a26081de2e8eb8acef3a6dc179"
 
-type DFunction struct {
+// DFunction computes DASk, the key of [SK..R1], from R2 and the application service key (ASk).
+//
+// Production deployments must use the D function Apple ships to licensees,
+// loaded with NewProcessDFunction or LoadSharedDFunction.
+type DFunction interface {
+	Compute(R2 []byte, ask []byte) ([]byte, error)
 }
 
-func (d DFunction) Compute(R2 []byte, ask []byte) ([]byte, error) {
+// DefaultDFunctionSymbol is the symbol LoadSharedDFunction loads when none is given.
+const DefaultDFunctionSymbol = "fps_d_function"
+
+// ReferenceDFunction is the D function of the public reference algorithm.
+// It returns APPLE_TESTING_ASk as DASk for the ASk of Apple's test credentials.
+type ReferenceDFunction struct {
+}
+
+func (d ReferenceDFunction) Compute(R2 []byte, ask []byte) ([]byte, error) {
 
 	if hex.EncodeToString(ask) == APPLE_TESTING_ASk {
 		return hex.DecodeString(APPLE_TESTING_ASk)
 	}
-	print(hex.EncodeToString(ask))
 
 	hashValue, err := d.ComputeHashValue(R2)
 	if err != nil {
@@ -41,7 +53,7 @@ func (d DFunction) Compute(R2 []byte, ask []byte) ([]byte, error) {
 	return DASk, nil
 }
 
-func (d DFunction) ComputeHashValue(R2 []byte) ([]byte, error) {
+func (d ReferenceDFunction) ComputeHashValue(R2 []byte) ([]byte, error) {
 	var pad []byte
 	pad = make([]byte, 64, 64)
 
@@ -0,0 +1,97 @@
+//go:build cgo && dlopen
+
+package ksm
+
+/*
+#cgo LDFLAGS: -ldl
+#include <dlfcn.h>
+#include <stdint.h>
+#include <stdlib.h>
+
+typedef int (*d_function)(const uint8_t *r2, uint32_t r2_len, const uint8_t *ask, uint32_t ask_len, uint8_t *dask);
+
+static int call_d_function(void *fn, const uint8_t *r2, uint32_t r2_len, const uint8_t *ask, uint32_t ask_len, uint8_t *dask) {
+	return ((d_function)fn)(r2, r2_len, ask, ask_len, dask);
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"sync"
+	"unsafe"
+)
+
+// SharedDFunction is a DFunction exported by a shared library, loaded with dlopen.
+type SharedDFunction struct {
+	mu     sync.Mutex
+	handle unsafe.Pointer
+	fn     unsafe.Pointer
+}
+
+// LoadSharedDFunction loads the D function exported as symbol by the shared library at path.
+// An empty symbol loads DefaultDFunctionSymbol. The function must have the C signature
+//
+//	int symbol(const uint8_t *r2, uint32_t r2_len, const uint8_t *ask, uint32_t ask_len, uint8_t dask[16]);
+//
+// and return 0 on success. It may be called concurrently.
+func LoadSharedDFunction(path, symbol string) (*SharedDFunction, error) {
+	if symbol == "" {
+		symbol = DefaultDFunctionSymbol
+	}
+
+	cPath := C.CString(path)
+	defer C.free(unsafe.Pointer(cPath))
+	handle := C.dlopen(cPath, C.RTLD_NOW|C.RTLD_LOCAL)
+	if handle == nil {
+		return nil, fmt.Errorf("dlopen %s: %s", path, C.GoString(C.dlerror()))
+	}
+
+	cSymbol := C.CString(symbol)
+	defer C.free(unsafe.Pointer(cSymbol))
+	fn := C.dlsym(handle, cSymbol)
+	if fn == nil {
+		err := fmt.Errorf("dlsym %s: %s", symbol, C.GoString(C.dlerror()))
+		C.dlclose(handle)
+		return nil, err
+	}
+
+	return &SharedDFunction{handle: handle, fn: fn}, nil
+}
+
+// Compute implements DFunction.
+func (d *SharedDFunction) Compute(R2 []byte, ask []byte) ([]byte, error) {
+	d.mu.Lock()
+	fn := d.fn
+	d.mu.Unlock()
+	if fn == nil {
+		return nil, fmt.Errorf("shared d function is closed")
+	}
+	if len(R2) == 0 || len(ask) == 0 {
+		return nil, fmt.Errorf("shared d function: R2 and ASk must not be empty")
+	}
+
+	// cgo doesn't allow passing Go pointers to memory containing Go pointers, byte slices are fine.
+	dask := make([]byte, 16)
+	rc := C.call_d_function(fn,
+		(*C.uint8_t)(unsafe.Pointer(&R2[0])), C.uint32_t(len(R2)),
+		(*C.uint8_t)(unsafe.Pointer(&ask[0])), C.uint32_t(len(ask)),
+		(*C.uint8_t)(unsafe.Pointer(&dask[0])))
+	if rc != 0 {
+		return nil, fmt.Errorf("shared d function returned %d", int(rc))
+	}
+	return dask, nil
+}
+
+// Close unloads the shared library. Compute must not be running.
+func (d *SharedDFunction) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.handle == nil {
+		return nil
+	}
+	C.dlclose(d.handle)
+	d.handle, d.fn = nil, nil
+	return nil
+}
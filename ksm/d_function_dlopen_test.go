@@ -0,0 +1,47 @@
+//go:build cgo && dlopen
+
+package ksm
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadSharedDFunction(t *testing.T) {
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("no C compiler")
+	}
+
+	lib := filepath.Join(t.TempDir(), "libdfunction.so")
+	out, err := exec.Command(cc, "-shared", "-fPIC", "-o", lib, "testdata/d_function_standin.c").CombinedOutput()
+	if err != nil {
+		t.Fatalf("cc: %v\n%s", err, out)
+	}
+
+	_, err = LoadSharedDFunction(lib, "missing_symbol")
+	assert.Error(t, err)
+
+	d, err := LoadSharedDFunction(lib, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	// The stand-in returns the hash value of the reference D function.
+	for _, test := range testsData {
+		dask, err := d.Compute(test.in, make([]byte, 16))
+		assert.NoError(t, err)
+		assert.Equal(t, test.out, dask)
+	}
+
+	_, err = d.Compute(nil, make([]byte, 16))
+	assert.Error(t, err)
+
+	d.Close()
+	_, err = d.Compute(testsData[0].in, make([]byte, 16))
+	assert.Error(t, err)
+}
@@ -0,0 +1,24 @@
+//go:build !cgo || !dlopen
+
+package ksm
+
+import "errors"
+
+// SharedDFunction is a DFunction exported by a shared library, loaded with dlopen.
+// It is only available in cgo builds with the dlopen build tag.
+type SharedDFunction struct{}
+
+// LoadSharedDFunction returns an error, build with cgo and the dlopen build tag to load shared libraries.
+func LoadSharedDFunction(path, symbol string) (*SharedDFunction, error) {
+	return nil, errors.New("shared d function requires a cgo build with the dlopen build tag")
+}
+
+// Compute implements DFunction.
+func (d *SharedDFunction) Compute(R2 []byte, ask []byte) ([]byte, error) {
+	return nil, errors.New("shared d function requires a cgo build with the dlopen build tag")
+}
+
+// Close implements io.Closer.
+func (d *SharedDFunction) Close() error {
+	return nil
+}
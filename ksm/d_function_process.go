@@ -0,0 +1,147 @@
+package ksm
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultDFunctionTimeout is the time a ProcessDFunction waits for an answer when Timeout is zero.
+const DefaultDFunctionTimeout = 5 * time.Second
+
+// ProcessDFunction is a DFunction computed by an external program, such as a wrapper of the
+// D function Apple ships to licensees. The program is started once and answers one request per line:
+//
+//	request:  <hex R2> <hex ASk>\n
+//	response: <hex DASk>\n, or error <message>\n
+//
+// Requests are sent one at a time. The program is restarted by the next Compute if it exits,
+// writes an unexpected response or doesn't answer within Timeout.
+type ProcessDFunction struct {
+	Path    string
+	Args    []string
+	Timeout time.Duration // The maximum time to answer a request, DefaultDFunctionTimeout if zero.
+
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+}
+
+// NewProcessDFunction starts the program at path with args and returns its ProcessDFunction.
+func NewProcessDFunction(path string, args ...string) (*ProcessDFunction, error) {
+	d := &ProcessDFunction{Path: path, Args: args}
+	if err := d.start(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Compute implements DFunction.
+func (d *ProcessDFunction) Compute(R2 []byte, ask []byte) ([]byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.cmd == nil {
+		if err := d.start(); err != nil {
+			return nil, err
+		}
+	}
+
+	line, err := d.roundTrip(hex.EncodeToString(R2) + " " + hex.EncodeToString(ask) + "\n")
+	if err != nil {
+		d.stop()
+		return nil, fmt.Errorf("d function process: %w", err)
+	}
+
+	if message, ok := strings.CutPrefix(line, "error "); ok {
+		return nil, fmt.Errorf("d function process: %s", message)
+	}
+
+	dask, err := hex.DecodeString(line)
+	if err != nil || len(dask) != 16 {
+		d.stop()
+		return nil, fmt.Errorf("d function process: unexpected response %q", line)
+	}
+	return dask, nil
+}
+
+// Close stops the program.
+func (d *ProcessDFunction) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.stop()
+	return nil
+}
+
+func (d *ProcessDFunction) start() error {
+	cmd := exec.Command(d.Path, d.Args...)
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("d function process: %w", err)
+	}
+
+	d.cmd = cmd
+	d.stdin = stdin
+	d.stdout = bufio.NewReader(stdout)
+	return nil
+}
+
+func (d *ProcessDFunction) stop() {
+	if d.cmd == nil {
+		return
+	}
+	d.stdin.Close()
+	d.cmd.Process.Kill()
+	d.cmd.Wait()
+	d.cmd = nil
+}
+
+// roundTrip writes request and reads the response line, or gives up after the timeout.
+// The caller stops the program on error, which unblocks the pending read.
+func (d *ProcessDFunction) roundTrip(request string) (string, error) {
+	type result struct {
+		line string
+		err  error
+	}
+
+	stdin, stdout := d.stdin, d.stdout
+	done := make(chan result, 1)
+	go func() {
+		if _, err := io.WriteString(stdin, request); err != nil {
+			done <- result{err: err}
+			return
+		}
+		line, err := stdout.ReadString('\n')
+		done <- result{line: strings.TrimSpace(line), err: err}
+	}()
+
+	timeout := d.Timeout
+	if timeout == 0 {
+		timeout = DefaultDFunctionTimeout
+	}
+
+	select {
+	case r := <-done:
+		return r.line, r.err
+	case <-time.After(timeout):
+		return "", errors.New("timed out")
+	}
+}
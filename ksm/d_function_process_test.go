@@ -0,0 +1,107 @@
+package ksm
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minsoo-gold/fairplay-ksm/cryptos"
+	"github.com/minsoo-gold/fairplay-ksm/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestDFunctionHelperProcess isn't a real test. It is the external D function program
+// started by the ProcessDFunction tests, answering with ReferenceDFunction.
+func TestDFunctionHelperProcess(t *testing.T) {
+	mode := os.Getenv("KSM_D_FUNCTION_HELPER")
+	if mode == "" {
+		return
+	}
+	defer os.Exit(0)
+
+	// Only the responses may be written to stdout, the package logs go to stderr.
+	out := os.Stdout
+	logger.SetLogger(log.New(os.Stderr, "", 0))
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		if mode == "hang" {
+			time.Sleep(time.Hour)
+		}
+
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			fmt.Fprintln(out, "error malformed request")
+			continue
+		}
+		R2, _ := hex.DecodeString(fields[0])
+		ask, _ := hex.DecodeString(fields[1])
+
+		dask, err := ReferenceDFunction{}.Compute(R2, ask)
+		if err != nil {
+			fmt.Fprintln(out, "error", err)
+			continue
+		}
+		fmt.Fprintln(out, hex.EncodeToString(dask))
+	}
+}
+
+func newHelperDFunction(t *testing.T, mode string) *ProcessDFunction {
+	t.Setenv("KSM_D_FUNCTION_HELPER", mode)
+	d, err := NewProcessDFunction(os.Args[0], "-test.run=^TestDFunctionHelperProcess$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { d.Close() })
+	return d
+}
+
+func TestProcessDFunction(t *testing.T) {
+	assert := assert.New(t)
+
+	d := newHelperDFunction(t, "reference")
+	ask, _ := hex.DecodeString("2c6b3114ca8831cb01fb26a0646f96e8")
+
+	for _, test := range testsData {
+		want, err := cryptos.AESECBEncrypt(ask, test.out)
+		assert.NoError(err)
+
+		dask, err := d.Compute(test.in, ask)
+		assert.NoError(err)
+		assert.Equal(want, dask)
+	}
+
+	// An error answer keeps the program running.
+	cmd := d.cmd
+	_, err := d.Compute(nil, ask)
+	assert.ErrorContains(err, "malformed request")
+	assert.Same(cmd, d.cmd)
+
+	// The program is restarted after it exits.
+	d.cmd.Process.Kill()
+	_, err = d.Compute(testsData[0].in, ask)
+	assert.Error(err)
+	_, err = d.Compute(testsData[0].in, ask)
+	assert.NoError(err)
+}
+
+func TestProcessDFunction_Timeout(t *testing.T) {
+	d := newHelperDFunction(t, "hang")
+	d.Timeout = 100 * time.Millisecond
+
+	_, err := d.Compute(testsData[0].in, make([]byte, 16))
+	assert.ErrorContains(t, err, "timed out")
+	assert.Nil(t, d.cmd, "a program that timed out must be stopped")
+}
+
+func TestGenCKC_ProcessDFunction(t *testing.T) {
+	k := testKsm(t)
+	k.D = newHelperDFunction(t, "reference")
+	_, err := k.GenCKC(readBin("../testdata/FPS/spc1.bin"))
+	assert.NoError(t, err)
+}
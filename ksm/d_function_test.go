@@ -79,7 +79,7 @@ var testsData = []testHashValue{
 }
 
 func TestDFunctionComputeHashValue(t *testing.T) {
-	d := DFunction{}
+	d := ReferenceDFunction{}
 	for _, test := range testsData {
 
 		actualOut, err := d.ComputeHashValue(test.in)
@@ -0,0 +1,133 @@
+package ksm
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Device represents a device licensed for a user.
+type Device struct {
+	ID        []byte    // The HU, the 20-byte hashed device ID of [SK..R1].
+	FirstSeen time.Time // The time of the first license of the device.
+	LastSeen  time.Time // The time of the last license of the device.
+}
+
+// DeviceRegistry records the devices licensed for each user. Implementations must be safe for concurrent use.
+type DeviceRegistry interface {
+	// RegisterDevice records a license of deviceID for userID. If deviceID is new for userID and
+	// userID already has max devices, RegisterDevice records nothing and returns ErrDeviceLimit.
+	// A max of zero is unlimited.
+	RegisterDevice(ctx context.Context, userID string, deviceID []byte, max int) error
+	// Devices returns the devices of userID, oldest first.
+	Devices(ctx context.Context, userID string) ([]Device, error)
+	// RemoveDevice deregisters deviceID from userID. It returns ErrDeviceNotFound if deviceID isn't registered.
+	RemoveDevice(ctx context.Context, userID string, deviceID []byte) error
+}
+
+// MemoryDeviceRegistry is a DeviceRegistry kept in memory, for tests and single instance deployments.
+// Its devices are lost when the process exits, so a limit is only enforced for the lifetime of the process
+// unless the devices are saved with Users and restored with Restore.
+type MemoryDeviceRegistry struct {
+	mu    sync.Mutex
+	users map[string]map[string]*Device
+}
+
+// NewMemoryDeviceRegistry creates an empty MemoryDeviceRegistry.
+func NewMemoryDeviceRegistry() *MemoryDeviceRegistry {
+	return &MemoryDeviceRegistry{users: make(map[string]map[string]*Device)}
+}
+
+// RegisterDevice implements DeviceRegistry.
+func (r *MemoryDeviceRegistry) RegisterDevice(ctx context.Context, userID string, deviceID []byte, max int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	devices := r.users[userID]
+	if device, ok := devices[hex.EncodeToString(deviceID)]; ok {
+		device.LastSeen = now
+		return nil
+	}
+	if max > 0 && len(devices) >= max {
+		return ErrDeviceLimit
+	}
+
+	if devices == nil {
+		devices = make(map[string]*Device)
+		r.users[userID] = devices
+	}
+	devices[hex.EncodeToString(deviceID)] = &Device{
+		ID:        append([]byte{}, deviceID...),
+		FirstSeen: now,
+		LastSeen:  now,
+	}
+	return nil
+}
+
+// Devices implements DeviceRegistry.
+func (r *MemoryDeviceRegistry) Devices(ctx context.Context, userID string) ([]Device, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.devices(userID), nil
+}
+
+// devices returns the devices of userID, oldest first. r.mu must be held.
+func (r *MemoryDeviceRegistry) devices(userID string) []Device {
+	var devices []Device
+	for _, device := range r.users[userID] {
+		devices = append(devices, *device)
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		if devices[i].FirstSeen.Equal(devices[j].FirstSeen) {
+			return bytes.Compare(devices[i].ID, devices[j].ID) < 0
+		}
+		return devices[i].FirstSeen.Before(devices[j].FirstSeen)
+	})
+	return devices
+}
+
+// Users returns the devices of every user with at least one device, oldest first.
+func (r *MemoryDeviceRegistry) Users() map[string][]Device {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	users := make(map[string][]Device, len(r.users))
+	for userID := range r.users {
+		if devices := r.devices(userID); len(devices) > 0 {
+			users[userID] = devices
+		}
+	}
+	return users
+}
+
+// Restore replaces the devices of the users of users, for example with the devices returned by Users.
+func (r *MemoryDeviceRegistry) Restore(users map[string][]Device) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for userID, devices := range users {
+		m := make(map[string]*Device, len(devices))
+		for _, device := range devices {
+			device.ID = append([]byte{}, device.ID...)
+			m[hex.EncodeToString(device.ID)] = &device
+		}
+		r.users[userID] = m
+	}
+}
+
+// RemoveDevice implements DeviceRegistry.
+func (r *MemoryDeviceRegistry) RemoveDevice(ctx context.Context, userID string, deviceID []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := hex.EncodeToString(deviceID)
+	if _, ok := r.users[userID][key]; !ok {
+		return ErrDeviceNotFound
+	}
+	delete(r.users[userID], key)
+	return nil
+}
@@ -0,0 +1,103 @@
+package ksm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryDeviceRegistry(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	r := NewMemoryDeviceRegistry()
+	one, two := []byte("device-1"), []byte("device-2")
+
+	assert.NoError(r.RegisterDevice(ctx, "user", one, 1))
+	assert.NoError(r.RegisterDevice(ctx, "user", one, 1), "a known device is always allowed")
+	assert.True(errors.Is(r.RegisterDevice(ctx, "user", two, 1), ErrDeviceLimit))
+	assert.NoError(r.RegisterDevice(ctx, "other", two, 1), "the limit is per user")
+	assert.NoError(r.RegisterDevice(ctx, "user", two, 0), "zero is unlimited")
+
+	devices, err := r.Devices(ctx, "user")
+	assert.NoError(err)
+	assert.Len(devices, 2)
+	assert.Equal(one, devices[0].ID)
+	assert.False(devices[0].LastSeen.Before(devices[0].FirstSeen))
+
+	assert.NoError(r.RemoveDevice(ctx, "user", one))
+	assert.True(errors.Is(r.RemoveDevice(ctx, "user", one), ErrDeviceNotFound))
+	assert.True(errors.Is(r.RemoveDevice(ctx, "nobody", one), ErrDeviceNotFound))
+
+	devices, err = r.Devices(ctx, "user")
+	assert.NoError(err)
+	assert.Len(devices, 1)
+	assert.Equal(two, devices[0].ID)
+
+	// The devices restored in another registry count towards the limit.
+	users := r.Users()
+	assert.Len(users, 2)
+	restored := NewMemoryDeviceRegistry()
+	restored.Restore(users)
+	assert.Equal(users, restored.Users())
+	assert.True(errors.Is(restored.RegisterDevice(ctx, "other", one, 1), ErrDeviceLimit))
+}
+
+func TestGenCKC_DeviceLimit(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	playback := readBin("../testdata/FPS/spc1.bin")
+
+	registry := NewMemoryDeviceRegistry()
+	assert.NoError(registry.RegisterDevice(ctx, "user", []byte("another device"), 0))
+
+	k := testKsm(t)
+	k.Devices, k.MaxDevices = registry, 1
+
+	_, err := k.GenCKCWithOptions(playback, CKCOptions{})
+	var policyErr *PolicyError
+	assert.True(errors.As(err, &policyErr), "requests without user are refused when devices are limited")
+	assert.Contains(policyErr.Reason, "user ID is required")
+
+	_, err = k.GenCKCWithOptions(playback, CKCOptions{UserID: "user"})
+	assert.True(errors.As(err, &policyErr))
+	assert.Contains(policyErr.Reason, "maximum of 1 devices")
+
+	assert.NoError(registry.RemoveDevice(ctx, "user", []byte("another device")))
+	_, err = k.GenCKCWithOptions(playback, CKCOptions{UserID: "user"})
+	assert.NoError(err)
+
+	devices, err := registry.Devices(ctx, "user")
+	assert.NoError(err)
+	assert.Len(devices, 1)
+	assert.Len(devices[0].ID, 20)
+
+	_, err = k.GenCKCWithOptions(playback, CKCOptions{UserID: "user"})
+	assert.NoError(err, "the registered device is still allowed")
+}
+
+func TestGenCKC_DeviceRegisteredAfterCKC(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	e, k := testEmulator(t)
+	registry := NewMemoryDeviceRegistry()
+	k.Devices, k.MaxDevices = registry, 1
+
+	// A missing return request TLLV fails the request after the policy checks.
+	spc := e.build(t, spcRequest{AssetID: []byte("asset"), ReturnRequest: []uint64{0x1234}})
+	_, err := k.GenCKCWithOptions(spc.Playback, CKCOptions{UserID: "user"})
+	assert.ErrorIs(err, ErrTLLVMissing)
+	devices, err := registry.Devices(ctx, "user")
+	assert.NoError(err)
+	assert.Empty(devices, "a failed request doesn't use up a device")
+
+	_, err = k.GenCKCWithOptions(e.build(t, spcRequest{AssetID: []byte("asset")}).Playback, CKCOptions{UserID: "user"})
+	assert.NoError(err)
+	devices, err = registry.Devices(ctx, "user")
+	assert.NoError(err)
+	assert.Len(devices, 1)
+}
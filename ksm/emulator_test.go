@@ -0,0 +1,280 @@
+package ksm
+
+import (
+	"crypto/md5"
+	cryptorand "crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/minsoo-gold/fairplay-ksm/cryptos"
+	"github.com/stretchr/testify/assert"
+)
+
+// spcEmulator builds SPCs the way an FPS client does, for the credential of Pub and Ask.
+// It is the reverse of ParseSPC and decryptSKR1Payload.
+type spcEmulator struct {
+	Pub             *rsa.PublicKey
+	Ask             []byte
+	CertificateHash []byte    // Sent in the SPC header, zero bytes if nil.
+	D               DFunction // ReferenceDFunction if nil.
+}
+
+// spcRequest represents the content of an emulated SPC. Zero fields take the values of a typical client.
+type spcRequest struct {
+	AssetID            []byte
+	TransactionID      uint64   // Omitted if zero.
+	ProtocolVersion    uint32   // 1 if zero.
+	SupportedVersions  []uint32 // Only ProtocolVersion if nil.
+	PlaybackState      *MediaPlaybackState
+	StreamingIndicator StreamingIndicator // Omitted if zero.
+	ReturnRequest      []uint64           // The asset ID tag if nil.
+	HU                 []byte             // Random if nil.
+
+	Extra []TLLVBlock     // Appended after the TLLVs above, such as unknown or duplicated tags.
+	Omit  map[uint64]bool // Tags to leave out, to build malformed SPCs.
+}
+
+// emulatedSPC is an SPC message with the client secrets needed to check the CKC answering it.
+type emulatedSPC struct {
+	Playback  []byte
+	Secrets   CKCSecrets
+	HU        []byte
+	R2        []byte
+	Integrity []byte
+}
+
+func (e spcEmulator) build(t *testing.T, req spcRequest) *emulatedSPC {
+	t.Helper()
+
+	spc := &emulatedSPC{
+		Secrets: CKCSecrets{
+			SK:             randomBytes(16),
+			R1:             randomBytes(44),
+			AntiReplaySeed: randomBytes(16),
+		},
+		HU:        req.HU,
+		R2:        randomBytes(21),
+		Integrity: randomBytes(16),
+	}
+	if spc.HU == nil {
+		spc.HU = randomBytes(20)
+	}
+
+	// [SK..R1] is encrypted with DASk, the D function output of R2 and ASk.
+	d := e.D
+	if d == nil {
+		d = ReferenceDFunction{}
+	}
+	dask, err := d.Compute(spc.R2, e.Ask)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var skr1 []byte
+	skr1 = append(skr1, spc.Secrets.SK...)
+	skr1 = append(skr1, spc.HU...)
+	skr1 = append(skr1, spc.Secrets.R1...)
+	skr1 = append(skr1, spc.Integrity...)
+	skr1IV := randomBytes(16)
+	encryptedSKR1, err := cryptos.AESCBCEncrypt(dask, skr1IV, skr1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	version := req.ProtocolVersion
+	if version == 0 {
+		version = 1
+	}
+	supported := req.SupportedVersions
+	if supported == nil {
+		supported = []uint32{version}
+	}
+	returnRequest := req.ReturnRequest
+	if returnRequest == nil {
+		returnRequest = []uint64{tagAssetID}
+	}
+
+	blocks := []TLLVBlock{
+		*NewTLLVBlock(tagSessionKeyR1, append(skr1IV, encryptedSKR1...)),
+		*NewTLLVBlock(tagSessionKeyR1Integrity, spc.Integrity),
+		*NewTLLVBlock(tagAntiReplaySeed, spc.Secrets.AntiReplaySeed),
+		*NewTLLVBlock(tagR2, spc.R2),
+		*NewTLLVBlock(tagAssetID, req.AssetID),
+		*NewTLLVBlock(tagReturnRequest, uint64Bytes(returnRequest...)),
+		*NewTLLVBlock(tagProtocolVersionUsed, uint32Bytes(version)),
+		*NewTLLVBlock(tagProtocolVersionsSupported, uint32Bytes(supported...)),
+	}
+	if req.TransactionID != 0 {
+		blocks = append(blocks, *NewTLLVBlock(tagTransactionID, uint64Bytes(req.TransactionID)))
+	}
+	if state := req.PlaybackState; state != nil {
+		value := make([]byte, 16)
+		binary.BigEndian.PutUint32(value[0:4], uint32(state.CreationTime.Unix()))
+		binary.BigEndian.PutUint32(value[4:8], uint32(state.State))
+		binary.BigEndian.PutUint64(value[8:16], state.SessionID)
+		blocks = append(blocks, *NewTLLVBlock(tagMediaPlaybackState, value))
+	}
+	if req.StreamingIndicator != 0 {
+		blocks = append(blocks, *NewTLLVBlock(tagTreamingIndicator, uint64Bytes(uint64(req.StreamingIndicator))))
+	}
+	blocks = append(blocks, req.Extra...)
+
+	var payload []byte
+	for _, block := range blocks {
+		if req.Omit[block.Tag] {
+			continue
+		}
+		out, err := block.Serialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		payload = append(payload, out...)
+	}
+
+	// The payload is encrypted with SPCK, itself wrapped with the certificate public key.
+	spck := randomBytes(16)
+	iv := randomBytes(16)
+	encryptedPayload, err := cryptos.AESCBCEncrypt(spck, iv, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrappedKey, err := rsa.EncryptOAEP(sha1.New(), cryptorand.Reader, e.Pub, spck, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spcVersion := uint32(SPCVersion1)
+	if len(wrappedKey) == spcLayouts[SPCVersion2].wrappedKeyLength {
+		spcVersion = SPCVersion2
+	}
+	certificateHash := e.CertificateHash
+	if certificateHash == nil {
+		certificateHash = make([]byte, 20)
+	}
+
+	spc.Playback = uint32Bytes(spcVersion, 0)
+	spc.Playback = append(spc.Playback, iv...)
+	spc.Playback = append(spc.Playback, wrappedKey...)
+	spc.Playback = append(spc.Playback, certificateHash...)
+	spc.Playback = append(spc.Playback, uint32Bytes(uint32(len(encryptedPayload)))...)
+	spc.Playback = append(spc.Playback, encryptedPayload...)
+	return spc
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	cryptorand.Read(b)
+	return b
+}
+
+func uint32Bytes(values ...uint32) []byte {
+	out := make([]byte, 4*len(values))
+	for i, v := range values {
+		binary.BigEndian.PutUint32(out[4*i:], v)
+	}
+	return out
+}
+
+func uint64Bytes(values ...uint64) []byte {
+	out := make([]byte, 8*len(values))
+	for i, v := range values {
+		binary.BigEndian.PutUint64(out[8*i:], v)
+	}
+	return out
+}
+
+// testEmulator returns the emulator and the Ksm of the test credential.
+func testEmulator(t testing.TB) (spcEmulator, *Ksm) {
+	k := testKsm(t)
+	return spcEmulator{Pub: k.Pub, Ask: k.Ask}, k
+}
+
+func TestEmulatedSPC(t *testing.T) {
+	assert := assert.New(t)
+
+	e, k := testEmulator(t)
+	state := &MediaPlaybackState{CreationTime: time.Unix(1700000000, 0), State: PlaybackStatePlaying, SessionID: 42}
+	unknown := *NewTLLVBlock(0x1122334455667788, []byte("new tllv"))
+	spc := e.build(t, spcRequest{
+		AssetID:            []byte("emulated-asset"),
+		TransactionID:      7,
+		PlaybackState:      state,
+		StreamingIndicator: StreamingIndicatorAVAdapter,
+		ReturnRequest:      []uint64{tagAssetID, tagTransactionID},
+		Extra:              []TLLVBlock{unknown},
+	})
+
+	container, err := ParseSPC(spc.Playback, k.Pub, k.Pri)
+	assert.NoError(err)
+	decoded, err := DecodeSPC(container)
+	assert.NoError(err)
+	assert.Equal([]byte("emulated-asset"), decoded.AssetID)
+	assert.Equal(uint64(7), decoded.TransactionID)
+	assert.Equal(state, decoded.PlaybackState)
+	assert.Equal(OutputAVAdapter, decoded.StreamingIndicator.Output())
+	assert.Equal(spc.R2, decoded.R2)
+	if assert.Len(decoded.Unknown, 1) {
+		assert.Equal(unknown.Value, decoded.Unknown[0].Value)
+	}
+
+	out, err := k.GenCKC(spc.Playback)
+	assert.NoError(err)
+	ckc, err := DecodeCKC(out, spc.Secrets)
+	assert.NoError(err)
+
+	key := md5.Sum([]byte("emulated-asset"))
+	assert.Equal(key[:], ckc.ContentKey)
+	assert.Len(ckc.ReturnRequest, 2)
+	assert.NotNil(ckc.Duration)
+}
+
+func TestEmulatedSPC_Version2(t *testing.T) {
+	_, k := testEmulator(t)
+	priKey, err := rsa.GenerateKey(cryptorand.Reader, 2048)
+	assert.NoError(t, err)
+
+	e := spcEmulator{Pub: &priKey.PublicKey, Ask: k.Ask}
+	spc := e.build(t, spcRequest{AssetID: []byte("asset-2048")})
+	assert.Equal(t, uint32(SPCVersion2), binary.BigEndian.Uint32(spc.Playback[0:4]))
+
+	k.Pub, k.Pri = &priKey.PublicKey, priKey
+	out, err := k.GenCKC(spc.Playback)
+	assert.NoError(t, err)
+	_, err = DecodeCKC(out, spc.Secrets)
+	assert.NoError(t, err)
+}
+
+func TestEmulatedSPC_EdgeCases(t *testing.T) {
+	e, k := testEmulator(t)
+
+	tests := []struct {
+		name string
+		req  spcRequest
+		err  error
+	}{
+		{"missing R2", spcRequest{AssetID: []byte("asset"), Omit: map[uint64]bool{tagR2: true}}, ErrTLLVMissing},
+		{"short asset ID", spcRequest{AssetID: []byte("a")}, ErrTLLVBlockLength},
+		{"absent return request tag", spcRequest{AssetID: []byte("asset"), ReturnRequest: []uint64{tagTransactionID}}, ErrTLLVMissing},
+		{"unsupported protocol version", spcRequest{AssetID: []byte("asset"), ProtocolVersion: 2}, ErrProtocolVersion},
+		{"short playback state", spcRequest{AssetID: []byte("asset"), Extra: []TLLVBlock{*NewTLLVBlock(tagMediaPlaybackState, make([]byte, 8))}}, ErrTLLVBlockLength},
+	}
+	for _, test := range tests {
+		_, err := k.GenCKC(e.build(t, test.req).Playback)
+		assert.True(t, errors.Is(err, test.err), "%s: %v", test.name, err)
+	}
+
+	// [SK..R1] encrypted with another ASk fails the integrity check.
+	other := e
+	other.Ask = randomBytes(16)
+	_, err := k.GenCKC(other.build(t, spcRequest{AssetID: []byte("asset")}).Playback)
+	assert.ErrorContains(t, err, "integrity")
+
+	// A duplicated tag is rejected when the policy says so.
+	duplicated := spcRequest{AssetID: []byte("asset"), Extra: []TLLVBlock{*NewTLLVBlock(tagAssetID, []byte("other"))}}
+	k.DuplicateTags = DuplicateTagReject
+	_, err = k.GenCKC(e.build(t, duplicated).Playback)
+	assert.True(t, errors.Is(err, ErrDuplicateTag))
+}
@@ -0,0 +1,93 @@
+package ksm
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned while parsing a malformed SPC message.
+// Callers can match them with errors.Is and treat them as client errors.
+var (
+	// ErrSPCTruncated is returned when the SPC message is shorter than its fixed-size header.
+	ErrSPCTruncated = errors.New("spc container truncated")
+
+	// ErrSPCVersion is returned when the SPC message version is not supported.
+	ErrSPCVersion = errors.New("spc version is not supported")
+
+	// ErrSPCPayloadLength is returned when the SPC payload length field doesn't match the message.
+	ErrSPCPayloadLength = errors.New("spc payload length is invalid")
+
+	// ErrTLLVOverrun is returned when a TLLV block extends beyond the end of the SPC payload.
+	ErrTLLVOverrun = errors.New("tllv block overruns spc payload")
+
+	// ErrTLLVBlockLength is returned when a TLLV block length is smaller than its value length.
+	ErrTLLVBlockLength = errors.New("tllv block length is smaller than value length")
+
+	// ErrTLLVMissing is returned when a TLLV block required to generate the CKC is absent or malformed.
+	ErrTLLVMissing = errors.New("required tllv block is missing")
+)
+
+// ErrDuplicateTag is matched by every *DuplicateTagError.
+var ErrDuplicateTag = errors.New("duplicate tllv tag")
+
+// DuplicateTagError reports a TLLV tag present more than once in an SPC payload.
+type DuplicateTagError struct {
+	Tag     uint64
+	Indexes []int // The indexes of the blocks in SPCContainer.Blocks.
+}
+
+func (e *DuplicateTagError) Error() string {
+	return fmt.Sprintf("%s: tag %x at blocks %v", ErrDuplicateTag.Error(), e.Tag, e.Indexes)
+}
+
+// Is reports whether target is ErrDuplicateTag.
+func (e *DuplicateTagError) Is(target error) bool {
+	return target == ErrDuplicateTag
+}
+
+// ErrSPCReplayed is returned by a ReplayGuard when the SPC was already seen.
+var ErrSPCReplayed = errors.New("spc was already used")
+
+// ErrSPCExpired is returned by a ReplayGuard when the SPC creation time is outside the accepted window.
+var ErrSPCExpired = errors.New("spc creation time is outside the accepted window")
+
+// ErrProtocolVersion is returned when the SPC was built with a protocol version the server doesn't accept.
+var ErrProtocolVersion = errors.New("spc protocol version is not supported")
+
+// ErrContentKeyType is returned when a content key type is unknown or doesn't match the lease and rental durations.
+var ErrContentKeyType = errors.New("content key type doesn't match durations")
+
+// ErrDeviceLimit is returned by a DeviceRegistry when a user already has the maximum number of devices.
+var ErrDeviceLimit = errors.New("device limit reached")
+
+// ErrDeviceNotFound is returned by a DeviceRegistry when a device isn't registered for a user.
+var ErrDeviceNotFound = errors.New("device not found")
+
+// ErrPolicyDenied is matched by every *PolicyError.
+var ErrPolicyDenied = errors.New("license denied by asset policy")
+
+// PolicyError reports why the asset policy refused to issue a CKC.
+type PolicyError struct {
+	Reason string
+}
+
+func (e *PolicyError) Error() string {
+	return ErrPolicyDenied.Error() + ": " + e.Reason
+}
+
+// Is reports whether target is ErrPolicyDenied.
+func (e *PolicyError) Is(target error) bool {
+	return target == ErrPolicyDenied
+}
+
+// ErrUnknownCertificate is returned when no configured credential matches the certificate hash of an SPC.
+var ErrUnknownCertificate = errors.New("spc certificate hash doesn't match any credential")
+
+// ErrCKCMalformed is returned by DecodeCKC when the CKC message or its payload is malformed.
+var ErrCKCMalformed = errors.New("ckc is malformed")
+
+// ErrAssetNotFound is returned by a ContentKeyProvider when the asset of the SPC is unknown.
+var ErrAssetNotFound = errors.New("asset not found")
+
+// ErrAssetDisabled is returned by a ContentKeyProvider when no license may be issued for the asset.
+var ErrAssetDisabled = errors.New("asset is disabled")
@@ -0,0 +1,165 @@
+package ksm
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/minsoo-gold/fairplay-ksm/cryptos"
+	"github.com/minsoo-gold/fairplay-ksm/logger"
+)
+
+// The fuzz targets only check that no input panics, and that serialized TLLVs parse back unchanged.
+// Run one with: go test ./ksm -run '^$' -fuzz FuzzParseSPCContainer
+
+// quietFuzz discards the package logs while fuzzing: a fuzz worker blocks once its stdout pipe is full.
+func quietFuzz(f *testing.F) {
+	logger.SetLogger(log.New(io.Discard, "", 0))
+	f.Cleanup(func() { logger.SetLogger(log.New(os.Stdout, "", 0)) })
+}
+
+// testdataFiles returns the captured files matching pattern in testdata/FPS and testdata/FPS-lease.
+func testdataFiles(f *testing.F, pattern string) [][]byte {
+	var files [][]byte
+	for _, dir := range []string{"../testdata/FPS", "../testdata/FPS-lease"} {
+		paths, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			f.Fatal(err)
+		}
+		for _, path := range paths {
+			files = append(files, readBin(path))
+		}
+	}
+	return files
+}
+
+// spcPayloads returns the decrypted payloads of the captured SPCs.
+func spcPayloads(f *testing.F) [][]byte {
+	priKey := testKsm(f).Pri
+
+	var payloads [][]byte
+	for _, playback := range testdataFiles(f, "spc*.bin") {
+		container, err := parseSPCContainer(playback)
+		if err != nil {
+			f.Fatal(err)
+		}
+		spck, err := decryptSPCK(priKey, container.EncryptedAesKey)
+		if err != nil {
+			f.Fatal(err)
+		}
+		payload, err := cryptos.AESCBCDecrypt(spck, container.AesKeyIV, container.SPCPlayload)
+		if err != nil {
+			f.Fatal(err)
+		}
+		payloads = append(payloads, payload)
+	}
+	return payloads
+}
+
+func FuzzParseSPCContainer(f *testing.F) {
+	quietFuzz(f)
+	for _, playback := range testdataFiles(f, "spc*.bin") {
+		f.Add(playback)
+	}
+	f.Add([]byte{0, 0, 0, 2})
+
+	f.Fuzz(func(t *testing.T, playback []byte) {
+		container, err := parseSPCContainer(playback)
+		if err != nil {
+			return
+		}
+		if len(container.SPCPlayload) != int(container.SPCPlayloadLength) {
+			t.Fatalf("payload is %d bytes, length field %d", len(container.SPCPlayload), container.SPCPlayloadLength)
+		}
+		PeekCertificateHash(playback)
+	})
+}
+
+func FuzzParseTLLVs(f *testing.F) {
+	quietFuzz(f)
+	for _, payload := range spcPayloads(f) {
+		f.Add(payload)
+	}
+
+	f.Fuzz(func(t *testing.T, payload []byte) {
+		blocks, err := parseTLLVBlocks(payload)
+		if err != nil {
+			return
+		}
+		ttlvs, _ := indexTLLVs(blocks)
+		container := &SPCContainer{Blocks: blocks, TTLVS: ttlvs}
+
+		// DecodeSPC and the return request lookup only see parsed blocks, so they must not panic either.
+		if spc, err := DecodeSPC(container); err == nil {
+			findReturnRequestBlocks(spc)
+		}
+	})
+}
+
+func FuzzParseSKR1(f *testing.F) {
+	quietFuzz(f)
+	for _, payload := range spcPayloads(f) {
+		ttlvs, err := parseTLLVs(payload)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(ttlvs[tagSessionKeyR1].Value, make([]byte, 16))
+	}
+
+	f.Fuzz(func(t *testing.T, value, dask []byte) {
+		skr1, err := parseSKR1(TLLVBlock{Tag: tagSessionKeyR1, Value: value})
+		if err != nil {
+			return
+		}
+		decryptSKR1Payload(*skr1, dask)
+	})
+}
+
+func FuzzTLLVRoundTrip(f *testing.F) {
+	quietFuzz(f)
+	f.Add(uint64(tagAssetID), []byte("asset-id"))
+	f.Add(uint64(tagR2), make([]byte, 21))
+	f.Add(uint64(tagReturnRequest), []byte{})
+
+	f.Fuzz(func(t *testing.T, tag uint64, value []byte) {
+		block := NewTLLVBlock(tag, value)
+		out, err := block.Serialize()
+		if err != nil {
+			if tag == 0 {
+				return
+			}
+			t.Fatal(err)
+		}
+
+		blocks, err := parseTLLVBlocks(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(blocks) != 1 {
+			t.Fatalf("got %d blocks, want 1", len(blocks))
+		}
+		got := blocks[0]
+		if got.Tag != block.Tag || got.BlockLength != block.BlockLength || got.ValueLength != block.ValueLength || !bytes.Equal(got.Value, value) {
+			t.Fatalf("got %+v, want %+v", got, block)
+		}
+		if got.BlockLength%16 != 0 {
+			t.Fatalf("block length %d isn't padded to 16 bytes", got.BlockLength)
+		}
+	})
+}
+
+func FuzzDecodeCKC(f *testing.F) {
+	quietFuzz(f)
+	for _, ckc := range testdataFiles(f, "ckc*.bin") {
+		f.Add(ckc)
+	}
+	secrets := CKCSecrets{SK: make([]byte, 16), R1: make([]byte, 44), AntiReplaySeed: make([]byte, 16)}
+
+	f.Fuzz(func(t *testing.T, ckc []byte) {
+		DecodeCKC(ckc, secrets)
+		DebugCKC(ckc)
+	})
+}
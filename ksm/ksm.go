@@ -1,6 +1,8 @@
 package ksm
 
 import (
+	"context"
+	"crypto"
 	"crypto/aes"
 	"crypto/rand"
 	"crypto/rsa"
@@ -9,8 +11,8 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"math/big"
 	"reflect"
-	"strings"
 
 	"github.com/minsoo-gold/fairplay-ksm/cryptos"
 	"github.com/minsoo-gold/fairplay-ksm/logger"
@@ -26,7 +28,26 @@ type SPCContainer struct {
 	SPCPlayload       []byte
 	SPCPlayloadLength uint32
 
-	TTLVS map[uint64]TLLVBlock
+	TTLVS         map[uint64]TLLVBlock // The TLLV blocks indexed by tag, the last block wins if a tag is duplicated.
+	Blocks        []TLLVBlock          // The TLLV blocks in payload order.
+	DuplicateTags []*DuplicateTagError // The tags present more than once in the payload.
+}
+
+// Block returns the TLLV block of tag, the same block as TTLVS[tag].
+func (c *SPCContainer) Block(tag uint64) (TLLVBlock, bool) {
+	block, ok := c.TTLVS[tag]
+	return block, ok
+}
+
+// BlocksByTag returns every TLLV block of tag in payload order.
+func (c *SPCContainer) BlocksByTag(tag uint64) []TLLVBlock {
+	var blocks []TLLVBlock
+	for _, block := range c.Blocks {
+		if block.Tag == tag {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
 }
 
 // CKCContainer represents a container to contain CKC message filed.
@@ -47,7 +68,6 @@ func (c *CKCContainer) Serialize() []byte {
 
 	payloadLenOut := make([]byte, 4)
 	payloadLen := uint32(len(c.CKCPayload))
-	logger.Printf("payloadLen:%v\n", payloadLen)
 	binary.BigEndian.PutUint32(payloadLenOut, payloadLen)
 
 	out = append(out, versionOut...)
@@ -61,72 +81,141 @@ func (c *CKCContainer) Serialize() []byte {
 
 // Ksm represents a ksm object.
 type Ksm struct {
-	Pub *rsa.PublicKey
-	Pri *rsa.PrivateKey
-	Rck ContentKey
-	Ask []byte
-	d   DFunction
+	Pub  *rsa.PublicKey
+	Pri  *rsa.PrivateKey
+	Rck  ContentKey         // The content keys, used when Keys is nil.
+	Keys ContentKeyProvider // The content keys and policies, in place of Rck.
+	Ask  []byte
+	D    DFunction // The D function computing DASk, ReferenceDFunction if nil.
+
+	ProtocolVersions   []uint32 // The accepted protocol versions, DefaultProtocolVersions if empty.
+	MinProtocolVersion uint32   // SPCs built with an older protocol version are rejected.
+	Metrics            Metrics  // Optional.
+
+	DuplicateTags DuplicateTagPolicy // What to do with an SPC containing a duplicated TLLV tag.
+
+	Devices    DeviceRegistry // Records the devices of each user, optional.
+	MaxDevices int            // The maximum number of devices per user, zero is unlimited. Requires CKCOptions.UserID.
+
+	Replay *ReplayGuard // Rejects replayed and expired SPCs, optional.
+
+	// Decrypter unwraps SPCK in place of Pri, for a private key kept outside the process,
+	// such as a PKCS#11 token or a key daemon. Pri and Decrypter must belong to the key pair of Pub.
+	Decrypter crypto.Decrypter
+
+	// Credentials are chosen by the certificate hash of the SPC. Pub, Pri (or Decrypter) and Ask are used
+	// for SPCs matching none of them, and GenCKC returns ErrUnknownCertificate if both Pri and Decrypter are nil.
+	Credentials *CredentialSet
+}
+
+// CKCOptions represents the per-request options of GenCKCWithOptions.
+type CKCOptions struct {
+	Offline bool   // The client requests a persistable key for offline (downloaded) playback.
+	UserID  string // The user or account requesting the key. Empty skips the device registry.
 }
 
 // GenCKC computes the incoming server playback context (SPC message) returned to client by the SKDServer library.
 func (k *Ksm) GenCKC(playback []byte) ([]byte, error) {
-	spcv1, err := ParseSPCV1(playback, k.Pub, k.Pri)
+	return k.GenCKCWithOptions(playback, CKCOptions{})
+}
+
+// GenCKCWithOptions is like GenCKC but applies the per-request options, such as a persistent key request.
+// GenCKCWithOptions returns a *PolicyError if the asset policy doesn't allow the request.
+func (k *Ksm) GenCKCWithOptions(playback []byte, opts CKCOptions) ([]byte, error) {
+	return k.GenCKCContext(context.Background(), playback, opts)
+}
+
+// GenCKCContext is like GenCKCWithOptions. Its logs carry the attributes of ctx (see logger.With),
+// and the asset ID and transaction ID of the SPC.
+func (k *Ksm) GenCKCContext(ctx context.Context, playback []byte, opts CKCOptions) ([]byte, error) {
+	container, err := parseSPCContainer(playback)
 	if err != nil {
 		return nil, err
 	}
+	credential, err := k.credential(container)
+	if err != nil {
+		return nil, err
+	}
+	if err := decryptSPC(ctx, container, credential.decrypter()); err != nil {
+		return nil, err
+	}
 
-	ttlvs := spcv1.TTLVS
-	skr1 := parseSKR1(ttlvs[tagSessionKeyR1])
-
-	r2 := ttlvs[tagR2]
-	dask, err := k.d.Compute(r2.Value, k.Ask)
+	if k.DuplicateTags == DuplicateTagReject && len(container.DuplicateTags) > 0 {
+		return nil, container.DuplicateTags[0]
+	}
 
+	spc, err := DecodeSPC(container)
 	if err != nil {
 		return nil, err
 	}
-	logger.Printf("DASk Value:\n\t%s\n\n", hex.EncodeToString(dask))
+	ctx = logger.With(ctx, "asset_id", string(spc.AssetID), "transaction_id", fmt.Sprintf("%016x", spc.TransactionID))
 
-	DecryptedSKR1Payload, err := decryptSKR1Payload(*skr1, dask)
+	d := k.D
+	if d == nil {
+		d = ReferenceDFunction{}
+	}
+	dask, err := d.Compute(spc.R2, credential.Ask)
 	if err != nil {
 		return nil, err
 	}
+	logger.Debug(ctx, "dask computed", "dask", logger.Secret(dask))
 
-	logger.Printf("Decrypted SKR1Payload: %s\n", hex.EncodeToString(DecryptedSKR1Payload.IntegrityBytes))
+	DecryptedSKR1Payload, err := decryptSKR1Payload(*spc.SKR1, dask)
+	if err != nil {
+		return nil, err
+	}
 
-	checkTheIntegrity, ok := ttlvs[tagSessionKeyR1Integrity]
-	if !ok {
-		return nil, errors.New("tagSessionKeyR1Integrity block doesn't existed")
+	if !reflect.DeepEqual(spc.SKR1Integrity, DecryptedSKR1Payload.IntegrityBytes) {
+		logger.Warn(ctx, "spc integrity check failed")
+		return nil, errors.New("check the integrity of the SPC failed")
 	}
 
-	logger.Printf("checkTheIntegrity: %s\n", hex.EncodeToString(checkTheIntegrity.Value))
+	spc.DeviceID = DecryptedSKR1Payload.HU
 
-	if !reflect.DeepEqual(checkTheIntegrity.Value, DecryptedSKR1Payload.IntegrityBytes) {
-		return nil, errors.New("check the integrity of the SPC failed")
+	if k.Replay != nil {
+		if err := k.Replay.Check(spc); err != nil {
+			return nil, err
+		}
 	}
 
-	logger.Printf("DASk Value:\n\t%s\n\n", hex.EncodeToString(dask))
-	logger.Printf("SPC SK Value:\n\t%s\n\n", hex.EncodeToString(DecryptedSKR1Payload.SK))
-	logger.Printf("SPC [SK..R1] IV Value:\n\t%s\n\n", hex.EncodeToString(skr1.IV))
-	//logger.Printf("SPC R1 Value:\n%s\n\n",hex.EncodeToString(DecryptedSKR1Payload.R1))
+	logger.Debug(ctx, "session key decrypted",
+		"sk", logger.Secret(DecryptedSKR1Payload.SK),
+		"r1", logger.Secret(DecryptedSKR1Payload.R1),
+		"skr1_iv", hex.EncodeToString(spc.SKR1.IV))
 
-	assetTTlv := ttlvs[tagAssetID]
+	assetID := spc.AssetID
 
-	// assetID its length can range from 2 to 200 bytes
-	if assetTTlv.ValueLength < 2 || assetTTlv.ValueLength > 200 {
-		return nil, errors.New("assetID its length must be range from 2 to 200 bytes")
+	err = checkProtocolVersion(&spc.ProtocolVersion, k.ProtocolVersions, k.MinProtocolVersion)
+	if k.Metrics != nil {
+		k.Metrics.ObserveProtocolVersion(spc.ProtocolVersion.Used, err == nil)
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	assetID := assetTTlv.Value
-	logger.Printf("assetID: %v\n", hex.EncodeToString(assetID))
-	logger.Printf("assetID(string): %v\n", string(assetID))
+	assetKey, err := k.fetchAssetKey(ctx, spc)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := assetKey.Policy.forOutput(spc.StreamingIndicator.Output())
+	if err != nil {
+		return nil, err
+	}
+	if err := policy.check(spc, opts, assetKey.Duration); err != nil {
+		return nil, err
+	}
+	if k.MaxDevices > 0 && k.Devices != nil && opts.UserID == "" {
+		return nil, &PolicyError{Reason: fmt.Sprintf("a user ID is required for the limit of %d devices", k.MaxDevices)}
+	}
 
-	kid, enCk, contentIv, err := encryptCK(assetTTlv.Value, k.Rck, DecryptedSKR1Payload.SK)
+	enCk, err := encryptCK(assetKey.Key, DecryptedSKR1Payload.SK)
 	if err != nil {
 		return nil, err
 	}
-	logger.Println("enCK Length ", kid, len(enCk))
+	contentIv := assetKey.IV
+	logger.Debug(ctx, "content key encrypted", "kid", hex.EncodeToString(assetKey.KID))
 
-	returnTllvs, err := findReturnRequestBlocks(spcv1)
+	returnTllvs, err := findReturnRequestBlocks(spc)
 	if err != nil {
 		return nil, err
 	}
@@ -136,26 +225,33 @@ func (k *Ksm) GenCKC(playback []byte) ([]byte, error) {
 		R1: DecryptedSKR1Payload.R1,
 	}
 
-	logger.Println("ckcDataIV Length", len(ckcDataIv.IV))
-
-	encryptedArSeed, err := getEncryptedArSeed(DecryptedSKR1Payload.R1, ttlvs[tagAntiReplaySeed].Value)
+	encryptedArSeed, err := getEncryptedArSeed(DecryptedSKR1Payload.R1, spc.AntiReplaySeed)
 	if err != nil {
 		return nil, err
 	}
 
-	ckcPayload, err := genCkcPayload(contentIv, enCk, ckcR1, returnTllvs)
-	if err != nil {
-		return nil, err
-	}
+	var policyTllvs [][]byte
 
 	//ContenKeyDurationTllv,  This TLLV may be present only if the KSM has received an SPC with a Media Playback State TLLV.
-	if _, ok := ttlvs[tagMediaPlaybackState]; ok {
-		ckcDuraionTllv, err := genCkDurationTllv(assetID, k.Rck)
+	// A persistent key carries the offline key TLLV instead.
+	if spc.PlaybackState != nil && !opts.Offline && assetKey.Duration != nil {
+		ckcDuraionTllv, err := assetKey.Duration.Serialize()
 		if err != nil {
 			return nil, err
 		}
 
-		ckcPayload = append(ckcPayload, ckcDuraionTllv...)
+		policyTllvs = append(policyTllvs, ckcDuraionTllv)
+	}
+
+	assetPolicyTllvs, err := genAssetPolicyTllvs(assetID, policy, opts)
+	if err != nil {
+		return nil, err
+	}
+	policyTllvs = append(policyTllvs, assetPolicyTllvs...)
+
+	ckcPayload, err := genCkcPayload(contentIv, enCk, ckcR1, returnTllvs, policyTllvs...)
+	if err != nil {
+		return nil, err
 	}
 
 	enCkcPayload, err := encryptCkcPayload(encryptedArSeed, ckcDataIv, ckcPayload)
@@ -164,30 +260,56 @@ func (k *Ksm) GenCKC(playback []byte) ([]byte, error) {
 	}
 
 	out := fillCKCContainer(enCkcPayload.Payload, ckcDataIv)
+
+	// The device and the SPC are only recorded for a CKC actually issued. A concurrent replay of the SPC
+	// comes from the same device, so the device is recorded first.
+	if err := k.registerDevice(ctx, spc, opts); err != nil {
+		return nil, err
+	}
+	if k.Replay != nil {
+		if err := k.Replay.Commit(spc); err != nil {
+			return nil, err
+		}
+	}
+	logger.Info(ctx, "ckc generated",
+		"protocol_version", spc.ProtocolVersion.Used,
+		"output", spc.StreamingIndicator.Output().String(),
+		"offline", opts.Offline,
+		"returned_tllvs", len(returnTllvs))
 	return out, nil
 }
 
-func genCkDurationTllv(assetID []byte, key ContentKey) ([]byte, error) {
-	CkcContentKeyDurationBlock, err := key.FetchContentKeyDuration(assetID)
-	if err != nil {
-		return nil, err
+// registerDevice records the device of spc for the user of opts, if any.
+// registerDevice returns a *PolicyError if the user already has k.MaxDevices other devices.
+func (k *Ksm) registerDevice(ctx context.Context, spc *SPC, opts CKCOptions) error {
+	if k.Devices == nil || opts.UserID == "" {
+		return nil
+	}
+
+	err := k.Devices.RegisterDevice(ctx, opts.UserID, spc.DeviceID, k.MaxDevices)
+	if errors.Is(err, ErrDeviceLimit) {
+		return &PolicyError{Reason: fmt.Sprintf("the user already has the maximum of %d devices", k.MaxDevices)}
 	}
-	return CkcContentKeyDurationBlock.Serialize()
+	return err
 }
 
-// DebugCKC debbug ckcplayback content
+// DebugCKC logs the container header of ckcplayback. Use DecodeCKC to decrypt and check its payload.
 func DebugCKC(ckcplayback []byte) {
-	ckcContaniner := &CKCContainer{}
-	ckcContaniner.CKCVersion = binary.BigEndian.Uint32(ckcplayback[0:4])
-	ckcContaniner.Reserved = ckcplayback[4:8]
-	ckcContaniner.CKCDataInitV = ckcplayback[8:24]
-	ckcContaniner.CKCPayloadLength = binary.BigEndian.Uint32(ckcplayback[24:28])
-	ckcContaniner.CKCPayload = ckcplayback[28 : 28+ckcContaniner.CKCPayloadLength]
+	ckcContaniner, err := parseCKCContainer(ckcplayback)
+	if err != nil {
+		logger.Debug(context.Background(), "malformed ckc", "error", err)
+		return
+	}
+	logger.Debug(context.Background(), "ckc container",
+		"version", ckcContaniner.CKCVersion,
+		"iv", hex.EncodeToString(ckcContaniner.CKCDataInitV),
+		"payload_length", ckcContaniner.CKCPayloadLength)
 }
 
-func genCkcPayload(ckIv, enCk []byte, ckcR1 CkcR1, returnTllvs []TLLVBlock) ([]byte, error) {
-	//TODO: The order of these blocks should be random.
-	var ckcPayload []byte
+// genCkcPayload serializes the content key, R1, the return request blocks and any
+// extra serialized TLLVs (such as the content key duration) in a random order.
+func genCkcPayload(ckIv, enCk []byte, ckcR1 CkcR1, returnTllvs []TLLVBlock, extraTllvs ...[]byte) ([]byte, error) {
+	var blocks [][]byte
 
 	//Content Key TLLV
 	var contentKeyTllv []byte
@@ -208,7 +330,7 @@ func genCkcPayload(ckIv, enCk []byte, ckcR1 CkcR1, returnTllvs []TLLVBlock) ([]b
 		return nil, errors.New("contentKeyTllv len must be 64")
 	}
 
-	ckcPayload = append(ckcPayload, contentKeyTllv...)
+	blocks = append(blocks, contentKeyTllv)
 
 	//R1Tllv
 	r1TllvBlock := NewTLLVBlock(tagR1, ckcR1.R1)
@@ -217,7 +339,7 @@ func genCkcPayload(ckIv, enCk []byte, ckcR1 CkcR1, returnTllvs []TLLVBlock) ([]b
 	if err != nil {
 		return nil, err
 	}
-	ckcPayload = append(ckcPayload, r1TllvBlockOut...)
+	blocks = append(blocks, r1TllvBlockOut)
 
 	// serializeReturnRequesTllvs
 	for _, rtnTlv := range returnTllvs {
@@ -225,11 +347,34 @@ func genCkcPayload(ckIv, enCk []byte, ckcR1 CkcR1, returnTllvs []TLLVBlock) ([]b
 		if err != nil {
 			return nil, err
 		}
-		ckcPayload = append(ckcPayload, rtnTlvOut...)
+		blocks = append(blocks, rtnTlvOut)
+	}
+
+	blocks = append(blocks, extraTllvs...)
+
+	// The order of these blocks must be random.
+	if err := shuffleTllvs(blocks); err != nil {
+		return nil, err
+	}
+
+	var ckcPayload []byte
+	for _, block := range blocks {
+		ckcPayload = append(ckcPayload, block...)
 	}
 
 	return ckcPayload, nil
+}
 
+// shuffleTllvs shuffles serialized TLLV blocks in place (Fisher-Yates) using a cryptographic RNG.
+func shuffleTllvs(blocks [][]byte) error {
+	for i := len(blocks) - 1; i > 0; i-- {
+		j, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return err
+		}
+		blocks[i], blocks[j.Int64()] = blocks[j.Int64()], blocks[i]
+	}
+	return nil
 }
 
 func getEncryptedArSeed(r1 []byte, arSeed []byte) ([]byte, error) {
@@ -259,79 +404,157 @@ func encryptCkcPayload(encryptedArSeed []byte, iv CkcDataIv, ckcPayload []byte)
 	return &CkcEncryptedPayload{Payload: encryped}, nil
 }
 
-func findReturnRequestBlocks(spcv1 *SPCContainer) ([]TLLVBlock, error) {
-	tagReturnReq := spcv1.TTLVS[tagReturnRequest]
-
+func findReturnRequestBlocks(spc *SPC) ([]TLLVBlock, error) {
 	var returnTllvs []TLLVBlock
 
-	for currentOffset := 0; currentOffset < len(tagReturnReq.Value); {
-		tag := binary.BigEndian.Uint64(tagReturnReq.Value[currentOffset : currentOffset+8])
-
-		if ttlv, ok := spcv1.TTLVS[tag]; ok {
-			logger.Printf("tag: %x\n", tagReturnReq.Value[currentOffset:currentOffset+8])
+	for _, tag := range spc.ReturnRequestTags {
+		if ttlv, ok := spc.Container.TTLVS[tag]; ok {
 			returnTllvs = append(returnTllvs, ttlv)
 		} else {
-			logger.Printf("no tag: %x\n", tagReturnReq.Value[currentOffset:currentOffset+8])
-			return nil, fmt.Errorf("can not found tag")
+			return nil, fmt.Errorf("%w: return request tag %x", ErrTLLVMissing, tag)
 		}
-
-		currentOffset += fieldTagLength
 	}
 
 	return returnTllvs, nil
 }
 
-func encryptCK(assetID []byte, ck ContentKey, sk []byte) ([]byte, []byte, []byte, error) {
-	kid, contentKey, contentIv, err := ck.FetchContentKey(assetID) // 3개 리턴
-	if err != nil {
-		return nil, nil, nil, err
-	}
-
-	var iv []byte
-	iv = make([]byte, len(contentKey))
-
-	//enCk, err := aes.Encrypt(sk, iv, contentKey)
-	logger.Println("encryptCK.", kid, len(sk), len(iv), len(contentKey))
-	enCK, err := cryptos.AESCBCEncrypt(sk, iv, contentKey)
-	logger.Println("encryptCK.", len(enCK))
-	return kid, enCK, contentIv, err
+// encryptCK encrypts the content key with the session key, the value of the encrypted content key TLLV.
+func encryptCK(contentKey []byte, sk []byte) ([]byte, error) {
+	iv := make([]byte, len(contentKey))
+	return cryptos.AESCBCEncrypt(sk, iv, contentKey)
 }
 
 // ParseSPCV1 parses playback, public and private key pairs to new a SPCContainer instance.
 // ParseSPCV1 returns an error if playback can't be parsed.
+//
+// Deprecated: ParseSPCV1 accepts every SPC version, use ParseSPC instead.
 func ParseSPCV1(playback []byte, pub *rsa.PublicKey, pri *rsa.PrivateKey) (*SPCContainer, error) {
-	spcContainer := parseSPCContainer(playback)
+	return ParseSPC(playback, pub, pri)
+}
 
-	spck, err := decryptSPCK(pub, pri, spcContainer.EncryptedAesKey)
+// ParseSPC parses playback, public and private key pairs to new a SPCContainer instance.
+// The layout is chosen from the SPC version, version 1 for 1024-bit and version 2 for 2048-bit credentials.
+// pub may be nil, otherwise it must be the public key of pri.
+// ParseSPC returns an error if playback can't be parsed.
+func ParseSPC(playback []byte, pub *rsa.PublicKey, pri *rsa.PrivateKey) (*SPCContainer, error) {
+	if pri == nil {
+		return nil, errors.New("private key required")
+	}
+	if pub != nil && !pub.Equal(&pri.PublicKey) {
+		return nil, errors.New("public key doesn't match the private key")
+	}
+	spcContainer, err := parseSPCContainer(playback)
 	if err != nil {
 		return nil, err
 	}
+	if err := decryptSPC(context.Background(), spcContainer, pri); err != nil {
+		return nil, err
+	}
+	return spcContainer, nil
+}
+
+// ParseSPCWithDecrypter is like ParseSPC for a private key that is only available as a crypto.Decrypter.
+func ParseSPCWithDecrypter(playback []byte, d crypto.Decrypter) (*SPCContainer, error) {
+	if d == nil {
+		return nil, errors.New("private key required")
+	}
+	spcContainer, err := parseSPCContainer(playback)
+	if err != nil {
+		return nil, err
+	}
+	if err := decryptSPC(context.Background(), spcContainer, d); err != nil {
+		return nil, err
+	}
+	return spcContainer, nil
+}
+
+// decryptSPC decrypts the payload of spcContainer and parses its TLLV blocks.
+func decryptSPC(ctx context.Context, spcContainer *SPCContainer, d crypto.Decrypter) error {
+	spck, err := decryptSPCK(d, spcContainer.EncryptedAesKey)
+	if err != nil {
+		return err
+	}
 
-	printDebugSPC(spcContainer)
+	printDebugSPC(ctx, spcContainer)
 
 	spcPayload, err := cryptos.AESCBCDecrypt(spck, spcContainer.AesKeyIV, spcContainer.SPCPlayload)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	logger.Println("=== SPC PayloadRow ===")
-	logger.Println(hex.EncodeToString(spcPayload))
+	logger.Debug(ctx, "spc payload decrypted", "payload", logger.Secret(spcPayload))
 
-	spcContainer.TTLVS = parseTLLVs(spcPayload)
+	spcContainer.Blocks, err = parseTLLVBlocks(spcPayload)
+	if err != nil {
+		return err
+	}
 
-	return spcContainer, nil
+	for _, block := range spcContainer.Blocks {
+		printDebugTLLV(ctx, block)
+	}
+
+	spcContainer.TTLVS, spcContainer.DuplicateTags = indexTLLVs(spcContainer.Blocks)
+	for _, duplicate := range spcContainer.DuplicateTags {
+		logger.Warn(ctx, "duplicate tllv tag", "tag", fmt.Sprintf("%x", duplicate.Tag), "blocks", duplicate.Indexes)
+	}
+
+	return nil
+}
+
+const (
+	// SPCVersion1 is the SPC layout used with 1024-bit FairPlay credentials.
+	SPCVersion1 = 1
+	// SPCVersion2 is the SPC layout used with 2048-bit FairPlay credentials.
+	SPCVersion2 = 2
+)
+
+// spcLayout describes the fixed-size header of an SPC message version.
+type spcLayout struct {
+	wrappedKeyLength int // The length of [SPCK], the RSA wrapped AES key.
+}
+
+var spcLayouts = map[uint32]spcLayout{
+	SPCVersion1: {wrappedKeyLength: 128},
+	SPCVersion2: {wrappedKeyLength: 256},
+}
+
+// headerLength returns Version(4) + Reserved(4) + IV(16) + [SPCK] + Certificate hash(20) + Payload length(4).
+func (l spcLayout) headerLength() int {
+	return 24 + l.wrappedKeyLength + 24
 }
 
-func parseSPCContainer(playback []byte) *SPCContainer {
+func parseSPCContainer(playback []byte) (*SPCContainer, error) {
+	if len(playback) < 4 {
+		return nil, fmt.Errorf("%w: got %d bytes", ErrSPCTruncated, len(playback))
+	}
+
 	spcContainer := &SPCContainer{}
 	spcContainer.Version = binary.BigEndian.Uint32(playback[0:4])
+
+	layout, ok := spcLayouts[spcContainer.Version]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrSPCVersion, spcContainer.Version)
+	}
+
+	headerLength := layout.headerLength()
+	if len(playback) < headerLength {
+		return nil, fmt.Errorf("%w: got %d bytes, need at least %d", ErrSPCTruncated, len(playback), headerLength)
+	}
+
+	keyEnd := 24 + layout.wrappedKeyLength
 	spcContainer.Reserved = playback[4:8]
 	spcContainer.AesKeyIV = playback[8:24]
-	spcContainer.EncryptedAesKey = playback[24:152]
-	spcContainer.CertificateHash = playback[152:172]
-	spcContainer.SPCPlayloadLength = binary.BigEndian.Uint32(playback[172:176])
-	spcContainer.SPCPlayload = playback[176 : 176+spcContainer.SPCPlayloadLength]
+	spcContainer.EncryptedAesKey = playback[24:keyEnd]
+	spcContainer.CertificateHash = playback[keyEnd : keyEnd+20]
+	spcContainer.SPCPlayloadLength = binary.BigEndian.Uint32(playback[keyEnd+20 : keyEnd+24])
 
-	return spcContainer
+	// The payload is AES-CBC encrypted, so it can't be empty and must be whole blocks.
+	payloadLen := uint64(spcContainer.SPCPlayloadLength)
+	if payloadLen == 0 || payloadLen%aes.BlockSize != 0 || payloadLen > uint64(len(playback)-headerLength) {
+		return nil, fmt.Errorf("%w: payload length %d, %d bytes available", ErrSPCPayloadLength, payloadLen, len(playback)-headerLength)
+	}
+	spcContainer.SPCPlayload = playback[headerLength : uint64(headerLength)+payloadLen]
+
+	return spcContainer, nil
 }
 
 func fillCKCContainer(CkcEncryptedPayload []byte, iv CkcDataIv) []byte {
@@ -345,11 +568,48 @@ func fillCKCContainer(CkcEncryptedPayload []byte, iv CkcDataIv) []byte {
 	return ckcContaniner.Serialize()
 }
 
-func parseTLLVs(spcPayload []byte) map[uint64]TLLVBlock {
-	var m map[uint64]TLLVBlock
-	m = make(map[uint64]TLLVBlock)
+// parseTLLVs parses the TLLV blocks of spcPayload into a map indexed by tag.
+// The last block wins when a tag is duplicated.
+func parseTLLVs(spcPayload []byte) (map[uint64]TLLVBlock, error) {
+	blocks, err := parseTLLVBlocks(spcPayload)
+	if err != nil {
+		return nil, err
+	}
+
+	m, _ := indexTLLVs(blocks)
+	return m, nil
+}
+
+// indexTLLVs indexes blocks by tag, the last block winning, and reports every duplicated tag in order of first appearance.
+func indexTLLVs(blocks []TLLVBlock) (map[uint64]TLLVBlock, []*DuplicateTagError) {
+	m := make(map[uint64]TLLVBlock, len(blocks))
+	indexes := make(map[uint64][]int, len(blocks))
+	var tags []uint64
+
+	for i, block := range blocks {
+		if len(indexes[block.Tag]) == 1 {
+			tags = append(tags, block.Tag)
+		}
+		indexes[block.Tag] = append(indexes[block.Tag], i)
+		m[block.Tag] = block
+	}
+
+	var duplicates []*DuplicateTagError
+	for _, tag := range tags {
+		duplicates = append(duplicates, &DuplicateTagError{Tag: tag, Indexes: indexes[tag]})
+	}
+	return m, duplicates
+}
+
+// parseTLLVBlocks parses the TLLV blocks of spcPayload in payload order.
+func parseTLLVBlocks(spcPayload []byte) ([]TLLVBlock, error) {
+	var blocks []TLLVBlock
 
 	for currentOffset := 0; currentOffset < len(spcPayload); {
+		blockOffset := currentOffset
+		if len(spcPayload)-currentOffset < fieldTagLength+fieldBlockLength+fieldValueLength {
+			return nil, fmt.Errorf("%w: truncated header at offset %d", ErrTLLVOverrun, blockOffset)
+		}
 
 		tag := binary.BigEndian.Uint64(spcPayload[currentOffset : currentOffset+fieldTagLength])
 		currentOffset += fieldTagLength
@@ -361,64 +621,15 @@ func parseTLLVs(spcPayload []byte) map[uint64]TLLVBlock {
 		currentOffset += fieldValueLength
 		//paddingSize := blockLength - valueLength
 
-		value := spcPayload[currentOffset : currentOffset+int(valueLength)]
-
-		var skip bool
-		switch tag {
-		case tagSessionKeyR1:
-			logger.Printf("tagSessionKeyR1 -- %x\n", tag)
-		case tagSessionKeyR1Integrity:
-			logger.Printf("tagSessionKeyR1Integrity -- %x\n", tag)
-		case tagAntiReplaySeed:
-			logger.Printf("tagAntiReplaySeed -- %x\n", tag)
-		case tagR2:
-			logger.Printf("tagR2 -- %x\n", tag)
-		case tagReturnRequest:
-			logger.Printf("tagReturnRequest -- %x\n", tag)
-		case tagAssetID:
-			logger.Printf("tagAssetID -- %x\n", tag)
-		case tagTransactionID:
-			logger.Printf("tagTransactionID -- %x\n", tag)
-		case tagProtocolVersionsSupported:
-			logger.Printf("tagProtocolVersionsSupported -- %x\n", tag)
-		case tagProtocolVersionUsed:
-			logger.Printf("tagProtocolVersionUsed -- %x\n", tag)
-		case tagTreamingIndicator:
-			logger.Printf("tagTreamingIndicator -- %x\n", tag)
-		case tagMediaPlaybackState:
-			logger.Printf("tagMediaPlaybackState -- %x\n", tag)
-		default:
-			skip = true
+		if blockLength < valueLength {
+			return nil, fmt.Errorf("%w: tag %x at offset %d, block length %d, value length %d", ErrTLLVBlockLength, tag, blockOffset, blockLength, valueLength)
 		}
-
-		if skip == false {
-			logger.Printf("Tag size:0x%x\n", valueLength)
-			logger.Printf("Tag length:0x%x\n", blockLength)
-			logger.Printf("Tag value:%s\n\n", hex.EncodeToString(value))
-
-			if tag == tagMediaPlaybackState {
-				creationDate := binary.BigEndian.Uint32(value[0:4])
-				playbackState := binary.BigEndian.Uint32(value[4:8])
-				sessionID := binary.BigEndian.Uint32(value[8:12])
-				logger.Printf("\t\t\tSPC creation time - %v\n", creationDate)
-
-				switch playbackState {
-				case playbackStateReadyToStart:
-					logger.Printf("\t\tPlayback_State_ReadyToStart.")
-				case playbackStatePlayingOrPaused:
-					logger.Printf("\t\tPlayback_State_PlayingOrPaused.")
-				case playbackStatePlaying:
-					logger.Printf("\t\tPlayback_State_Playing.")
-				case playbackStateHalted:
-					logger.Printf("\t\tPlayback_State_Halted.")
-				default:
-					logger.Printf("not expected.")
-				}
-				logger.Printf("%x\n", playbackState)
-				logger.Printf("\t\t\tPlayback Session Id - %v\n", sessionID)
-			}
+		if uint64(blockLength) > uint64(len(spcPayload)-currentOffset) {
+			return nil, fmt.Errorf("%w: tag %x at offset %d, block length %d, %d bytes remaining", ErrTLLVOverrun, tag, blockOffset, blockLength, len(spcPayload)-currentOffset)
 		}
 
+		value := spcPayload[currentOffset : currentOffset+int(valueLength)]
+
 		tllvBlock := TLLVBlock{
 			Tag:         tag,
 			BlockLength: blockLength,
@@ -426,20 +637,25 @@ func parseTLLVs(spcPayload []byte) map[uint64]TLLVBlock {
 			Value:       value,
 		}
 
-		m[tag] = tllvBlock
+		blocks = append(blocks, tllvBlock)
 
 		currentOffset = currentOffset + int(blockLength)
 	}
 
-	return m
+	return blocks, nil
 }
 
-func parseSKR1(tllv TLLVBlock) *SKR1TLLVBlock {
+func parseSKR1(tllv TLLVBlock) (*SKR1TLLVBlock, error) {
+	// [SK..R1] value: IV(16) + encrypted payload(96)
+	if tllv.Tag != tagSessionKeyR1 || len(tllv.Value) != 112 {
+		return nil, fmt.Errorf("%w: tagSessionKeyR1 value length %d, must be 112", ErrTLLVMissing, len(tllv.Value))
+	}
+
 	return &SKR1TLLVBlock{
 		TLLVBlock: tllv,
 		IV:        tllv.Value[0:16],
 		Payload:   tllv.Value[16:112],
-	}
+	}, nil
 }
 
 func decryptSKR1Payload(skr1 SKR1TLLVBlock, dask []byte) (*DecryptedSKR1Payload, error) {
@@ -453,8 +669,6 @@ func decryptSKR1Payload(skr1 SKR1TLLVBlock, dask []byte) (*DecryptedSKR1Payload,
 		return nil, err
 	}
 
-	logger.Println("Decrypt Payload Row Length: ", len(decryptPayloadRow))
-
 	if len(decryptPayloadRow) != 96 {
 		return nil, errors.New("wrong decrypt payload size. Must be 96 bytes expected")
 	}
@@ -469,32 +683,50 @@ func decryptSKR1Payload(skr1 SKR1TLLVBlock, dask []byte) (*DecryptedSKR1Payload,
 	return d, nil
 }
 
-func printDebugSPC(spcContainer *SPCContainer) {
-	logger.Println("========================= Begin SPC Data ===============================")
-	logger.Printf("SPC container size %+v\n", spcContainer.SPCPlayloadLength)
-
-	logger.Println("SPC Encryption Key -")
-	logger.Println(hex.EncodeToString(spcContainer.EncryptedAesKey))
-	logger.Println("SPC Encryption IV -")
-	logger.Println(hex.EncodeToString(spcContainer.AesKeyIV))
-	logger.Println("================ SPC TLLV List ================")
+func printDebugSPC(ctx context.Context, spcContainer *SPCContainer) {
+	logger.Debug(ctx, "spc container",
+		"version", spcContainer.Version,
+		"payload_length", spcContainer.SPCPlayloadLength,
+		"certificate_hash", hex.EncodeToString(spcContainer.CertificateHash),
+		"iv", hex.EncodeToString(spcContainer.AesKeyIV))
+}
 
+// printDebugTLLV logs a TLLV block of a decrypted SPC. The values are secrets, they include [SK..R1] and R2.
+func printDebugTLLV(ctx context.Context, block TLLVBlock) {
+	name, ok := spcTagNames[block.Tag]
+	if !ok {
+		name = "unknown"
+	}
+	logger.Debug(ctx, "spc tllv",
+		"tag", fmt.Sprintf("%x", block.Tag),
+		"name", name,
+		"value_length", block.ValueLength,
+		"block_length", block.BlockLength,
+		"value", logger.Secret(block.Value))
+
+	if block.Tag == tagMediaPlaybackState {
+		if playbackState, err := decodeMediaPlaybackState(block.Value); err == nil {
+			logger.Debug(ctx, "spc media playback state",
+				"creation_time", playbackState.CreationTime.Unix(),
+				"state", playbackState.State.String(),
+				"session_id", playbackState.SessionID)
+		}
+	}
 }
 
 // SPCK = RSA_OAEP d([SPCK])Prv where
-// [SPCK] represents the value of SPC message bytes 24-151. Prv represents the server's private key.
-func decryptSPCK(pub *rsa.PublicKey, pri *rsa.PrivateKey, enSpck []byte) ([]byte, error) {
-	if len(enSpck) != 128 {
-		return nil, errors.New("Wrong [SPCK] length, must be 128")
+// [SPCK] represents the value of SPC message bytes 24-151 (24-279 for SPC version 2). Prv represents the server's private key.
+func decryptSPCK(d crypto.Decrypter, enSpck []byte) ([]byte, error) {
+	pub, ok := d.Public().(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("decryptSPCK error: private key is not RSA")
+	}
+	if len(enSpck) != pub.Size() {
+		return nil, fmt.Errorf("Wrong [SPCK] length %d, must be %d for a %d-bit private key", len(enSpck), pub.Size(), pub.N.BitLen())
 	}
-	// spck, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, pri, enSpck, nil)
-	spck, err := cryptos.OAEPDecrypt(pub, pri, enSpck)
+	spck, err := cryptos.OAEPDecryptWith(d, enSpck)
 	if err != nil {
-		// create a slice for the errors
-		var errstrings []string
-		errstrings = append(errstrings, fmt.Errorf("decryptSPCK error:public key cann't matched").Error())
-		errstrings = append(errstrings, err.Error())
-		return nil, fmt.Errorf(strings.Join(errstrings, "\n"))
+		return nil, fmt.Errorf("decryptSPCK error: public key can't be matched: %w", err)
 	}
 
 	return spck, nil
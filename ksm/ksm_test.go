@@ -1,7 +1,15 @@
 package ksm
 
 import (
+	"crypto/md5"
+	cryptorand "crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"encoding/binary"
 	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
 	"os"
 	"testing"
 
@@ -55,361 +63,361 @@ oePtZ2SgXMlK5qnOpIuEDV9lIrGQDURxmw==
 var spcContainerTests = []spcTest{
 	{"../testdata/FPS/spc1.bin",
 		"../testdata/FPS/ckc1.bin",
-		2688,
-		[]byte{0x5d, 0x16, 0x44, 0xea, 0xec, 0x11, 0xf9, 0x83, 0x14, 0x75, 0x41, 0xe4, 0x6e, 0xeb, 0x27, 0x74},
-		[]byte{0x92, 0x66, 0x48, 0xb9, 0x86, 0x1e, 0xc0, 0x47, 0x1b, 0xa2, 0x17, 0x58, 0x85, 0x1c, 0x3d, 0xda, 0x31, 0xc9, 0x3b, 0x1d, 0xd6, 0x1, 0xaa, 0x4e, 0xad, 0x44, 0x15, 0xa2, 0x7, 0x59, 0xaa, 0xb9, 0xa6, 0xd8, 0x9f, 0x55, 0x13, 0x85, 0x85, 0x6e, 0x73, 0x57, 0x17, 0x29, 0xdf, 0x2f, 0x1d, 0x46, 0xd2, 0x5c, 0x13, 0xda, 0x2a, 0xd7, 0x5d, 0x0, 0xfd, 0x34, 0x13, 0xeb, 0xd9, 0x6c, 0xa4, 0x7d, 0x2, 0x95, 0x5c, 0x56, 0x9f, 0x7f, 0xab, 0x40, 0xf1, 0xa7, 0xfb, 0x23, 0x41, 0x41, 0x67, 0xa6, 0x53, 0xea, 0xbd, 0xf1, 0xad, 0x28, 0x3d, 0xf5, 0xe0, 0x7e, 0x7c, 0xf4, 0xaa, 0x2f, 0xba, 0xc6, 0x4f, 0x1d, 0x46, 0xf, 0xdf, 0x9a, 0x21, 0xee, 0xb2, 0x7a, 0x7f, 0x60, 0x72, 0x78, 0x53, 0xa4, 0x14, 0xc1, 0xc4, 0x50, 0xc5, 0x25, 0xe8, 0xda, 0xb6, 0xa3, 0xf1, 0x3c, 0xfa, 0x57, 0x17, 0x1a},
+		6288,
+		[]byte{0x6d, 0xf6, 0x8f, 0x7e, 0x3c, 0x56, 0x9f, 0x55, 0x4d, 0x54, 0xae, 0xbd, 0xea, 0x4a, 0xc6, 0x0},
+		[]byte{0xb6, 0x3c, 0xb5, 0xd3, 0x91, 0x5e, 0xae, 0xb6, 0x2e, 0x34, 0xfb, 0xe8, 0x2d, 0x29, 0x14, 0x3e, 0x2, 0x35, 0x9c, 0x22, 0x61, 0xf3, 0xd6, 0xf3, 0xeb, 0xc, 0xa9, 0xdb, 0x86, 0x58, 0xea, 0xed, 0x85, 0xfe, 0x5f, 0x84, 0x99, 0x70, 0x61, 0x9a, 0x82, 0x34, 0x32, 0xb5, 0x50, 0xb5, 0x83, 0x1f, 0xd, 0x5c, 0xd2, 0x31, 0xeb, 0x19, 0xd, 0x82, 0xfd, 0x29, 0xc5, 0x6f, 0xf7, 0x47, 0x31, 0xe6, 0xfc, 0x9, 0x7b, 0x41, 0xa8, 0x69, 0x1b, 0x48, 0x42, 0x7b, 0x6b, 0x66, 0x33, 0x4, 0xae, 0x99, 0xf0, 0xed, 0xe0, 0x94, 0x79, 0xca, 0xff, 0xeb, 0x8a, 0xda, 0xd2, 0xc7, 0x41, 0x9e, 0xb8, 0x22, 0x22, 0xf5, 0x81, 0xf, 0x20, 0x7f, 0x33, 0x64, 0xfa, 0x76, 0x37, 0x9a, 0xdb, 0xa2, 0x77, 0x48, 0x21, 0xa5, 0x92, 0x9b, 0x10, 0x75, 0x49, 0x60, 0x87, 0x8c, 0x68, 0x8e, 0x6d, 0x77, 0xeb, 0xa8},
 
 		[]TLLVBlock{
 			{
 				Tag:         tagSessionKeyR1Integrity,
-				BlockLength: 0x40,
+				BlockLength: 0xd0,
 				ValueLength: 0x10,
-				Value:       []byte{0x54, 0xa1, 0x6b, 0xe0, 0x13, 0x7e, 0xf2, 0x59, 0xab, 0x3e, 0x4f, 0xc7, 0x96, 0x90, 0x82, 0x5f},
+				Value:       []byte{0xf7, 0x48, 0xe6, 0xaa, 0xae, 0xfd, 0x18, 0xb, 0xc5, 0xd, 0x12, 0x65, 0x1b, 0x5d, 0xd2, 0xdd},
 			},
 			{
 				Tag:         tagSessionKeyR1,
-				BlockLength: 0x100,
+				BlockLength: 0xf0,
 				ValueLength: 0x70,
-				Value:       []byte{0x4f, 0x45, 0xd8, 0x5c, 0xe2, 0x62, 0x73, 0x10, 0x1a, 0x97, 0xf3, 0x30, 0x81, 0xc1, 0xd0, 0x4a, 0x93, 0xb2, 0xdd, 0x3, 0x55, 0xe3, 0x63, 0x72, 0x9d, 0x92, 0xa4, 0x5a, 0x45, 0xce, 0x8d, 0x25, 0x8b, 0xc, 0x8, 0xaa, 0x65, 0x1c, 0x9, 0x64, 0x97, 0x6b, 0xf0, 0x94, 0x4d, 0x28, 0x25, 0xf3, 0xac, 0x8d, 0xde, 0x7e, 0xd2, 0x31, 0x4f, 0xa0, 0xef, 0x3f, 0xb4, 0x5b, 0x97, 0xa2, 0x26, 0xe8, 0xc5, 0x36, 0x6d, 0xef, 0xe5, 0xf1, 0xe1, 0x2b, 0xd7, 0xb7, 0x21, 0x98, 0xa4, 0xa8, 0xf2, 0x65, 0x3a, 0xe, 0xf0, 0xde, 0x8c, 0x37, 0xa4, 0x7c, 0x3c, 0x40, 0xf0, 0x12, 0xe1, 0x5c, 0x8b, 0x59, 0x3d, 0xf1, 0x2d, 0x4b, 0x1, 0x60, 0x3a, 0x97, 0x35, 0x7e, 0x6a, 0xe0, 0xa1, 0x1c, 0xa3, 0xe3},
+				Value:       []byte{0x77, 0x8a, 0xff, 0xb1, 0x86, 0xb6, 0x92, 0xc1, 0xc9, 0x90, 0xae, 0x8a, 0x3a, 0x78, 0x7b, 0x9c, 0x39, 0x6d, 0xde, 0x6e, 0x2c, 0x32, 0x50, 0x27, 0x7d, 0x21, 0xfe, 0x73, 0x88, 0xee, 0xb1, 0xd1, 0x8, 0xa2, 0xa6, 0xa4, 0x2d, 0x4b, 0x52, 0x6a, 0x5e, 0xef, 0x8c, 0xc6, 0xe0, 0xe6, 0xb3, 0xc4, 0x1d, 0xc5, 0x1d, 0x69, 0xe7, 0x1d, 0x70, 0x19, 0xad, 0xcd, 0x69, 0x3d, 0x80, 0x76, 0x2e, 0xe9, 0xb2, 0xea, 0x1, 0x9, 0xc, 0x34, 0xba, 0x61, 0x36, 0xff, 0x32, 0x91, 0x3f, 0xf2, 0x38, 0x55, 0x95, 0x40, 0x2, 0xd, 0x66, 0x51, 0xc, 0xf2, 0x5, 0xaf, 0xc7, 0xa3, 0x4c, 0x3b, 0xea, 0x82, 0xb0, 0xd9, 0xa2, 0x7b, 0x2a, 0xc5, 0xc2, 0xc8, 0xde, 0x98, 0xec, 0x55, 0xcf, 0x47, 0xbd, 0x9a},
 			},
 			{
 				Tag:         tagAntiReplaySeed,
-				BlockLength: 0xd0,
+				BlockLength: 0x50,
 				ValueLength: 0x10,
-				Value:       []byte{0xf3, 0xc6, 0x9d, 0x1e, 0x8c, 0xc4, 0x27, 0x5a, 0x6d, 0x32, 0x86, 0xd3, 0x32, 0x61, 0x3e, 0x13},
+				Value:       []byte{0x8a, 0x75, 0xaf, 0x59, 0xe2, 0xfb, 0x92, 0xe2, 0xe3, 0x8e, 0x6c, 0x33, 0xec, 0x5b, 0xde, 0xd8},
 			},
 			{
 				Tag:         tagR2,
-				BlockLength: 0xb0,
+				BlockLength: 0x30,
 				ValueLength: 0x15,
-				Value:       []byte{0x11, 0xf7, 0xbe, 0x61, 0x2c, 0xa9, 0x5e, 0xf5, 0xe0, 0x7, 0xce, 0x51, 0x89, 0x6a, 0xe4, 0x50, 0x2c, 0xa3, 0xd8, 0x80, 0x1b},
+				Value:       []byte{0x4e, 0x1, 0x6b, 0x69, 0x1c, 0x67, 0x4, 0x36, 0xa2, 0x69, 0x57, 0x50, 0xb2, 0xab, 0xf2, 0x78, 0x91, 0x36, 0x79, 0xe3, 0x24},
 			},
 			{
 				Tag:         tagAssetID,
-				BlockLength: 0x80,
-				ValueLength: 0x12,
-				Value:       []byte{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff},
+				BlockLength: 0xd0,
+				ValueLength: 0x39,
+				Value:       []byte{0x73, 0x6b, 0x64, 0x3a, 0x2f, 0x2f, 0x66, 0x70, 0x73, 0x2e, 0x65, 0x7a, 0x64, 0x72, 0x6d, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x3b, 0x65, 0x35, 0x36, 0x38, 0x35, 0x65, 0x30, 0x38, 0x2d, 0x37, 0x32, 0x31, 0x34, 0x2d, 0x34, 0x61, 0x32, 0x62, 0x2d, 0x38, 0x37, 0x34, 0x31, 0x2d, 0x62, 0x30, 0x34, 0x37, 0x33, 0x65, 0x31, 0x65, 0x65, 0x35, 0x65, 0x34},
 			},
 			{
 				Tag:         tagTransactionID,
-				BlockLength: 0x70,
+				BlockLength: 0x40,
 				ValueLength: 0x8,
-				Value:       []byte{0x14, 0x73, 0xe5, 0xcc, 0x53, 0xe1, 0xe5, 0xd6},
+				Value:       []byte{0x5b, 0x57, 0x42, 0x30, 0x66, 0xa8, 0x55, 0xe9},
 			},
 			{
 				Tag:         tagProtocolVersionUsed,
-				BlockLength: 0xc0,
+				BlockLength: 0xa0,
 				ValueLength: 0x4,
 				Value:       []byte{0x0, 0x0, 0x0, 0x1},
 			},
 			{
 				Tag:         tagProtocolVersionsSupported,
-				BlockLength: 0xa0,
+				BlockLength: 0x40,
 				ValueLength: 0x4,
 				Value:       []byte{0x0, 0x0, 0x0, 0x1},
 			},
 			{
 				Tag:         tagReturnRequest,
-				BlockLength: 0x60,
-				ValueLength: 0x38,
-				Value:       []byte{0x1b, 0xf7, 0xf5, 0x3f, 0x5d, 0x5d, 0x5a, 0x1f, 0x47, 0xaa, 0x7a, 0xd3, 0x44, 0x5, 0x77, 0xde, 0xf9, 0x11, 0xf0, 0x4d, 0xa5, 0x4b, 0xf5, 0x99, 0xba, 0x8, 0xcc, 0x74, 0xda, 0xc9, 0x17, 0x6d, 0x13, 0xd, 0x99, 0x4c, 0xb8, 0x94, 0xb9, 0xe3, 0x66, 0xc8, 0x23, 0xf3, 0x79, 0xb8, 0x7b, 0xb5, 0x18, 0xd4, 0x2c, 0x5f, 0x8e, 0x54, 0x5a, 0x4b},
+				BlockLength: 0x50,
+				ValueLength: 0x40,
+				Value:       []byte{0x1b, 0xf7, 0xf5, 0x3f, 0x5d, 0x5d, 0x5a, 0x1f, 0x47, 0xaa, 0x7a, 0xd3, 0x44, 0x5, 0x77, 0xde, 0xc3, 0x92, 0xec, 0x58, 0x91, 0xef, 0xa7, 0xd0, 0x42, 0xfa, 0x15, 0x9b, 0x95, 0xf9, 0xfa, 0xa3, 0x70, 0xb2, 0xe3, 0x4a, 0x5a, 0x45, 0x4, 0x15, 0xd5, 0xcd, 0x37, 0xeb, 0x26, 0x8c, 0xc2, 0x4b, 0xc7, 0xa4, 0xaf, 0x46, 0x22, 0x4e, 0x6e, 0x9, 0xbd, 0x55, 0x24, 0x7d, 0x7a, 0x31, 0xfc, 0x51},
 			},
 		},
 	},
 	{"../testdata/FPS/spc2.bin",
 		"../testdata/FPS/ckc2.bin",
-		1984,
-		[]byte{0x88, 0x88, 0xc5, 0xa9, 0x42, 0x13, 0x3, 0x23, 0xaa, 0x4c, 0x9f, 0x1d, 0xa7, 0x7c, 0x88, 0x88},
-		[]byte{0x1f, 0x60, 0x34, 0x70, 0x48, 0x9d, 0xde, 0x55, 0xfb, 0xd2, 0x17, 0x90, 0x66, 0x29, 0x5, 0xf9, 0xfc, 0x7c, 0xf0, 0x41, 0x94, 0xf6, 0x49, 0xa7, 0x55, 0x1e, 0x19, 0xd7, 0xf2, 0x14, 0x5b, 0xfe, 0xcb, 0x8a, 0x7, 0xf9, 0x41, 0xcc, 0xb8, 0x9a, 0xce, 0xc0, 0xdc, 0x7c, 0xf, 0x8, 0x2c, 0x8c, 0xd5, 0x55, 0x60, 0xad, 0xb5, 0x6a, 0xae, 0x1c, 0xd9, 0x6e, 0xb2, 0x44, 0x43, 0x41, 0xeb, 0xbe, 0x84, 0x51, 0x8a, 0x93, 0x19, 0x30, 0x55, 0x6a, 0x88, 0x1f, 0xe2, 0x50, 0xf5, 0x7d, 0x21, 0x97, 0xea, 0x23, 0x9a, 0x79, 0xa8, 0x3c, 0xb4, 0x7d, 0xc8, 0x46, 0x1e, 0x4b, 0xe5, 0xeb, 0xee, 0xc7, 0x4b, 0x4e, 0x40, 0x79, 0xa9, 0x77, 0x29, 0xd9, 0xa5, 0x6d, 0xcd, 0x9f, 0x20, 0x54, 0xc3, 0x3f, 0xe0, 0xac, 0xeb, 0x61, 0x77, 0xea, 0x9e, 0x79, 0xd, 0x1a, 0xed, 0x62, 0x87, 0xbf, 0x8b, 0xb},
+		6288,
+		[]byte{0x6d, 0xf6, 0x8f, 0x7e, 0x3c, 0x56, 0x9f, 0x55, 0x4d, 0x54, 0xae, 0xbd, 0xea, 0x4a, 0xc6, 0x0},
+		[]byte{0xb6, 0x3c, 0xb5, 0xd3, 0x91, 0x5e, 0xae, 0xb6, 0x2e, 0x34, 0xfb, 0xe8, 0x2d, 0x29, 0x14, 0x3e, 0x2, 0x35, 0x9c, 0x22, 0x61, 0xf3, 0xd6, 0xf3, 0xeb, 0xc, 0xa9, 0xdb, 0x86, 0x58, 0xea, 0xed, 0x85, 0xfe, 0x5f, 0x84, 0x99, 0x70, 0x61, 0x9a, 0x82, 0x34, 0x32, 0xb5, 0x50, 0xb5, 0x83, 0x1f, 0xd, 0x5c, 0xd2, 0x31, 0xeb, 0x19, 0xd, 0x82, 0xfd, 0x29, 0xc5, 0x6f, 0xf7, 0x47, 0x31, 0xe6, 0xfc, 0x9, 0x7b, 0x41, 0xa8, 0x69, 0x1b, 0x48, 0x42, 0x7b, 0x6b, 0x66, 0x33, 0x4, 0xae, 0x99, 0xf0, 0xed, 0xe0, 0x94, 0x79, 0xca, 0xff, 0xeb, 0x8a, 0xda, 0xd2, 0xc7, 0x41, 0x9e, 0xb8, 0x22, 0x22, 0xf5, 0x81, 0xf, 0x20, 0x7f, 0x33, 0x64, 0xfa, 0x76, 0x37, 0x9a, 0xdb, 0xa2, 0x77, 0x48, 0x21, 0xa5, 0x92, 0x9b, 0x10, 0x75, 0x49, 0x60, 0x87, 0x8c, 0x68, 0x8e, 0x6d, 0x77, 0xeb, 0xa8},
 
 		[]TLLVBlock{
 			{
 				Tag:         tagSessionKeyR1Integrity,
-				BlockLength: 0x90,
+				BlockLength: 0xd0,
 				ValueLength: 0x10,
-				Value:       []byte{0x11, 0x66, 0x4f, 0xe9, 0x6e, 0x8c, 0xb8, 0x36, 0xaa, 0x2e, 0xb0, 0x64, 0xe8, 0x65, 0x66, 0x11},
+				Value:       []byte{0xf7, 0x48, 0xe6, 0xaa, 0xae, 0xfd, 0x18, 0xb, 0xc5, 0xd, 0x12, 0x65, 0x1b, 0x5d, 0xd2, 0xdd},
 			},
 			{
 				Tag:         tagSessionKeyR1,
-				BlockLength: 0x90,
+				BlockLength: 0xf0,
 				ValueLength: 0x70,
-				Value:       []byte{0xaa, 0xaa, 0xbb, 0xbb, 0xcc, 0xcc, 0x82, 0x30, 0xe8, 0x9a, 0xce, 0xfa, 0xdd, 0xdd, 0xaa, 0xaa, 0x79, 0x2e, 0xf7, 0x42, 0xf, 0x47, 0x9b, 0x80, 0x56, 0x7e, 0x4f, 0x8b, 0xe8, 0x3e, 0xac, 0x8b, 0xfe, 0xb, 0x75, 0x51, 0x4a, 0x7c, 0xda, 0x90, 0xe8, 0xef, 0x55, 0xac, 0xf4, 0xf, 0x3c, 0x59, 0xcd, 0xfc, 0x7d, 0xdd, 0x34, 0xcb, 0x92, 0x29, 0x73, 0x3d, 0x3, 0xcd, 0x59, 0xbd, 0x1a, 0x6, 0xba, 0x21, 0xe9, 0x3e, 0x2a, 0xe, 0xf4, 0x50, 0x25, 0xb1, 0x14, 0x7c, 0xb5, 0x3, 0x44, 0x96, 0x5e, 0xa0, 0x66, 0x18, 0x35, 0xf, 0xb4, 0x5b, 0x4a, 0xb6, 0xf7, 0xb5, 0xb6, 0xd1, 0x6c, 0x3f, 0x9a, 0x3d, 0x9f, 0x7c, 0x38, 0xa4, 0xaa, 0x97, 0xea, 0x32, 0x66, 0x3d, 0x6d, 0x4a, 0xac, 0x11},
+				Value:       []byte{0x77, 0x8a, 0xff, 0xb1, 0x86, 0xb6, 0x92, 0xc1, 0xc9, 0x90, 0xae, 0x8a, 0x3a, 0x78, 0x7b, 0x9c, 0x39, 0x6d, 0xde, 0x6e, 0x2c, 0x32, 0x50, 0x27, 0x7d, 0x21, 0xfe, 0x73, 0x88, 0xee, 0xb1, 0xd1, 0x8, 0xa2, 0xa6, 0xa4, 0x2d, 0x4b, 0x52, 0x6a, 0x5e, 0xef, 0x8c, 0xc6, 0xe0, 0xe6, 0xb3, 0xc4, 0x1d, 0xc5, 0x1d, 0x69, 0xe7, 0x1d, 0x70, 0x19, 0xad, 0xcd, 0x69, 0x3d, 0x80, 0x76, 0x2e, 0xe9, 0xb2, 0xea, 0x1, 0x9, 0xc, 0x34, 0xba, 0x61, 0x36, 0xff, 0x32, 0x91, 0x3f, 0xf2, 0x38, 0x55, 0x95, 0x40, 0x2, 0xd, 0x66, 0x51, 0xc, 0xf2, 0x5, 0xaf, 0xc7, 0xa3, 0x4c, 0x3b, 0xea, 0x82, 0xb0, 0xd9, 0xa2, 0x7b, 0x2a, 0xc5, 0xc2, 0xc8, 0xde, 0x98, 0xec, 0x55, 0xcf, 0x47, 0xbd, 0x9a},
 			},
 			{
 				Tag:         tagAntiReplaySeed,
-				BlockLength: 0xa0,
+				BlockLength: 0x50,
 				ValueLength: 0x10,
-				Value:       []byte{0x2d, 0x9e, 0x8f, 0x28, 0x97, 0xc0, 0xc7, 0xa7, 0x17, 0xe0, 0x95, 0x5d, 0x3c, 0xea, 0xfa, 0x2d},
+				Value:       []byte{0x8a, 0x75, 0xaf, 0x59, 0xe2, 0xfb, 0x92, 0xe2, 0xe3, 0x8e, 0x6c, 0x33, 0xec, 0x5b, 0xde, 0xd8},
 			},
 			{
 				Tag:         tagR2,
-				BlockLength: 0xb0,
+				BlockLength: 0x30,
 				ValueLength: 0x15,
-				Value:       []byte{0x11, 0xf7, 0xbe, 0x61, 0x2c, 0xa9, 0x5e, 0xf5, 0xe0, 0x7, 0xce, 0x51, 0x89, 0x6a, 0xe4, 0x50, 0x2c, 0xa3, 0xd8, 0x80, 0x1b},
+				Value:       []byte{0x4e, 0x1, 0x6b, 0x69, 0x1c, 0x67, 0x4, 0x36, 0xa2, 0x69, 0x57, 0x50, 0xb2, 0xab, 0xf2, 0x78, 0x91, 0x36, 0x79, 0xe3, 0x24},
 			},
 			{
 				Tag:         tagAssetID,
-				BlockLength: 0x50,
-				ValueLength: 0x3,
-				Value:       []byte{0x6f, 0x6e, 0x65},
+				BlockLength: 0xd0,
+				ValueLength: 0x39,
+				Value:       []byte{0x73, 0x6b, 0x64, 0x3a, 0x2f, 0x2f, 0x66, 0x70, 0x73, 0x2e, 0x65, 0x7a, 0x64, 0x72, 0x6d, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x3b, 0x65, 0x35, 0x36, 0x38, 0x35, 0x65, 0x30, 0x38, 0x2d, 0x37, 0x32, 0x31, 0x34, 0x2d, 0x34, 0x61, 0x32, 0x62, 0x2d, 0x38, 0x37, 0x34, 0x31, 0x2d, 0x62, 0x30, 0x34, 0x37, 0x33, 0x65, 0x31, 0x65, 0x65, 0x35, 0x65, 0x34},
 			},
 			{
 				Tag:         tagTransactionID,
-				BlockLength: 0x80,
+				BlockLength: 0x40,
 				ValueLength: 0x8,
-				Value:       []byte{0xde, 0xad, 0xc0, 0xde, 0xde, 0xad, 0xc0, 0xde},
+				Value:       []byte{0x5b, 0x57, 0x42, 0x30, 0x66, 0xa8, 0x55, 0xe9},
 			},
 			{
 				Tag:         tagProtocolVersionUsed,
-				BlockLength: 0x80,
+				BlockLength: 0xa0,
 				ValueLength: 0x4,
 				Value:       []byte{0x0, 0x0, 0x0, 0x1},
 			},
 			{
 				Tag:         tagProtocolVersionsSupported,
-				BlockLength: 0x10,
+				BlockLength: 0x40,
 				ValueLength: 0x4,
 				Value:       []byte{0x0, 0x0, 0x0, 0x1},
 			},
 			{
 				Tag:         tagReturnRequest,
 				BlockLength: 0x50,
-				ValueLength: 0x18,
-				Value:       []byte{0x1b, 0xf7, 0xf5, 0x3f, 0x5d, 0x5d, 0x5a, 0x1f, 0x47, 0xaa, 0x7a, 0xd3, 0x44, 0x5, 0x77, 0xde, 0xab, 0xb0, 0x25, 0x6a, 0x31, 0x84, 0x39, 0x74},
+				ValueLength: 0x40,
+				Value:       []byte{0x1b, 0xf7, 0xf5, 0x3f, 0x5d, 0x5d, 0x5a, 0x1f, 0x47, 0xaa, 0x7a, 0xd3, 0x44, 0x5, 0x77, 0xde, 0xc3, 0x92, 0xec, 0x58, 0x91, 0xef, 0xa7, 0xd0, 0x42, 0xfa, 0x15, 0x9b, 0x95, 0xf9, 0xfa, 0xa3, 0x70, 0xb2, 0xe3, 0x4a, 0x5a, 0x45, 0x4, 0x15, 0xd5, 0xcd, 0x37, 0xeb, 0x26, 0x8c, 0xc2, 0x4b, 0xc7, 0xa4, 0xaf, 0x46, 0x22, 0x4e, 0x6e, 0x9, 0xbd, 0x55, 0x24, 0x7d, 0x7a, 0x31, 0xfc, 0x51},
 			},
 		},
 	},
 	{"../testdata/FPS/spc3.bin",
 		"../testdata/FPS/ckc3.bin",
-		3952,
-		[]byte{0x5d, 0x16, 0x44, 0xea, 0xec, 0x11, 0xf9, 0x83, 0x14, 0x75, 0x41, 0xe4, 0x6e, 0xeb, 0x27, 0x74},
-		[]byte{0x60, 0x23, 0x52, 0xc2, 0xe6, 0xee, 0xfc, 0xa, 0x14, 0x86, 0x87, 0xf, 0x48, 0xe7, 0xa4, 0xe6, 0x44, 0x33, 0x52, 0x8f, 0x2a, 0x92, 0xe6, 0xc8, 0xe0, 0x60, 0xaf, 0x12, 0x91, 0x70, 0x86, 0x36, 0x84, 0xfd, 0x4a, 0x6a, 0x1b, 0xf4, 0xbe, 0xa7, 0x9f, 0xd9, 0x1b, 0xb2, 0xb0, 0x7a, 0xcc, 0xb4, 0x8b, 0xad, 0xa4, 0xdd, 0x87, 0x86, 0x23, 0x32, 0xc7, 0x5b, 0x8, 0xd9, 0x6f, 0x2e, 0x50, 0x1b, 0x8d, 0x23, 0xe2, 0x78, 0x55, 0x6e, 0x8d, 0xd5, 0xc1, 0x6a, 0x3e, 0xfe, 0x75, 0xad, 0x77, 0x56, 0x7a, 0xb, 0x52, 0x9e, 0xe2, 0x73, 0x34, 0x54, 0x58, 0xbd, 0x39, 0x20, 0xb8, 0xaa, 0x2d, 0x54, 0xc0, 0x50, 0xb0, 0x3c, 0x63, 0x0, 0x26, 0xc8, 0x27, 0x19, 0xf8, 0xe8, 0x63, 0xba, 0xbd, 0x4a, 0xc5, 0xab, 0x10, 0x9a, 0xf, 0xe2, 0x85, 0xfb, 0xee, 0xf, 0x26, 0xe0, 0x37, 0x48, 0x45, 0xa0},
+		6288,
+		[]byte{0x6d, 0xf6, 0x8f, 0x7e, 0x3c, 0x56, 0x9f, 0x55, 0x4d, 0x54, 0xae, 0xbd, 0xea, 0x4a, 0xc6, 0x0},
+		[]byte{0xb6, 0x3c, 0xb5, 0xd3, 0x91, 0x5e, 0xae, 0xb6, 0x2e, 0x34, 0xfb, 0xe8, 0x2d, 0x29, 0x14, 0x3e, 0x2, 0x35, 0x9c, 0x22, 0x61, 0xf3, 0xd6, 0xf3, 0xeb, 0xc, 0xa9, 0xdb, 0x86, 0x58, 0xea, 0xed, 0x85, 0xfe, 0x5f, 0x84, 0x99, 0x70, 0x61, 0x9a, 0x82, 0x34, 0x32, 0xb5, 0x50, 0xb5, 0x83, 0x1f, 0xd, 0x5c, 0xd2, 0x31, 0xeb, 0x19, 0xd, 0x82, 0xfd, 0x29, 0xc5, 0x6f, 0xf7, 0x47, 0x31, 0xe6, 0xfc, 0x9, 0x7b, 0x41, 0xa8, 0x69, 0x1b, 0x48, 0x42, 0x7b, 0x6b, 0x66, 0x33, 0x4, 0xae, 0x99, 0xf0, 0xed, 0xe0, 0x94, 0x79, 0xca, 0xff, 0xeb, 0x8a, 0xda, 0xd2, 0xc7, 0x41, 0x9e, 0xb8, 0x22, 0x22, 0xf5, 0x81, 0xf, 0x20, 0x7f, 0x33, 0x64, 0xfa, 0x76, 0x37, 0x9a, 0xdb, 0xa2, 0x77, 0x48, 0x21, 0xa5, 0x92, 0x9b, 0x10, 0x75, 0x49, 0x60, 0x87, 0x8c, 0x68, 0x8e, 0x6d, 0x77, 0xeb, 0xa8},
 
 		[]TLLVBlock{
 			{
 				Tag:         tagSessionKeyR1Integrity,
-				BlockLength: 0x90,
+				BlockLength: 0xd0,
 				ValueLength: 0x10,
-				Value:       []byte{0x54, 0xa1, 0x6b, 0xe0, 0x13, 0x7e, 0xf2, 0x59, 0xab, 0x3e, 0x4f, 0xc7, 0x96, 0x90, 0x82, 0x5f},
+				Value:       []byte{0xf7, 0x48, 0xe6, 0xaa, 0xae, 0xfd, 0x18, 0xb, 0xc5, 0xd, 0x12, 0x65, 0x1b, 0x5d, 0xd2, 0xdd},
 			},
 			{
 				Tag:         tagSessionKeyR1,
 				BlockLength: 0xf0,
 				ValueLength: 0x70,
-				Value:       []byte{0x32, 0xc0, 0x82, 0xc9, 0xe2, 0x62, 0x73, 0x10, 0x1a, 0x97, 0xf3, 0x30, 0x81, 0xc1, 0xd0, 0x4a, 0xde, 0x58, 0xda, 0x53, 0xd7, 0xee, 0x17, 0x3e, 0xfd, 0xf0, 0xd1, 0xd3, 0xf0, 0x51, 0x4, 0xa9, 0xcb, 0x3a, 0x21, 0x3c, 0x7a, 0xc5, 0xab, 0x2b, 0x4c, 0x45, 0x2b, 0x95, 0x77, 0x79, 0x9f, 0x38, 0x6, 0xa0, 0x96, 0x47, 0xa5, 0xe5, 0xd2, 0x16, 0x74, 0x61, 0x73, 0x33, 0xe3, 0x2e, 0xc1, 0x20, 0x14, 0x74, 0x3c, 0x4e, 0x16, 0xb6, 0xd9, 0x6a, 0x61, 0xfc, 0xa5, 0x6b, 0xcb, 0x69, 0x6c, 0x75, 0xe9, 0x23, 0x75, 0x95, 0x35, 0xb3, 0x51, 0xb8, 0xc6, 0x27, 0xa2, 0x9c, 0x76, 0x69, 0xc8, 0xbf, 0x88, 0xc1, 0x40, 0x86, 0x4, 0x56, 0xef, 0x89, 0xf2, 0x8c, 0xe, 0xc6, 0xc9, 0x5a, 0xa6, 0xc3},
+				Value:       []byte{0x77, 0x8a, 0xff, 0xb1, 0x86, 0xb6, 0x92, 0xc1, 0xc9, 0x90, 0xae, 0x8a, 0x3a, 0x78, 0x7b, 0x9c, 0x39, 0x6d, 0xde, 0x6e, 0x2c, 0x32, 0x50, 0x27, 0x7d, 0x21, 0xfe, 0x73, 0x88, 0xee, 0xb1, 0xd1, 0x8, 0xa2, 0xa6, 0xa4, 0x2d, 0x4b, 0x52, 0x6a, 0x5e, 0xef, 0x8c, 0xc6, 0xe0, 0xe6, 0xb3, 0xc4, 0x1d, 0xc5, 0x1d, 0x69, 0xe7, 0x1d, 0x70, 0x19, 0xad, 0xcd, 0x69, 0x3d, 0x80, 0x76, 0x2e, 0xe9, 0xb2, 0xea, 0x1, 0x9, 0xc, 0x34, 0xba, 0x61, 0x36, 0xff, 0x32, 0x91, 0x3f, 0xf2, 0x38, 0x55, 0x95, 0x40, 0x2, 0xd, 0x66, 0x51, 0xc, 0xf2, 0x5, 0xaf, 0xc7, 0xa3, 0x4c, 0x3b, 0xea, 0x82, 0xb0, 0xd9, 0xa2, 0x7b, 0x2a, 0xc5, 0xc2, 0xc8, 0xde, 0x98, 0xec, 0x55, 0xcf, 0x47, 0xbd, 0x9a},
 			},
 			{
 				Tag:         tagAntiReplaySeed,
-				BlockLength: 0x20,
+				BlockLength: 0x50,
 				ValueLength: 0x10,
-				Value:       []byte{0xe0, 0xb4, 0xf2, 0x62, 0xf7, 0x6b, 0x54, 0x6d, 0x85, 0xf6, 0x22, 0xa6, 0xff, 0x48, 0x6c, 0xab},
+				Value:       []byte{0x8a, 0x75, 0xaf, 0x59, 0xe2, 0xfb, 0x92, 0xe2, 0xe3, 0x8e, 0x6c, 0x33, 0xec, 0x5b, 0xde, 0xd8},
 			},
 			{
 				Tag:         tagR2,
-				BlockLength: 0xc0,
+				BlockLength: 0x30,
 				ValueLength: 0x15,
-				Value:       []byte{0x11, 0xf7, 0xbe, 0x61, 0x2c, 0xa9, 0x5e, 0xf5, 0xe0, 0x7, 0xce, 0x51, 0x89, 0x6a, 0xe4, 0x50, 0x2c, 0xa3, 0xd8, 0x80, 0x1b},
+				Value:       []byte{0x4e, 0x1, 0x6b, 0x69, 0x1c, 0x67, 0x4, 0x36, 0xa2, 0x69, 0x57, 0x50, 0xb2, 0xab, 0xf2, 0x78, 0x91, 0x36, 0x79, 0xe3, 0x24},
 			},
 			{
 				Tag:         tagAssetID,
-				BlockLength: 0x70,
-				ValueLength: 0x12,
-				Value:       []byte{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff},
+				BlockLength: 0xd0,
+				ValueLength: 0x39,
+				Value:       []byte{0x73, 0x6b, 0x64, 0x3a, 0x2f, 0x2f, 0x66, 0x70, 0x73, 0x2e, 0x65, 0x7a, 0x64, 0x72, 0x6d, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x3b, 0x65, 0x35, 0x36, 0x38, 0x35, 0x65, 0x30, 0x38, 0x2d, 0x37, 0x32, 0x31, 0x34, 0x2d, 0x34, 0x61, 0x32, 0x62, 0x2d, 0x38, 0x37, 0x34, 0x31, 0x2d, 0x62, 0x30, 0x34, 0x37, 0x33, 0x65, 0x31, 0x65, 0x65, 0x35, 0x65, 0x34},
 			},
 			{
 				Tag:         tagTransactionID,
-				BlockLength: 0x80,
+				BlockLength: 0x40,
 				ValueLength: 0x8,
-				Value:       []byte{0x14, 0x73, 0xe5, 0xcc, 0x53, 0xe1, 0xe5, 0xd6},
+				Value:       []byte{0x5b, 0x57, 0x42, 0x30, 0x66, 0xa8, 0x55, 0xe9},
 			},
 			{
 				Tag:         tagProtocolVersionUsed,
-				BlockLength: 0x90,
+				BlockLength: 0xa0,
 				ValueLength: 0x4,
 				Value:       []byte{0x0, 0x0, 0x0, 0x1},
 			},
 			{
 				Tag:         tagProtocolVersionsSupported,
-				BlockLength: 0x70,
+				BlockLength: 0x40,
 				ValueLength: 0x4,
 				Value:       []byte{0x0, 0x0, 0x0, 0x1},
 			},
 			{
 				Tag:         tagReturnRequest,
-				BlockLength: 0xb0,
-				ValueLength: 0x38,
-				Value:       []byte{0x1b, 0xf7, 0xf5, 0x3f, 0x5d, 0x5d, 0x5a, 0x1f, 0x47, 0xaa, 0x7a, 0xd3, 0x44, 0x5, 0x77, 0xde, 0x93, 0xc8, 0x23, 0x2c, 0x79, 0xb8, 0x1a, 0xb5, 0xce, 0xe6, 0x71, 0xf4, 0x89, 0xb4, 0xa, 0x6b, 0xf1, 0xd1, 0xeb, 0xe8, 0x98, 0xc0, 0x97, 0xd7, 0xbf, 0x91, 0xbc, 0x75, 0xab, 0xba, 0x19, 0xf7, 0x12, 0x47, 0x41, 0x85, 0x46, 0x71, 0x2c, 0x7d},
+				BlockLength: 0x50,
+				ValueLength: 0x40,
+				Value:       []byte{0x1b, 0xf7, 0xf5, 0x3f, 0x5d, 0x5d, 0x5a, 0x1f, 0x47, 0xaa, 0x7a, 0xd3, 0x44, 0x5, 0x77, 0xde, 0xc3, 0x92, 0xec, 0x58, 0x91, 0xef, 0xa7, 0xd0, 0x42, 0xfa, 0x15, 0x9b, 0x95, 0xf9, 0xfa, 0xa3, 0x70, 0xb2, 0xe3, 0x4a, 0x5a, 0x45, 0x4, 0x15, 0xd5, 0xcd, 0x37, 0xeb, 0x26, 0x8c, 0xc2, 0x4b, 0xc7, 0xa4, 0xaf, 0x46, 0x22, 0x4e, 0x6e, 0x9, 0xbd, 0x55, 0x24, 0x7d, 0x7a, 0x31, 0xfc, 0x51},
 			},
 		},
 	},
 	{"../testdata/FPS-lease/spc1.bin",
 		"../testdata/FPS-lease/ckc1.bin",
-		2032,
-		[]byte{0xaf, 0xbf, 0xde, 0x35, 0xd2, 0x72, 0xa6, 0xb7, 0xc4, 0xd3, 0x85, 0xe2, 0xd4, 0xde, 0x2a, 0xb6},
-		[]byte{0x8, 0x17, 0xc3, 0xe6, 0x18, 0xb2, 0x68, 0xab, 0x1a, 0xac, 0x5, 0xd3, 0xe, 0x91, 0x4b, 0xd2, 0xa8, 0x32, 0x61, 0x43, 0xe4, 0x0, 0xdd, 0xce, 0xa0, 0x63, 0x7b, 0xa6, 0xa1, 0xd3, 0xe4, 0x9a, 0x99, 0x6, 0x36, 0x1d, 0x79, 0x14, 0x34, 0x87, 0xee, 0xc4, 0x17, 0xe2, 0xec, 0x8c, 0xf7, 0xe3, 0x7a, 0x4b, 0xa4, 0xba, 0x3e, 0x81, 0xd7, 0xbe, 0xd, 0xf, 0xf1, 0x1b, 0xcb, 0x9, 0x74, 0xab, 0xb5, 0xb7, 0x40, 0x35, 0xc5, 0xff, 0xc7, 0x97, 0xe7, 0xb2, 0xc9, 0xf5, 0x1d, 0xf9, 0x69, 0x4a, 0xd7, 0x40, 0x30, 0x37, 0xd6, 0x64, 0x73, 0x8, 0xa7, 0xbf, 0x1, 0xc7, 0xde, 0xf7, 0xb4, 0x3f, 0x57, 0x17, 0xbf, 0x94, 0x8b, 0x24, 0xe3, 0x74, 0x52, 0x9d, 0xb2, 0xc6, 0x53, 0xbf, 0x98, 0x17, 0x2e, 0xff, 0x7b, 0xad, 0x4c, 0x82, 0x4d, 0xe5, 0xdc, 0x59, 0xc2, 0xba, 0x43, 0xe3, 0xf4, 0xd3},
+		6944,
+		[]byte{0xf, 0xf6, 0x72, 0x73, 0xe1, 0xd5, 0xcd, 0x24, 0xad, 0x1b, 0x48, 0x5b, 0x3e, 0x22, 0x10, 0x58},
+		[]byte{0x46, 0xf9, 0x53, 0x4d, 0xad, 0x38, 0xa7, 0x13, 0xf9, 0xa7, 0xb4, 0xdc, 0x2d, 0xae, 0x42, 0x78, 0x8e, 0x2a, 0xb8, 0x84, 0xc1, 0x83, 0x50, 0x44, 0xcf, 0x8b, 0x1c, 0x29, 0xa, 0xed, 0xc0, 0x94, 0x21, 0x24, 0x93, 0xce, 0x27, 0xcd, 0x5, 0x73, 0x95, 0x5e, 0xde, 0xbe, 0xef, 0x67, 0x89, 0xc8, 0xf7, 0xf5, 0xc5, 0xbc, 0x4b, 0x1c, 0x6b, 0xcb, 0xa1, 0x49, 0xe1, 0x34, 0x9a, 0xc1, 0xa3, 0x79, 0x98, 0x1b, 0xad, 0x52, 0x57, 0x99, 0x42, 0xaa, 0x22, 0xd0, 0x71, 0x6, 0x1b, 0x69, 0xbc, 0x11, 0xeb, 0x7a, 0x55, 0x3e, 0xe0, 0x69, 0x84, 0xe3, 0x46, 0x6a, 0x2e, 0xfe, 0x2f, 0x51, 0x36, 0x93, 0x52, 0xb4, 0x2, 0x3d, 0xd7, 0xdb, 0x49, 0xab, 0x4c, 0x7c, 0xb2, 0xbe, 0xf, 0x41, 0x20, 0xf1, 0xaf, 0xfa, 0xc9, 0x4a, 0x7b, 0xe5, 0xc5, 0x3f, 0xc0, 0xee, 0x80, 0xe4, 0xed, 0x77, 0x24, 0x81},
 
 		[]TLLVBlock{
 			{
 				Tag:         tagSessionKeyR1Integrity,
-				BlockLength: 0xb0,
+				BlockLength: 0xd0,
 				ValueLength: 0x10,
-				Value:       []byte{0x82, 0x9b, 0x46, 0x34, 0x85, 0x5d, 0x65, 0x7c, 0xfe, 0xac, 0x62, 0x7e, 0x2d, 0x6d, 0x63, 0x5a},
+				Value:       []byte{0x1a, 0x48, 0x5b, 0xbc, 0x8b, 0xff, 0x42, 0x45, 0x32, 0xd7, 0xb6, 0x9, 0x92, 0xa7, 0xbe, 0xad},
 			},
 			{
 				Tag:         tagSessionKeyR1,
-				BlockLength: 0xe0,
+				BlockLength: 0xf0,
 				ValueLength: 0x70,
-				Value:       []byte{0xaa, 0xaa, 0xbb, 0xbb, 0xcc, 0xcc, 0x82, 0x30, 0xe8, 0x9a, 0xce, 0xfa, 0xdd, 0xdd, 0xaa, 0xaa, 0x79, 0x2e, 0xf7, 0x42, 0xf, 0x47, 0x9b, 0x80, 0x56, 0x7e, 0x4f, 0x8b, 0xe8, 0x3e, 0xac, 0x8b, 0xfe, 0xb, 0x75, 0x51, 0x4a, 0x7c, 0xda, 0x90, 0xe8, 0xef, 0x55, 0xac, 0xf4, 0xf, 0x3c, 0x59, 0x29, 0x2f, 0xd5, 0x0, 0xca, 0x4b, 0x3b, 0xdb, 0x48, 0x33, 0xd2, 0x45, 0x87, 0xaa, 0x87, 0x35, 0x8b, 0xc6, 0xe5, 0x97, 0xdb, 0x6c, 0x3c, 0xd1, 0xa4, 0xb5, 0xd0, 0x63, 0x8d, 0x99, 0xcf, 0xeb, 0x1a, 0x4d, 0x10, 0xa3, 0xf0, 0x90, 0x9d, 0x24, 0x2b, 0x2d, 0x8d, 0xf4, 0x5d, 0xd8, 0xe, 0x67, 0x51, 0x44, 0x6, 0xa9, 0x28, 0x3c, 0xd3, 0x68, 0x71, 0x82, 0xb4, 0xcd, 0x39, 0xa2, 0x75, 0xe},
+				Value:       []byte{0xe9, 0xd2, 0x3e, 0x5a, 0x6a, 0x40, 0xa0, 0x36, 0x16, 0x88, 0x62, 0xab, 0x79, 0x46, 0xe1, 0xf0, 0xf2, 0x33, 0x96, 0x91, 0xf7, 0xef, 0x6b, 0x63, 0xab, 0x27, 0x19, 0xfb, 0xf6, 0x77, 0xc2, 0x90, 0xcb, 0x3c, 0x4f, 0xaf, 0x8e, 0x79, 0x5, 0x8b, 0xc1, 0xec, 0x7d, 0x6a, 0xc3, 0xef, 0xcc, 0x21, 0x7e, 0xd1, 0x39, 0x60, 0xd5, 0x3a, 0xc3, 0xb5, 0x87, 0x65, 0x95, 0xa9, 0xa5, 0xcd, 0xf6, 0x2f, 0xc6, 0x38, 0xda, 0xcc, 0x9f, 0x7d, 0xae, 0xc9, 0x64, 0xfd, 0x5e, 0xe2, 0x42, 0x31, 0x8c, 0x4c, 0xaa, 0x7f, 0x16, 0xe5, 0x93, 0x21, 0xc2, 0x15, 0x2c, 0x6b, 0x65, 0x5c, 0xc0, 0x0, 0x46, 0x69, 0xa1, 0xd9, 0x8f, 0x51, 0xf8, 0xbb, 0x55, 0x39, 0xb6, 0x6c, 0x93, 0x20, 0xf3, 0x54, 0xa4, 0xaf},
 			},
 			{
 				Tag:         tagAntiReplaySeed,
-				BlockLength: 0x30,
+				BlockLength: 0x50,
 				ValueLength: 0x10,
-				Value:       []byte{0x2d, 0x9e, 0x8f, 0x28, 0x97, 0xc0, 0xc7, 0xa7, 0x17, 0xe0, 0x95, 0x5d, 0x3c, 0xea, 0xfa, 0x2d},
+				Value:       []byte{0xb, 0xf1, 0x22, 0xd1, 0x39, 0xe0, 0xdd, 0xf3, 0x64, 0xd0, 0xf3, 0x35, 0xde, 0x4d, 0xec, 0x80},
 			},
 			{
 				Tag:         tagR2,
-				BlockLength: 0x30,
+				BlockLength: 0x50,
 				ValueLength: 0x15,
-				Value:       []byte{0x11, 0xf7, 0xbe, 0x61, 0x2c, 0xa9, 0x5e, 0xf5, 0xe0, 0x7, 0xce, 0x51, 0x89, 0x6a, 0xe4, 0x50, 0x2c, 0xa3, 0xd8, 0x80, 0x1b},
+				Value:       []byte{0xa7, 0x87, 0x78, 0xd8, 0xfd, 0xe4, 0xa3, 0xa6, 0xf8, 0xa1, 0xb1, 0xa8, 0xbf, 0x5d, 0xd6, 0xfb, 0xf4, 0xfb, 0x15, 0x37, 0x53},
 			},
 			{
 				Tag:         tagAssetID,
-				BlockLength: 0xa0,
-				ValueLength: 0x3,
-				Value:       []byte{0x6f, 0x6e, 0x65},
+				BlockLength: 0xf0,
+				ValueLength: 0x39,
+				Value:       []byte{0x73, 0x6b, 0x64, 0x3a, 0x2f, 0x2f, 0x66, 0x70, 0x73, 0x2e, 0x65, 0x7a, 0x64, 0x72, 0x6d, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x3b, 0x65, 0x35, 0x36, 0x38, 0x35, 0x65, 0x30, 0x38, 0x2d, 0x37, 0x32, 0x31, 0x34, 0x2d, 0x34, 0x61, 0x32, 0x62, 0x2d, 0x38, 0x37, 0x34, 0x31, 0x2d, 0x62, 0x30, 0x34, 0x37, 0x33, 0x65, 0x31, 0x65, 0x65, 0x35, 0x65, 0x34},
 			},
 			{
 				Tag:         tagTransactionID,
-				BlockLength: 0xb0,
+				BlockLength: 0xc0,
 				ValueLength: 0x8,
-				Value:       []byte{0x13, 0x6b, 0x1a, 0x97, 0xa3, 0xd6, 0xb0, 0xfa},
+				Value:       []byte{0xd1, 0xe6, 0xe7, 0xc, 0x2, 0xd, 0xb9, 0x41},
 			},
 			{
 				Tag:         tagProtocolVersionUsed,
-				BlockLength: 0x60,
+				BlockLength: 0xc0,
 				ValueLength: 0x4,
 				Value:       []byte{0x0, 0x0, 0x0, 0x1},
 			},
 			{
 				Tag:         tagProtocolVersionsSupported,
-				BlockLength: 0x30,
-				ValueLength: 0x8,
-				Value:       []byte{0x0, 0x0, 0x0, 0x1, 0x0, 0x0, 0x0, 0x2},
+				BlockLength: 0xc0,
+				ValueLength: 0x4,
+				Value:       []byte{0x0, 0x0, 0x0, 0x1},
 			},
 			{
 				Tag:         tagReturnRequest,
-				BlockLength: 0x40,
-				ValueLength: 0x18,
-				Value:       []byte{0x1b, 0xf7, 0xf5, 0x3f, 0x5d, 0x5d, 0x5a, 0x1f, 0x47, 0xaa, 0x7a, 0xd3, 0x44, 0x5, 0x77, 0xde, 0xc3, 0x92, 0xec, 0x58, 0x91, 0xef, 0xa7, 0xd0},
+				BlockLength: 0xc0,
+				ValueLength: 0x40,
+				Value:       []byte{0x1b, 0xf7, 0xf5, 0x3f, 0x5d, 0x5d, 0x5a, 0x1f, 0x47, 0xaa, 0x7a, 0xd3, 0x44, 0x5, 0x77, 0xde, 0xc3, 0x92, 0xec, 0x58, 0x91, 0xef, 0xa7, 0xd0, 0x42, 0xfa, 0x15, 0x9b, 0x95, 0xf9, 0xfa, 0xa3, 0x6, 0x5a, 0x56, 0x14, 0x9a, 0xef, 0x1b, 0x21, 0xd5, 0xcd, 0x37, 0xeb, 0x26, 0x8c, 0xc2, 0x4b, 0x65, 0x7a, 0xd9, 0x55, 0xb5, 0x8b, 0x62, 0x23, 0xd9, 0xb0, 0x88, 0x84, 0x79, 0x23, 0x36, 0x81},
 			},
 		},
 	},
 	{"../testdata/FPS-lease/spc2.bin",
 		"../testdata/FPS-lease/ckc2.bin",
-		1968,
-		[]byte{0x5b, 0xe8, 0xec, 0x5c, 0xd4, 0x1f, 0x31, 0x60, 0x8d, 0x82, 0x24, 0xfc, 0xc4, 0x60, 0xce, 0x69},
-		[]byte{0x2b, 0x5a, 0x57, 0x75, 0x62, 0x0, 0x80, 0x68, 0x61, 0xb8, 0x8e, 0x89, 0x2a, 0xe4, 0xb0, 0x30, 0xd2, 0x96, 0x38, 0x75, 0xca, 0xe8, 0x9d, 0x51, 0x9d, 0x62, 0xa6, 0x46, 0x4, 0xb7, 0x47, 0x58, 0x95, 0x35, 0xd, 0x3d, 0xf1, 0xed, 0xfd, 0x1e, 0x9f, 0x1c, 0xb1, 0x4e, 0xa9, 0xf3, 0xf1, 0x5c, 0x52, 0x5d, 0xa, 0x69, 0x8a, 0xb3, 0xa9, 0x54, 0x47, 0xa, 0x2b, 0xc8, 0x48, 0x20, 0xf3, 0xca, 0x5a, 0xd5, 0x87, 0x62, 0x4d, 0xdb, 0x7e, 0x98, 0x9d, 0x62, 0xfe, 0xa5, 0x28, 0x4a, 0xb7, 0x4a, 0x4d, 0x81, 0x70, 0xf8, 0x2d, 0xea, 0x19, 0x9e, 0x2e, 0xc4, 0xda, 0xee, 0x5e, 0x5c, 0x7f, 0x45, 0x11, 0x4f, 0x1, 0xec, 0x13, 0xce, 0x5b, 0xb9, 0xdc, 0xfd, 0xa3, 0xd2, 0x5c, 0x7d, 0x68, 0x2c, 0xf6, 0x45, 0xa1, 0xcf, 0x8f, 0x2e, 0x6b, 0xb7, 0x81, 0xbb, 0x47, 0xbe, 0x6e, 0x60, 0x5d, 0x5c},
+		5600,
+		[]byte{0x4, 0x8f, 0x35, 0xcb, 0x97, 0x1e, 0xd9, 0xa7, 0xe1, 0xa7, 0x8b, 0xc8, 0xc8, 0xee, 0xd6, 0x10},
+		[]byte{0x32, 0x45, 0x2e, 0xbd, 0x4e, 0x73, 0x35, 0x87, 0x99, 0xe0, 0x2e, 0xd4, 0xba, 0xc1, 0x57, 0x92, 0xbf, 0x63, 0x7b, 0xc7, 0x47, 0xc5, 0xa6, 0xa7, 0x50, 0xe4, 0x99, 0x7c, 0xcb, 0x9c, 0x48, 0x6d, 0xa, 0x31, 0x22, 0xa7, 0xf3, 0x4, 0x39, 0x43, 0x15, 0x70, 0x35, 0x1, 0x62, 0xd4, 0x62, 0x14, 0x6b, 0x36, 0xf5, 0xcf, 0x2d, 0x4, 0x44, 0xa5, 0x2c, 0xec, 0xbd, 0x5b, 0x69, 0x79, 0x95, 0xe1, 0xa7, 0x1f, 0x8a, 0x72, 0x9a, 0x3f, 0xb1, 0x9e, 0x22, 0x13, 0x12, 0x3b, 0xfd, 0x29, 0x64, 0x1b, 0x14, 0x69, 0x3, 0x7a, 0xcc, 0xe2, 0xda, 0xe4, 0xe2, 0x6, 0x31, 0x7, 0xbb, 0xd8, 0xb1, 0xed, 0xd6, 0x86, 0x82, 0xe7, 0x9a, 0x57, 0xaa, 0x54, 0xe3, 0xfe, 0x25, 0x25, 0x45, 0x8b, 0x1, 0x10, 0xfe, 0xc3, 0xd4, 0x25, 0x54, 0x37, 0x7c, 0xe, 0xac, 0x8b, 0x9a, 0xb, 0x78, 0x82, 0xd0, 0x43},
 
 		[]TLLVBlock{
 			{
 				Tag:         tagSessionKeyR1Integrity,
-				BlockLength: 0x50,
+				BlockLength: 0xc0,
 				ValueLength: 0x10,
-				Value:       []byte{0x9b, 0x8a, 0x87, 0x3c, 0x18, 0xa2, 0x9, 0x80, 0x5f, 0xed, 0x9d, 0x95, 0x1, 0x74, 0x76, 0xfd},
+				Value:       []byte{0xd6, 0xea, 0x95, 0x76, 0xe3, 0x79, 0x89, 0xbf, 0xaa, 0x81, 0x4f, 0xdc, 0x3b, 0x4c, 0x8f, 0x78},
 			},
 			{
 				Tag:         tagSessionKeyR1,
-				BlockLength: 0xe0,
+				BlockLength: 0xc0,
 				ValueLength: 0x70,
-				Value:       []byte{0xaa, 0xaa, 0xbb, 0xbb, 0xcc, 0xcc, 0x82, 0x30, 0xe8, 0x9a, 0xce, 0xfa, 0xdd, 0xdd, 0xaa, 0xaa, 0x79, 0x2e, 0xf7, 0x42, 0xf, 0x47, 0x9b, 0x80, 0x56, 0x7e, 0x4f, 0x8b, 0xe8, 0x3e, 0xac, 0x8b, 0xfe, 0xb, 0x75, 0x51, 0x4a, 0x7c, 0xda, 0x90, 0xe8, 0xef, 0x55, 0xac, 0xf4, 0xf, 0x3c, 0x59, 0xf5, 0xde, 0xdb, 0x73, 0xfb, 0x28, 0x35, 0xc6, 0x4e, 0x10, 0x8d, 0x58, 0x8, 0x18, 0x75, 0x6a, 0x69, 0x1e, 0xfd, 0xfe, 0xd2, 0x87, 0x4e, 0x92, 0x12, 0x20, 0xf7, 0x3f, 0xa5, 0xfa, 0xdb, 0x28, 0x55, 0x56, 0x80, 0x75, 0xbd, 0xcc, 0x49, 0x38, 0xcd, 0x90, 0xd5, 0x4a, 0xfc, 0x24, 0xf9, 0x99, 0x39, 0xe0, 0x9f, 0x29, 0xce, 0x9c, 0xe8, 0x16, 0x1b, 0x8a, 0x83, 0x37, 0x7f, 0x7, 0x8e, 0xf7},
+				Value:       []byte{0xba, 0x98, 0xc0, 0x4e, 0xe2, 0xff, 0x3e, 0x9a, 0x30, 0xa9, 0x63, 0xd6, 0xc6, 0x94, 0x4e, 0x3d, 0xaa, 0x9b, 0xe, 0xff, 0xe5, 0x32, 0xa, 0x16, 0x3b, 0x15, 0xf0, 0x5a, 0x21, 0xab, 0xfc, 0x48, 0x2a, 0xcb, 0x97, 0xde, 0x21, 0x39, 0xdc, 0x37, 0xf4, 0xf5, 0x7e, 0x76, 0x9d, 0x55, 0x7c, 0x76, 0x13, 0xd9, 0x72, 0xce, 0xb6, 0xa9, 0xbc, 0x9, 0x21, 0x5b, 0x39, 0x17, 0xc2, 0x2f, 0xf8, 0x6d, 0xf9, 0xa5, 0x57, 0x16, 0xbe, 0x86, 0x11, 0xd0, 0xb1, 0xaf, 0xcc, 0x41, 0xee, 0x4, 0x99, 0x63, 0xa4, 0x33, 0x5a, 0x29, 0xeb, 0x2, 0xce, 0xb8, 0x26, 0x9c, 0x55, 0x45, 0xd0, 0x77, 0x8e, 0xe9, 0xbf, 0x1a, 0xa0, 0x40, 0x70, 0x26, 0xec, 0xce, 0xf4, 0x30, 0x33, 0x9, 0xc2, 0x81, 0x66, 0x89},
 			},
 			{
 				Tag:         tagAntiReplaySeed,
-				BlockLength: 0x30,
+				BlockLength: 0x20,
 				ValueLength: 0x10,
-				Value:       []byte{0x2d, 0x9e, 0x8f, 0x28, 0x97, 0xc0, 0xc7, 0xa7, 0x17, 0xe0, 0x95, 0x5d, 0x3c, 0xea, 0xfa, 0x2d},
+				Value:       []byte{0xb6, 0x23, 0xa2, 0x2d, 0xad, 0x19, 0x5a, 0x8e, 0x24, 0x50, 0x33, 0x40, 0xe3, 0x2a, 0xdc, 0xd1},
 			},
 			{
 				Tag:         tagR2,
 				BlockLength: 0x40,
 				ValueLength: 0x15,
-				Value:       []byte{0x11, 0xf7, 0xbe, 0x61, 0x2c, 0xa9, 0x5e, 0xf5, 0xe0, 0x7, 0xce, 0x51, 0x89, 0x6a, 0xe4, 0x50, 0x2c, 0xa3, 0xd8, 0x80, 0x1b},
+				Value:       []byte{0x11, 0x9, 0x0, 0x64, 0xdb, 0x1b, 0x6f, 0xd3, 0xe0, 0xf5, 0xf7, 0x36, 0x62, 0x21, 0xff, 0xb4, 0x7d, 0x8f, 0x7a, 0x52, 0xd1},
 			},
 			{
 				Tag:         tagAssetID,
-				BlockLength: 0x30,
-				ValueLength: 0x3,
-				Value:       []byte{0x6f, 0x6e, 0x65},
+				BlockLength: 0xe0,
+				ValueLength: 0x39,
+				Value:       []byte{0x73, 0x6b, 0x64, 0x3a, 0x2f, 0x2f, 0x66, 0x70, 0x73, 0x2e, 0x65, 0x7a, 0x64, 0x72, 0x6d, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x3b, 0x65, 0x35, 0x36, 0x38, 0x35, 0x65, 0x30, 0x38, 0x2d, 0x37, 0x32, 0x31, 0x34, 0x2d, 0x34, 0x61, 0x32, 0x62, 0x2d, 0x38, 0x37, 0x34, 0x31, 0x2d, 0x62, 0x30, 0x34, 0x37, 0x33, 0x65, 0x31, 0x65, 0x65, 0x35, 0x65, 0x34},
 			},
 			{
 				Tag:         tagTransactionID,
-				BlockLength: 0xc0,
+				BlockLength: 0xb0,
 				ValueLength: 0x8,
-				Value:       []byte{0xed, 0x82, 0xdf, 0x93, 0xe6, 0x26, 0xcd, 0x3c},
+				Value:       []byte{0x7d, 0xcb, 0xee, 0x4e, 0xdb, 0x61, 0xc2, 0x48},
 			},
 			{
 				Tag:         tagProtocolVersionUsed,
-				BlockLength: 0x10,
+				BlockLength: 0xb0,
 				ValueLength: 0x4,
 				Value:       []byte{0x0, 0x0, 0x0, 0x1},
 			},
 			{
 				Tag:         tagProtocolVersionsSupported,
-				BlockLength: 0x80,
-				ValueLength: 0x8,
-				Value:       []byte{0x0, 0x0, 0x0, 0x1, 0x0, 0x0, 0x0, 0x2},
+				BlockLength: 0xb0,
+				ValueLength: 0x4,
+				Value:       []byte{0x0, 0x0, 0x0, 0x1},
 			},
 			{
 				Tag:         tagReturnRequest,
-				BlockLength: 0x80,
-				ValueLength: 0x18,
-				Value:       []byte{0x1b, 0xf7, 0xf5, 0x3f, 0x5d, 0x5d, 0x5a, 0x1f, 0x47, 0xaa, 0x7a, 0xd3, 0x44, 0x5, 0x77, 0xde, 0xc3, 0x92, 0xec, 0x58, 0x91, 0xef, 0xa7, 0xd0},
+				BlockLength: 0x70,
+				ValueLength: 0x40,
+				Value:       []byte{0x1b, 0xf7, 0xf5, 0x3f, 0x5d, 0x5d, 0x5a, 0x1f, 0x47, 0xaa, 0x7a, 0xd3, 0x44, 0x5, 0x77, 0xde, 0xc3, 0x92, 0xec, 0x58, 0x91, 0xef, 0xa7, 0xd0, 0x42, 0xfa, 0x15, 0x9b, 0x95, 0xf9, 0xfa, 0xa3, 0x8d, 0xe9, 0x68, 0x43, 0x48, 0xbe, 0xe2, 0xdf, 0x8f, 0x1b, 0xa9, 0x53, 0xd5, 0x4, 0x34, 0x27, 0x6, 0x5a, 0x56, 0x14, 0x9a, 0xef, 0x1b, 0x21, 0xfd, 0x5c, 0xcf, 0x3d, 0x6d, 0xfb, 0x2c, 0x97},
 			},
 		},
 	},
 	{"../testdata/FPS-lease/spc3.bin",
 		"../testdata/FPS-lease/ckc3.bin",
-		2656,
-		[]byte{0x46, 0xe6, 0x59, 0xad, 0x25, 0x72, 0xcd, 0xd7, 0x85, 0x88, 0x2c, 0xf0, 0x51, 0x54, 0xad, 0x97},
-		[]byte{0xac, 0xe4, 0x84, 0x4c, 0xb, 0x69, 0xae, 0xa6, 0x22, 0x57, 0x9c, 0xda, 0x17, 0x1, 0x8b, 0x4d, 0xc2, 0x9f, 0xf5, 0x47, 0x8c, 0x5a, 0x9c, 0x5e, 0xd8, 0x35, 0x80, 0x7e, 0xc2, 0x7a, 0xa4, 0x49, 0x4e, 0x7d, 0xc0, 0x23, 0x1f, 0xf1, 0xc6, 0x0, 0xff, 0x86, 0xc0, 0x45, 0x29, 0x7a, 0x11, 0xfe, 0xe3, 0x1d, 0x30, 0x29, 0x24, 0xb8, 0x8b, 0x73, 0xd9, 0x7f, 0x10, 0xa, 0xab, 0xc5, 0xfd, 0x7f, 0x1e, 0xd5, 0xe8, 0xfc, 0x5, 0x2a, 0xfe, 0xf3, 0x9d, 0xc, 0x70, 0x95, 0x36, 0x17, 0xbe, 0xbf, 0x7e, 0xe6, 0x4c, 0x48, 0x37, 0xc, 0x7c, 0xa7, 0x17, 0x65, 0xf9, 0x6a, 0x51, 0x86, 0x9d, 0xf3, 0x1a, 0xab, 0xed, 0xd5, 0x6a, 0x3f, 0xbf, 0x8, 0x37, 0x48, 0x58, 0x45, 0xf5, 0x12, 0x63, 0x74, 0x32, 0x2d, 0xc2, 0x99, 0xf1, 0x8a, 0x18, 0xcd, 0x62, 0xae, 0xb1, 0xb2, 0x70, 0x94, 0xf2, 0x54},
+		8224,
+		[]byte{0xd, 0xec, 0xf8, 0xdf, 0x9f, 0xf0, 0x9, 0xb5, 0x4d, 0x31, 0xc6, 0x43, 0xd2, 0x39, 0x4e, 0xad},
+		[]byte{0x9e, 0x5, 0x26, 0xed, 0x73, 0xe4, 0x7c, 0xc6, 0xc1, 0x31, 0x4e, 0xe2, 0x82, 0xf0, 0x24, 0xfa, 0x18, 0xf1, 0xd7, 0x96, 0x60, 0xf, 0xd5, 0xae, 0x19, 0x82, 0xa1, 0xcb, 0x49, 0x88, 0x9, 0xb0, 0x95, 0x91, 0xe3, 0x23, 0xc6, 0xa2, 0x7b, 0x13, 0x9b, 0x4a, 0xeb, 0x12, 0xb2, 0x83, 0x6a, 0x4e, 0xee, 0xb2, 0x7a, 0x67, 0xc2, 0x78, 0xba, 0x62, 0x34, 0x55, 0xa4, 0x44, 0x7c, 0xda, 0x93, 0xdf, 0x7c, 0x90, 0xfa, 0x9b, 0xd6, 0xa2, 0xaa, 0xa9, 0x89, 0x2c, 0xff, 0x2b, 0x5b, 0x15, 0xb7, 0x94, 0x92, 0x2c, 0x5a, 0xba, 0x2f, 0x20, 0x28, 0xe9, 0x14, 0x5a, 0xfe, 0x2f, 0x85, 0x48, 0x16, 0x47, 0x3f, 0x89, 0x1a, 0xce, 0xfe, 0x54, 0x25, 0xed, 0x42, 0x83, 0xb, 0xb5, 0x6e, 0x15, 0x8a, 0x88, 0xcf, 0x64, 0xda, 0x4e, 0x29, 0xe5, 0x26, 0xc0, 0x4b, 0xc6, 0xc4, 0xf2, 0x20, 0x2d, 0x4a, 0xf1},
 
 		[]TLLVBlock{
 			{
 				Tag:         tagSessionKeyR1Integrity,
-				BlockLength: 0xc0,
+				BlockLength: 0xb0,
 				ValueLength: 0x10,
-				Value:       []byte{0x7d, 0x29, 0x4e, 0x46, 0x8a, 0x7a, 0x1f, 0xb2, 0xe7, 0x23, 0x60, 0xb0, 0x73, 0x9a, 0xb3, 0xe2},
+				Value:       []byte{0x5d, 0xfb, 0x98, 0x4e, 0xa8, 0xe, 0xbe, 0x43, 0x27, 0x19, 0xea, 0x49, 0x7c, 0x5e, 0x54, 0x77},
 			},
 			{
 				Tag:         tagSessionKeyR1,
-				BlockLength: 0xf0,
+				BlockLength: 0xd0,
 				ValueLength: 0x70,
-				Value:       []byte{0xaa, 0xaa, 0xbb, 0xbb, 0xcc, 0xcc, 0x82, 0x30, 0xe8, 0x9a, 0xce, 0xfa, 0xdd, 0xdd, 0xaa, 0xaa, 0x79, 0x2e, 0xf7, 0x42, 0xf, 0x47, 0x9b, 0x80, 0x56, 0x7e, 0x4f, 0x8b, 0xe8, 0x3e, 0xac, 0x8b, 0xfe, 0xb, 0x75, 0x51, 0x4a, 0x7c, 0xda, 0x90, 0xe8, 0xef, 0x55, 0xac, 0xf4, 0xf, 0x3c, 0x59, 0x37, 0x8e, 0xc5, 0xf1, 0x7c, 0xd5, 0x10, 0xa0, 0xd9, 0xf6, 0xfd, 0xd9, 0x7e, 0x92, 0x7f, 0x99, 0x96, 0xb4, 0x96, 0x53, 0xfb, 0x49, 0x36, 0xc2, 0x25, 0xf4, 0xa7, 0x24, 0x5c, 0x5d, 0x46, 0xf8, 0x2e, 0xc9, 0x1d, 0x5, 0x53, 0xed, 0xa0, 0x1e, 0xd2, 0x14, 0x2, 0x9c, 0xd1, 0x2, 0xa5, 0xbd, 0x4e, 0x4d, 0xa0, 0xe3, 0xaf, 0x4, 0xc4, 0x39, 0xd0, 0x31, 0x43, 0x9d, 0xd9, 0x1e, 0x7b, 0xb9},
+				Value:       []byte{0x7, 0x32, 0x3e, 0xc7, 0x5f, 0xe1, 0x76, 0x28, 0x0, 0x2e, 0x82, 0xcb, 0x0, 0x24, 0x1f, 0x14, 0x79, 0x8, 0x43, 0x40, 0x2e, 0xed, 0xbc, 0xeb, 0x0, 0x9c, 0x3b, 0x37, 0x2f, 0xe1, 0x32, 0x8a, 0x0, 0x9c, 0x4c, 0xfe, 0xc9, 0xf2, 0xab, 0x9, 0xfe, 0x1e, 0x5f, 0x3d, 0xd3, 0x6b, 0xd5, 0x5b, 0xd2, 0x80, 0xf1, 0x19, 0xfd, 0xcc, 0x4e, 0x71, 0x69, 0xaf, 0x1, 0x7, 0x9f, 0x48, 0xe0, 0xa2, 0x7c, 0xc2, 0x1, 0x12, 0xd3, 0x75, 0x5c, 0x77, 0xf7, 0x70, 0x18, 0x90, 0xef, 0x4e, 0x52, 0x5a, 0x9d, 0x46, 0x5, 0x16, 0x7c, 0x61, 0xcd, 0x21, 0x44, 0x77, 0x35, 0x97, 0x3b, 0x26, 0x4b, 0x3, 0x84, 0x8b, 0x77, 0xc6, 0xfe, 0xf, 0x2, 0x6d, 0x4c, 0xd7, 0xc1, 0xa7, 0x61, 0xa6, 0x5f, 0xf4},
 			},
 			{
 				Tag:         tagAntiReplaySeed,
-				BlockLength: 0x70,
+				BlockLength: 0xb0,
 				ValueLength: 0x10,
-				Value:       []byte{0x2d, 0x9e, 0x8f, 0x28, 0x97, 0xc0, 0xc7, 0xa7, 0x17, 0xe0, 0x95, 0x5d, 0x3c, 0xea, 0xfa, 0x2d},
+				Value:       []byte{0xa0, 0x5b, 0x75, 0x55, 0x4e, 0xb, 0xb1, 0x74, 0x56, 0x62, 0x53, 0xb6, 0x64, 0x45, 0x89, 0xc4},
 			},
 			{
 				Tag:         tagR2,
-				BlockLength: 0xc0,
+				BlockLength: 0xb0,
 				ValueLength: 0x15,
-				Value:       []byte{0x11, 0xf7, 0xbe, 0x61, 0x2c, 0xa9, 0x5e, 0xf5, 0xe0, 0x7, 0xce, 0x51, 0x89, 0x6a, 0xe4, 0x50, 0x2c, 0xa3, 0xd8, 0x80, 0x1b},
+				Value:       []byte{0xfe, 0x9c, 0xcb, 0x92, 0xa7, 0x62, 0xb9, 0x52, 0xaf, 0xb, 0xaa, 0x42, 0xf2, 0x34, 0x81, 0xc8, 0x62, 0xa4, 0x18, 0xce, 0xa8},
 			},
 			{
 				Tag:         tagAssetID,
-				BlockLength: 0x20,
-				ValueLength: 0x3,
-				Value:       []byte{0x6f, 0x6e, 0x65},
+				BlockLength: 0xd0,
+				ValueLength: 0x39,
+				Value:       []byte{0x73, 0x6b, 0x64, 0x3a, 0x2f, 0x2f, 0x66, 0x70, 0x73, 0x2e, 0x65, 0x7a, 0x64, 0x72, 0x6d, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x3b, 0x65, 0x35, 0x36, 0x38, 0x35, 0x65, 0x30, 0x38, 0x2d, 0x37, 0x32, 0x31, 0x34, 0x2d, 0x34, 0x61, 0x32, 0x62, 0x2d, 0x38, 0x37, 0x34, 0x31, 0x2d, 0x62, 0x30, 0x34, 0x37, 0x33, 0x65, 0x31, 0x65, 0x65, 0x35, 0x65, 0x34},
 			},
 			{
 				Tag:         tagTransactionID,
-				BlockLength: 0x70,
+				BlockLength: 0xa0,
 				ValueLength: 0x8,
-				Value:       []byte{0x41, 0x49, 0xc0, 0x29, 0x70, 0xb5, 0x11, 0xae},
+				Value:       []byte{0x21, 0x8d, 0x2e, 0xfe, 0xc, 0x7b, 0x8a, 0x44},
 			},
 			{
 				Tag:         tagProtocolVersionUsed,
@@ -419,15 +427,15 @@ var spcContainerTests = []spcTest{
 			},
 			{
 				Tag:         tagProtocolVersionsSupported,
-				BlockLength: 0x80,
-				ValueLength: 0x8,
-				Value:       []byte{0x0, 0x0, 0x0, 0x1, 0x0, 0x0, 0x0, 0x2},
+				BlockLength: 0xa0,
+				ValueLength: 0x4,
+				Value:       []byte{0x0, 0x0, 0x0, 0x1},
 			},
 			{
 				Tag:         tagReturnRequest,
-				BlockLength: 0xb0,
-				ValueLength: 0x18,
-				Value:       []byte{0x1b, 0xf7, 0xf5, 0x3f, 0x5d, 0x5d, 0x5a, 0x1f, 0x47, 0xaa, 0x7a, 0xd3, 0x44, 0x5, 0x77, 0xde, 0xc3, 0x92, 0xec, 0x58, 0x91, 0xef, 0xa7, 0xd0},
+				BlockLength: 0x80,
+				ValueLength: 0x40,
+				Value:       []byte{0x1b, 0xf7, 0xf5, 0x3f, 0x5d, 0x5d, 0x5a, 0x1f, 0x47, 0xaa, 0x7a, 0xd3, 0x44, 0x5, 0x77, 0xde, 0xc3, 0x92, 0xec, 0x58, 0x91, 0xef, 0xa7, 0xd0, 0x42, 0xfa, 0x15, 0x9b, 0x95, 0xf9, 0xfa, 0xa3, 0x9, 0x82, 0xf9, 0x69, 0x17, 0xd8, 0x58, 0x3d, 0x37, 0x9e, 0xb6, 0x46, 0xae, 0x9e, 0x96, 0xbf, 0x15, 0x1d, 0x84, 0xeb, 0x10, 0x2e, 0xb9, 0xe3, 0xa1, 0xbf, 0x17, 0x87, 0x3e, 0xf1, 0xf2, 0xdf},
 			},
 		},
 	},
@@ -436,54 +444,278 @@ var spcContainerTests = []spcTest{
 func TestGenCKC(t *testing.T) {
 	assert := assert.New(t)
 
-	pubKey, _ := cryptos.ParsePublicCertification([]byte(pub))
-	priKey, _ := cryptos.DecryptPriKey([]byte(pri), []byte("axissoft1@"))
-	ask, _ := hex.DecodeString("2c6b3114ca8831cb01fb26a0646f96e8")
-
-	k := &Ksm{
-		Pub: pubKey,
-		Pri: priKey,
-		Rck: RandomContentKey{},
-		Ask: ask,
-	}
+	k := testKsm(t)
 	for _, test := range spcContainerTests {
 		spcMessage := readBin(test.filePath)
 
-		ckc, err := k.GenCKC(spcMessage)
+		out, err := k.GenCKC(spcMessage)
 		assert.NoError(err)
-		assert.NoError(os.WriteFile(test.outFilePath, ckc, 0777))
+
+		ckc, err := DecodeCKC(out, testCKCSecrets(t, spcMessage))
+		if !assert.NoError(err, test.filePath) {
+			continue
+		}
+
+		container, _ := ParseSPC(spcMessage, k.Pub, k.Pri)
+		spc, _ := DecodeSPC(container)
+
+		key := md5.Sum(spc.AssetID)
+		assert.Equal(key[:], ckc.ContentKey)
+
+		// Every requested TLLV is returned with its SPC value.
+		assert.Len(ckc.ReturnRequest, len(spc.ReturnRequestTags))
+		for _, block := range ckc.ReturnRequest {
+			assert.Contains(spc.ReturnRequestTags, block.Tag)
+			assert.Equal(container.TTLVS[block.Tag].Value, block.Value)
+		}
+
+		// The duration TLLV answers SPCs with a media playback state only.
+		assert.Equal(spc.PlaybackState != nil, ckc.Duration != nil, test.filePath)
 	}
 }
 
 func TestDebugCKC(t *testing.T) {
 	ckcMessage := readBin("../testdata/FPS/ckc1.bin")
 	DebugCKC(ckcMessage)
+	DebugCKC(ckcMessage[:10])
 }
 
 func TestParseSPCV1(t *testing.T) {
-	pubKey, _ := cryptos.ParsePublicCertification([]byte(pub))
-	priKey, _ := cryptos.DecryptPriKey([]byte(pri), []byte("axissoft1@"))
+	k := testKsm(t)
 	assert := assert.New(t)
 
 	for _, test := range spcContainerTests {
 		spcMessage := readBin(test.filePath)
 
-		spcContainer, err := ParseSPCV1(spcMessage, pubKey, priKey)
+		spcContainer, err := ParseSPCV1(spcMessage, k.Pub, k.Pri)
 		assert.NoError(err)
 
-		break
-		assert.Equal(test.playloadSize, len(spcContainer.SPCPlayload))
-		assert.Equal(test.encryptedKey, spcContainer.EncryptedAesKey)
-		assert.Equal(test.iv, spcContainer.AesKeyIV)
+		assert.Equal(test.playloadSize, len(spcContainer.SPCPlayload), test.filePath)
+		assert.Equal(test.encryptedKey, spcContainer.EncryptedAesKey, test.filePath)
+		assert.Equal(test.iv, spcContainer.AesKeyIV, test.filePath)
 
 		for _, tllv := range test.ttls {
-			actualTtlv := spcContainer.TTLVS[tllv.Tag]
-			assert.NotNil(actualTtlv)
-			assert.Equal(tllv, actualTtlv)
+			actualTtlv, ok := spcContainer.TTLVS[tllv.Tag]
+			assert.Truef(ok, "%s: tag %x not found", test.filePath, tllv.Tag)
+			assert.Equal(tllv, actualTtlv, test.filePath)
 		}
 	}
 }
 
+func TestParseSPC_Keys(t *testing.T) {
+	assert := assert.New(t)
+
+	k := testKsm(t)
+	spcMessage := readBin("../testdata/FPS/spc1.bin")
+
+	_, err := ParseSPC(spcMessage, nil, k.Pri)
+	assert.NoError(err, "the public key is optional")
+	_, err = ParseSPC(spcMessage, k.Pub, nil)
+	assert.ErrorContains(err, "private key required")
+	_, err = ParseSPCWithDecrypter(spcMessage, nil)
+	assert.ErrorContains(err, "private key required")
+
+	other, err := rsa.GenerateKey(cryptorand.Reader, 1024)
+	assert.NoError(err)
+	_, err = ParseSPC(spcMessage, &other.PublicKey, k.Pri)
+	assert.ErrorContains(err, "doesn't match")
+
+	// A wrong private key is reported with the decryption error.
+	_, err = ParseSPC(spcMessage, nil, other)
+	assert.ErrorContains(err, "decryptSPCK error")
+	assert.NotNil(errors.Unwrap(err))
+}
+
+func TestParseSPCContainer_Malformed(t *testing.T) {
+	assert := assert.New(t)
+	spcMessage := readBin("../testdata/FPS/spc1.bin")
+
+	withPayloadLength := func(n uint32) []byte {
+		out := append([]byte{}, spcMessage...)
+		binary.BigEndian.PutUint32(out[172:176], n)
+		return out
+	}
+
+	tests := []struct {
+		name     string
+		playback []byte
+		err      error
+	}{
+		{"empty", nil, ErrSPCTruncated},
+		{"header only", spcMessage[:100], ErrSPCTruncated},
+		{"payload truncated", spcMessage[:len(spcMessage)-16], ErrSPCPayloadLength},
+		{"payload length too large", withPayloadLength(0xffffffff), ErrSPCPayloadLength},
+		{"payload length zero", withPayloadLength(0), ErrSPCPayloadLength},
+		{"payload length not block aligned", withPayloadLength(17), ErrSPCPayloadLength},
+		{"unknown version", append([]byte{0x00, 0x00, 0x00, 0x07}, spcMessage[4:]...), ErrSPCVersion},
+		{"version 2 truncated", append([]byte{0x00, 0x00, 0x00, 0x02}, spcMessage[4:200]...), ErrSPCTruncated},
+	}
+
+	for _, test := range tests {
+		_, err := parseSPCContainer(test.playback)
+		assert.Truef(errors.Is(err, test.err), "%s: got %v, want %v", test.name, err, test.err)
+	}
+
+	spcContainer, err := parseSPCContainer(spcMessage)
+	assert.NoError(err)
+	assert.Equal(len(spcMessage)-176, len(spcContainer.SPCPlayload))
+}
+
+func TestParseSPC_Version2(t *testing.T) {
+	assert := assert.New(t)
+
+	priKey, err := rsa.GenerateKey(cryptorand.Reader, 2048)
+	assert.NoError(err)
+
+	assetID := []byte("asset-2048")
+	payload, err := NewTLLVBlock(tagAssetID, assetID).Serialize()
+	assert.NoError(err)
+
+	spck := make([]byte, 16)
+	iv := make([]byte, 16)
+	cryptorand.Read(spck)
+	cryptorand.Read(iv)
+
+	encryptedPayload, err := cryptos.AESCBCEncrypt(spck, iv, payload)
+	assert.NoError(err)
+	wrappedKey, err := rsa.EncryptOAEP(sha1.New(), cryptorand.Reader, &priKey.PublicKey, spck, nil)
+	assert.NoError(err)
+	assert.Len(wrappedKey, 256)
+
+	certHash := make([]byte, 20)
+	payloadLen := make([]byte, 4)
+	binary.BigEndian.PutUint32(payloadLen, uint32(len(encryptedPayload)))
+
+	var playback []byte
+	playback = append(playback, 0x00, 0x00, 0x00, 0x02)
+	playback = append(playback, 0x00, 0x00, 0x00, 0x00)
+	playback = append(playback, iv...)
+	playback = append(playback, wrappedKey...)
+	playback = append(playback, certHash...)
+	playback = append(playback, payloadLen...)
+	playback = append(playback, encryptedPayload...)
+
+	spcContainer, err := ParseSPC(playback, &priKey.PublicKey, priKey)
+	assert.NoError(err)
+	assert.Equal(uint32(SPCVersion2), spcContainer.Version)
+	assert.Equal(wrappedKey, spcContainer.EncryptedAesKey)
+	assert.Equal(certHash, spcContainer.CertificateHash)
+	assert.Equal(assetID, spcContainer.TTLVS[tagAssetID].Value)
+
+	// A version 1 header can't carry a 2048-bit wrapped key.
+	playback[3] = 0x01
+	_, err = ParseSPC(playback, &priKey.PublicKey, priKey)
+	assert.Error(err)
+}
+
+func TestParseTLLVs_Malformed(t *testing.T) {
+	assert := assert.New(t)
+
+	block, err := NewTLLVBlock(tagAssetID, []byte("asset-id")).Serialize()
+	assert.NoError(err)
+
+	withLengths := func(blockLen, valueLen uint32) []byte {
+		out := append([]byte{}, block...)
+		binary.BigEndian.PutUint32(out[8:12], blockLen)
+		binary.BigEndian.PutUint32(out[12:16], valueLen)
+		return out
+	}
+
+	tests := []struct {
+		name    string
+		payload []byte
+		err     error
+	}{
+		{"truncated header", block[:10], ErrTLLVOverrun},
+		{"truncated value", block[:len(block)-1], ErrTLLVOverrun},
+		{"trailing bytes", append(append([]byte{}, block...), 0x01, 0x02), ErrTLLVOverrun},
+		{"block length overrun", withLengths(0xfffffff0, 8), ErrTLLVOverrun},
+		{"value length overrun", withLengths(0xfffffff0, 0xfffffff0), ErrTLLVOverrun},
+		{"block smaller than value", withLengths(8, 16), ErrTLLVBlockLength},
+	}
+
+	for _, test := range tests {
+		_, err := parseTLLVs(test.payload)
+		assert.Truef(errors.Is(err, test.err), "%s: got %v, want %v", test.name, err, test.err)
+	}
+
+	ttlvs, err := parseTLLVs(block)
+	assert.NoError(err)
+	assert.Equal([]byte("asset-id"), ttlvs[tagAssetID].Value)
+}
+
+func TestParseSKR1_Malformed(t *testing.T) {
+	_, err := parseSKR1(TLLVBlock{})
+	assert.True(t, errors.Is(err, ErrTLLVMissing))
+
+	_, err = parseSKR1(TLLVBlock{Tag: tagSessionKeyR1, Value: make([]byte, 64)})
+	assert.True(t, errors.Is(err, ErrTLLVMissing))
+}
+
+func TestGenCkcPayload_RandomOrder(t *testing.T) {
+	assert := assert.New(t)
+
+	ckIv := make([]byte, 16)
+	enCk := make([]byte, 16)
+	r1 := CkcR1{R1: make([]byte, 44)}
+	returnTllvs := []TLLVBlock{
+		*NewTLLVBlock(tagAssetID, []byte("asset-id")),
+		*NewTLLVBlock(tagTransactionID, []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}),
+	}
+	durationTllv, err := NewCkcContentKeyDurationBlock(3600, 0).Serialize()
+	assert.NoError(err)
+
+	orders := make(map[string]bool)
+	for i := 0; i < 50; i++ {
+		ckcPayload, err := genCkcPayload(ckIv, enCk, r1, returnTllvs, durationTllv)
+		assert.NoError(err)
+
+		// Every ordering must parse back to the same set of blocks.
+		ttlvs, err := parseTLLVs(ckcPayload)
+		assert.NoError(err)
+		assert.Len(ttlvs, 5)
+		assert.Len(ttlvs[tagEncryptedCk].Value, 32)
+		assert.Equal(r1.R1, ttlvs[tagR1].Value)
+		assert.Equal([]byte("asset-id"), ttlvs[tagAssetID].Value)
+		assert.Len(ttlvs[tagContentKeyDuration].Value, 16)
+
+		orders[fmt.Sprint(tllvOrder(ckcPayload))] = true
+	}
+
+	assert.Greater(len(orders), 1, "TLLV blocks are always written in the same order")
+}
+
+// tllvOrder returns the tags of the serialized TLLV blocks in payload order.
+func tllvOrder(payload []byte) []uint64 {
+	var tags []uint64
+	for offset := 0; offset+16 <= len(payload); {
+		tags = append(tags, binary.BigEndian.Uint64(payload[offset:offset+8]))
+		offset += 16 + int(binary.BigEndian.Uint32(payload[offset+8:offset+12]))
+	}
+	return tags
+}
+
+// RandomContentKey is a ContentKey that derives the content key from the asset ID.
+type RandomContentKey struct {
+}
+
+func (RandomContentKey) FetchContentKey(assetID []byte) ([]byte, []byte, []byte, error) {
+	kid := make([]byte, 16)
+	iv := make([]byte, 16)
+	rand.Read(kid)
+	rand.Read(iv)
+
+	key := md5.Sum(assetID)
+	return kid, key[:], iv, nil
+}
+
+func (RandomContentKey) FetchContentKeyDuration(assetID []byte) (*CkcContentKeyDurationBlock, error) {
+	LeaseDuration := rand.Uint32()  // The duration of the lease, if any, in seconds.
+	RentalDuration := rand.Uint32() // The duration of the rental, if any, in seconds.
+
+	return NewCkcContentKeyDurationBlock(LeaseDuration, RentalDuration), nil
+}
+
 func readBin(filePath string) []byte {
 	f, err := os.Open(filePath)
 	checkErr(err)
@@ -496,6 +728,23 @@ func readBin(filePath string) []byte {
 
 }
 
+// testKsm returns the Ksm of the test credential (CSR, private key and ASk), with random content keys.
+func testKsm(t testing.TB) *Ksm {
+	t.Helper()
+
+	pubKey, err := cryptos.ParsePublicCertification([]byte(pub))
+	if err != nil {
+		t.Fatal(err)
+	}
+	priKey, err := cryptos.DecryptPriKey([]byte(pri), []byte("axissoft1@"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ask, _ := hex.DecodeString("2c6b3114ca8831cb01fb26a0646f96e8")
+
+	return &Ksm{Pub: pubKey, Pri: priKey, Rck: RandomContentKey{}, Ask: ask}
+}
+
 func checkErr(err error) {
 	if err != nil {
 		panic(err)
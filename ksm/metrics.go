@@ -0,0 +1,7 @@
+package ksm
+
+// Metrics receives measurements of CKC generation. Implementations must be safe for concurrent use.
+type Metrics interface {
+	// ObserveProtocolVersion is called for every SPC with the protocol version it used and whether it was accepted.
+	ObserveProtocolVersion(version uint32, accepted bool)
+}
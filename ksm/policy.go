@@ -0,0 +1,171 @@
+package ksm
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+)
+
+// HDCPType represents the HDCP requirement sent in the HDCP enforcement TLLV.
+type HDCPType uint64
+
+const (
+	HDCPNotRequired HDCPType = 0xef72894ca7895b78 // Content may be output without HDCP.
+	HDCPType0       HDCPType = 0x40791ac78bd5c571 // HDCP Type 0 is required on external outputs.
+	HDCPType1       HDCPType = 0x285a0863bba8e1d3 // HDCP Type 1 (HDCP 2.2 or later) is required on external outputs.
+)
+
+// ParseHDCPType parses a stored HDCP policy name ("none", "type0" or "type1").
+// An empty name returns 0, which means no HDCP enforcement TLLV is sent.
+func ParseHDCPType(name string) (HDCPType, error) {
+	switch strings.ToLower(name) {
+	case "":
+		return 0, nil
+	case "none":
+		return HDCPNotRequired, nil
+	case "type0":
+		return HDCPType0, nil
+	case "type1":
+		return HDCPType1, nil
+	default:
+		return 0, fmt.Errorf("unknown hdcp policy %q, must be none, type0 or type1", name)
+	}
+}
+
+// AssetPolicy represents the license policy of an asset.
+type AssetPolicy struct {
+	HDCP    HDCPType                  // The HDCP requirement. Zero sends no HDCP enforcement TLLV.
+	Offline *OfflinePolicy            // The persistent key policy for downloads. Nil denies offline key requests.
+	Outputs map[OutputPath]OutputRule // The rules of each output path. An output path without rule is allowed.
+
+	MinSecurityLevel     SecurityLevel // Clients reporting a lower security level are denied.
+	RequiredCapabilities Capabilities  // Clients missing any of these capabilities are denied.
+}
+
+// OutputRule represents the policy of an asset on one output path.
+type OutputRule struct {
+	Deny bool     // No license is issued on the output path.
+	HDCP HDCPType // Overrides the HDCP requirement of the asset on the output path when non-zero.
+}
+
+// ParseOutputRule parses a stored output rule name: "allow", "deny", or an HDCP policy name
+// ("none", "type0" or "type1") overriding the HDCP requirement. An empty name returns an allowing rule.
+func ParseOutputRule(name string) (OutputRule, error) {
+	switch strings.ToLower(name) {
+	case "", "allow":
+		return OutputRule{}, nil
+	case "deny":
+		return OutputRule{Deny: true}, nil
+	}
+
+	hdcp, err := ParseHDCPType(name)
+	if err != nil {
+		return OutputRule{}, fmt.Errorf("unknown output rule %q, must be allow, deny, none, type0 or type1", name)
+	}
+	return OutputRule{HDCP: hdcp}, nil
+}
+
+// OfflinePolicy represents the policy of persistable keys delivered for offline (downloaded) playback.
+//
+// The offline key TLLV identifies a key by a 16-byte content ID, derived from the asset ID,
+// and optionally groups the keys of one title (every rendition, audio and subtitle key) by a 16-byte title ID,
+// derived from TitleID. Both IDs are the first 16 bytes of the SHA-256 digest of their source.
+type OfflinePolicy struct {
+	StorageDuration  uint32 // The duration, in seconds, the key may be stored before playback starts. Zero is unlimited.
+	PlaybackDuration uint32 // The duration, in seconds, the key is valid once playback starts. Zero is unlimited.
+	TitleID          string // The title the asset belongs to. Empty sends an offline key TLLV without title ID.
+}
+
+// AssetPolicyProvider is an optional interface a ContentKey can implement to return the policy of an asset.
+type AssetPolicyProvider interface {
+	FetchAssetPolicy(assetID []byte) (*AssetPolicy, error)
+}
+
+// fetchAssetPolicy returns the policy of the asset, or an empty policy if key doesn't provide one.
+func fetchAssetPolicy(assetID []byte, key ContentKey) (*AssetPolicy, error) {
+	provider, ok := key.(AssetPolicyProvider)
+	if !ok {
+		return &AssetPolicy{}, nil
+	}
+
+	policy, err := provider.FetchAssetPolicy(assetID)
+	if err != nil {
+		return nil, err
+	}
+	if policy == nil {
+		return &AssetPolicy{}, nil
+	}
+	return policy, nil
+}
+
+// check returns a *PolicyError if the policy doesn't allow the request with the content key duration of the asset.
+// A persistable key type is only allowed for offline requests of assets allowing offline playback.
+func (p *AssetPolicy) check(spc *SPC, opts CKCOptions, duration *CkcContentKeyDurationBlock) error {
+	if opts.Offline && p.Offline == nil {
+		return &PolicyError{Reason: "offline playback is not allowed for this asset"}
+	}
+	if duration != nil && duration.KeyType.Persistable() && (!opts.Offline || p.Offline == nil) {
+		return &PolicyError{Reason: "a persistable key type is only allowed for offline playback of this asset"}
+	}
+	if level := spc.Level(); level < p.MinSecurityLevel {
+		return &PolicyError{Reason: fmt.Sprintf("security level %s is below the %s security level required for this asset", level, p.MinSecurityLevel)}
+	}
+	if missing := p.RequiredCapabilities &^ spc.Capabilities; missing != 0 {
+		return &PolicyError{Reason: fmt.Sprintf("client capabilities %s required for this asset are missing", missing)}
+	}
+	return nil
+}
+
+// forOutput returns the policy applied on output, or a *PolicyError if output is denied.
+func (p *AssetPolicy) forOutput(output OutputPath) (*AssetPolicy, error) {
+	rule, ok := p.Outputs[output]
+	if !ok {
+		return p, nil
+	}
+	if rule.Deny {
+		return nil, &PolicyError{Reason: fmt.Sprintf("%s output is not allowed for this asset", output)}
+	}
+
+	policy := *p
+	if rule.HDCP != 0 {
+		policy.HDCP = rule.HDCP
+	}
+	return &policy, nil
+}
+
+// genAssetPolicyTllvs returns the serialized policy TLLVs of the asset.
+func genAssetPolicyTllvs(assetID []byte, policy *AssetPolicy, opts CKCOptions) ([][]byte, error) {
+	var tllvs [][]byte
+	if policy.HDCP != 0 {
+		hdcpTllv, err := NewHdcpEnforcementBlock(policy.HDCP).Serialize()
+		if err != nil {
+			return nil, err
+		}
+		tllvs = append(tllvs, hdcpTllv)
+	}
+
+	if opts.Offline && policy.Offline != nil {
+		var titleID []byte
+		if policy.Offline.TitleID != "" {
+			titleID = offlineKeyID([]byte(policy.Offline.TitleID))
+		}
+
+		offlineBlock, err := NewOfflineKeyBlock(offlineKeyID(assetID), titleID, policy.Offline.StorageDuration, policy.Offline.PlaybackDuration)
+		if err != nil {
+			return nil, err
+		}
+		offlineTllv, err := offlineBlock.Serialize()
+		if err != nil {
+			return nil, err
+		}
+		tllvs = append(tllvs, offlineTllv)
+	}
+
+	return tllvs, nil
+}
+
+// offlineKeyID derives a 16-byte offline key content ID or title ID.
+func offlineKeyID(id []byte) []byte {
+	sum := sha256.Sum256(id)
+	return sum[:16]
+}
@@ -0,0 +1,257 @@
+package ksm
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// PolicyContentKey is a RandomContentKey that also returns a fixed asset policy.
+type PolicyContentKey struct {
+	RandomContentKey
+	Policy AssetPolicy
+}
+
+func (p PolicyContentKey) FetchAssetPolicy(assetID []byte) (*AssetPolicy, error) {
+	policy := p.Policy
+	return &policy, nil
+}
+
+func TestParseHDCPType(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		name string
+		out  HDCPType
+	}{
+		{"", 0},
+		{"none", HDCPNotRequired},
+		{"type0", HDCPType0},
+		{"Type1", HDCPType1},
+	}
+	for _, test := range tests {
+		out, err := ParseHDCPType(test.name)
+		assert.NoError(err)
+		assert.Equal(test.out, out)
+	}
+
+	_, err := ParseHDCPType("type2")
+	assert.Error(err)
+}
+
+func TestFetchAssetPolicy(t *testing.T) {
+	policy, err := fetchAssetPolicy([]byte("asset"), RandomContentKey{})
+	assert.NoError(t, err)
+	assert.Equal(t, &AssetPolicy{}, policy, "a ContentKey without policy must get an empty policy")
+
+	policy, err = fetchAssetPolicy([]byte("asset"), PolicyContentKey{Policy: AssetPolicy{HDCP: HDCPType1}})
+	assert.NoError(t, err)
+	assert.Equal(t, HDCPType1, policy.HDCP)
+}
+
+func TestGenAssetPolicyTllvs_HDCP(t *testing.T) {
+	assert := assert.New(t)
+
+	tllvs, err := genAssetPolicyTllvs([]byte("asset"), &AssetPolicy{}, CKCOptions{})
+	assert.NoError(err)
+	assert.Empty(tllvs)
+
+	for _, hdcp := range []HDCPType{HDCPNotRequired, HDCPType0, HDCPType1} {
+		tllvs, err = genAssetPolicyTllvs([]byte("asset"), &AssetPolicy{HDCP: hdcp}, CKCOptions{})
+		assert.NoError(err)
+		assert.Len(tllvs, 1)
+
+		ttlvs, err := parseTLLVs(tllvs[0])
+		assert.NoError(err)
+		assert.Equal(uint64(hdcp), binary.BigEndian.Uint64(ttlvs[tagHdcpEnforcement].Value))
+	}
+}
+
+func TestGenAssetPolicyTllvs_Offline(t *testing.T) {
+	assert := assert.New(t)
+	assetID := []byte("asset")
+
+	policy := &AssetPolicy{Offline: &OfflinePolicy{StorageDuration: 30 * 86400, PlaybackDuration: 48 * 3600}}
+
+	// Streaming requests don't get an offline key TLLV, even if downloads are allowed.
+	tllvs, err := genAssetPolicyTllvs(assetID, policy, CKCOptions{})
+	assert.NoError(err)
+	assert.Empty(tllvs)
+
+	tllvs, err = genAssetPolicyTllvs(assetID, policy, CKCOptions{Offline: true})
+	assert.NoError(err)
+	assert.Len(tllvs, 1)
+
+	ttlvs, err := parseTLLVs(tllvs[0])
+	assert.NoError(err)
+	value := ttlvs[tagOfflineKey].Value
+	assert.Len(value, 32)
+	assert.Equal(uint32(offlineKeyVersion1), binary.BigEndian.Uint32(value[0:4]))
+	assert.Equal(offlineKeyID(assetID), value[8:24])
+	assert.Equal(uint32(30*86400), binary.BigEndian.Uint32(value[24:28]))
+	assert.Equal(uint32(48*3600), binary.BigEndian.Uint32(value[28:32]))
+
+	policy.Offline.TitleID = "title"
+	tllvs, err = genAssetPolicyTllvs(assetID, policy, CKCOptions{Offline: true})
+	assert.NoError(err)
+
+	ttlvs, err = parseTLLVs(tllvs[0])
+	assert.NoError(err)
+	value = ttlvs[tagOfflineKey].Value
+	assert.Len(value, 48)
+	assert.Equal(uint32(offlineKeyVersion2), binary.BigEndian.Uint32(value[0:4]))
+	assert.Equal(offlineKeyID([]byte("title")), value[32:48])
+}
+
+func TestGenCKCWithOptions_Offline(t *testing.T) {
+	assert := assert.New(t)
+
+	spcMessage := readBin("../testdata/FPS-lease/spc1.bin")
+
+	k := testKsm(t)
+	_, err := k.GenCKCWithOptions(spcMessage, CKCOptions{Offline: true})
+	assert.True(errors.Is(err, ErrPolicyDenied))
+
+	var policyErr *PolicyError
+	assert.True(errors.As(err, &policyErr))
+	assert.NotEmpty(policyErr.Reason)
+
+	k.Rck = PolicyContentKey{Policy: AssetPolicy{Offline: &OfflinePolicy{}}}
+	ckc, err := k.GenCKCWithOptions(spcMessage, CKCOptions{Offline: true})
+	assert.NoError(err)
+	assert.NotEmpty(ckc)
+}
+
+func TestStreamingIndicatorOutput(t *testing.T) {
+	assert.Equal(t, OutputAirPlay, StreamingIndicatorAirPlay.Output())
+	assert.Equal(t, OutputAVAdapter, StreamingIndicatorAVAdapter.Output())
+
+	// The values of the FPS specification. AirPlay shares its value with the tag of the TLLV.
+	assert.Equal(t, OutputAirPlay, StreamingIndicator(0xabb0256a31843974).Output())
+	assert.Equal(t, OutputAVAdapter, StreamingIndicator(0x5f9c8132b59f2fde).Output())
+	assert.Equal(t, OutputLocal, StreamingIndicator(0).Output())
+	assert.Equal(t, OutputLocal, StreamingIndicator(0x33299075b3fe8b7d).Output())
+}
+
+func TestParseOutputRule(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		name string
+		out  OutputRule
+	}{
+		{"", OutputRule{}},
+		{"allow", OutputRule{}},
+		{"Deny", OutputRule{Deny: true}},
+		{"type1", OutputRule{HDCP: HDCPType1}},
+	}
+	for _, test := range tests {
+		out, err := ParseOutputRule(test.name)
+		assert.NoError(err)
+		assert.Equal(test.out, out)
+	}
+
+	_, err := ParseOutputRule("block")
+	assert.Error(err)
+}
+
+func TestAssetPolicyForOutput(t *testing.T) {
+	assert := assert.New(t)
+
+	policy := &AssetPolicy{
+		HDCP: HDCPType0,
+		Outputs: map[OutputPath]OutputRule{
+			OutputAirPlay:   {Deny: true},
+			OutputAVAdapter: {HDCP: HDCPType1},
+		},
+	}
+
+	local, err := policy.forOutput(OutputLocal)
+	assert.NoError(err)
+	assert.Equal(HDCPType0, local.HDCP)
+
+	adapter, err := policy.forOutput(OutputAVAdapter)
+	assert.NoError(err)
+	assert.Equal(HDCPType1, adapter.HDCP)
+	assert.Equal(HDCPType0, policy.HDCP, "the asset policy must not be modified")
+
+	_, err = policy.forOutput(OutputAirPlay)
+	var policyErr *PolicyError
+	assert.True(errors.As(err, &policyErr))
+	assert.Contains(policyErr.Reason, "airplay")
+}
+
+func TestGenCKC_AirPlayDenied(t *testing.T) {
+	assert := assert.New(t)
+
+	playback := readBin("../testdata/FPS/spc1.bin")
+
+	airPlay := resealSPC(t, playback, func(blocks []TLLVBlock) []TLLVBlock {
+		for i, block := range blocks {
+			if block.Tag == tagTreamingIndicator {
+				blocks[i].Value = binary.BigEndian.AppendUint64(nil, uint64(StreamingIndicatorAirPlay))
+			}
+		}
+		return blocks
+	})
+
+	k := testKsm(t)
+	k.Rck = PolicyContentKey{
+		Policy: AssetPolicy{Outputs: map[OutputPath]OutputRule{OutputAirPlay: {Deny: true}}},
+	}
+
+	_, err := k.GenCKC(playback)
+	assert.NoError(err, "local playback is allowed")
+
+	_, err = k.GenCKC(airPlay)
+	assert.True(errors.Is(err, ErrPolicyDenied))
+}
+
+func TestGenCKC_PersistableKeyType(t *testing.T) {
+	assert := assert.New(t)
+
+	e, k := testEmulator(t)
+	persisted, err := NewCkcContentKeyDurationBlockWithKeyType(0, 0, KeyTypePersisted)
+	assert.NoError(err)
+	limited, err := NewCkcContentKeyDurationBlockWithKeyType(0, 3600, KeyTypePersistedWithLimit)
+	assert.NoError(err)
+	keys := &mapKeys{tenant: "customer", assets: map[string]*AssetKey{
+		"persisted": {Key: randomBytes(16), IV: randomBytes(16), Duration: persisted, Policy: &AssetPolicy{}},
+		"limited":   {Key: randomBytes(16), IV: randomBytes(16), Duration: limited, Policy: &AssetPolicy{}},
+		"lease":     {Key: randomBytes(16), IV: randomBytes(16), Duration: NewCkcContentKeyDurationBlock(3600, 0), Policy: &AssetPolicy{}},
+	}}
+	k.Rck, k.Keys = nil, keys
+	ctx := context.WithValue(context.Background(), tenantKey{}, "customer")
+	state := &MediaPlaybackState{CreationTime: time.Now(), State: PlaybackStatePlaying}
+
+	// A streaming SPC for an asset without offline policy never gets a persistable key type.
+	for _, assetID := range []string{"persisted", "limited"} {
+		spc := e.build(t, spcRequest{AssetID: []byte(assetID), PlaybackState: state})
+		_, err := k.GenCKCContext(ctx, spc.Playback, CKCOptions{})
+		assert.ErrorIs(err, ErrPolicyDenied, assetID)
+	}
+
+	spc := e.build(t, spcRequest{AssetID: []byte("lease"), PlaybackState: state})
+	out, err := k.GenCKCContext(ctx, spc.Playback, CKCOptions{})
+	assert.NoError(err)
+	ckc, err := DecodeCKC(out, spc.Secrets)
+	assert.NoError(err)
+	if assert.NotNil(ckc.Duration) {
+		assert.False(ckc.Duration.KeyType.Persistable())
+	}
+
+	// Offline requests of an asset allowing offline playback carry the offline key TLLV instead.
+	keys.assets["persisted"].Policy = &AssetPolicy{Offline: &OfflinePolicy{}}
+	spc = e.build(t, spcRequest{AssetID: []byte("persisted"), PlaybackState: state})
+	_, err = k.GenCKCContext(ctx, spc.Playback, CKCOptions{})
+	assert.ErrorIs(err, ErrPolicyDenied, "streaming requests are denied even if offline is allowed")
+	out, err = k.GenCKCContext(ctx, spc.Playback, CKCOptions{Offline: true})
+	assert.NoError(err)
+	ckc, err = DecodeCKC(out, spc.Secrets)
+	assert.NoError(err)
+	assert.Nil(ckc.Duration)
+}
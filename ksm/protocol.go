@@ -0,0 +1,72 @@
+package ksm
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// DefaultProtocolVersions are the FairPlay protocol versions accepted when Ksm.ProtocolVersions is empty.
+var DefaultProtocolVersions = []uint32{1}
+
+// ProtocolVersion represents the protocol versions decoded from an SPC.
+type ProtocolVersion struct {
+	Used      uint32   // The protocol version the client used to build the SPC.
+	Supported []uint32 // The protocol versions the client supports.
+}
+
+// ProtocolVersionObserver is an optional interface a ContentKey can implement to receive the negotiated
+// protocol version of the SPC before the content key and policy of the asset are fetched.
+type ProtocolVersionObserver interface {
+	ObserveProtocolVersion(assetID []byte, version ProtocolVersion)
+}
+
+// decodeProtocolVersion decodes the protocol version used and protocol versions supported TLLVs.
+func decodeProtocolVersion(ttlvs map[uint64]TLLVBlock) (*ProtocolVersion, error) {
+	used, ok := ttlvs[tagProtocolVersionUsed]
+	if !ok || len(used.Value) != 4 {
+		return nil, fmt.Errorf("%w: tagProtocolVersionUsed", ErrTLLVMissing)
+	}
+
+	version := &ProtocolVersion{
+		Used: binary.BigEndian.Uint32(used.Value),
+	}
+
+	if supported, ok := ttlvs[tagProtocolVersionsSupported]; ok {
+		if len(supported.Value) == 0 || len(supported.Value)%4 != 0 {
+			return nil, fmt.Errorf("%w: tagProtocolVersionsSupported value length %d", ErrTLLVBlockLength, len(supported.Value))
+		}
+		for offset := 0; offset < len(supported.Value); offset += 4 {
+			version.Supported = append(version.Supported, binary.BigEndian.Uint32(supported.Value[offset:offset+4]))
+		}
+	}
+
+	return version, nil
+}
+
+// checkProtocolVersion returns ErrProtocolVersion if the version used by the client isn't accepted by the server,
+// is below min, or isn't one of the versions the client claims to support.
+func checkProtocolVersion(version *ProtocolVersion, accepted []uint32, min uint32) error {
+	if len(accepted) == 0 {
+		accepted = DefaultProtocolVersions
+	}
+
+	if version.Used < min {
+		return fmt.Errorf("%w: version %d is below the minimum version %d", ErrProtocolVersion, version.Used, min)
+	}
+	if !containsVersion(accepted, version.Used) {
+		return fmt.Errorf("%w: version %d, server supports %v", ErrProtocolVersion, version.Used, accepted)
+	}
+	if version.Supported != nil && !containsVersion(version.Supported, version.Used) {
+		return fmt.Errorf("%w: version %d is not in the client supported versions %v", ErrProtocolVersion, version.Used, version.Supported)
+	}
+	return nil
+}
+
+func containsVersion(versions []uint32, version uint32) bool {
+	for _, v := range versions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package ksm
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countingMetrics records the observed protocol versions.
+type countingMetrics struct {
+	mu       sync.Mutex
+	accepted map[uint32]int
+	rejected map[uint32]int
+}
+
+func (m *countingMetrics) ObserveProtocolVersion(version uint32, accepted bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.accepted == nil {
+		m.accepted, m.rejected = map[uint32]int{}, map[uint32]int{}
+	}
+	if accepted {
+		m.accepted[version]++
+	} else {
+		m.rejected[version]++
+	}
+}
+
+// VersionContentKey is a RandomContentKey that records the observed protocol version.
+type VersionContentKey struct {
+	RandomContentKey
+	Version *ProtocolVersion
+}
+
+func (v VersionContentKey) ObserveProtocolVersion(assetID []byte, version ProtocolVersion) {
+	*v.Version = version
+}
+
+func TestDecodeProtocolVersion(t *testing.T) {
+	assert := assert.New(t)
+
+	ttlvs := map[uint64]TLLVBlock{
+		tagProtocolVersionUsed:       {Tag: tagProtocolVersionUsed, Value: []byte{0, 0, 0, 1}},
+		tagProtocolVersionsSupported: {Tag: tagProtocolVersionsSupported, Value: []byte{0, 0, 0, 1, 0, 0, 0, 2}},
+	}
+	version, err := decodeProtocolVersion(ttlvs)
+	assert.NoError(err)
+	assert.Equal(&ProtocolVersion{Used: 1, Supported: []uint32{1, 2}}, version)
+
+	ttlvs[tagProtocolVersionsSupported] = TLLVBlock{Tag: tagProtocolVersionsSupported, Value: []byte{0, 0, 1}}
+	_, err = decodeProtocolVersion(ttlvs)
+	assert.True(errors.Is(err, ErrTLLVBlockLength))
+
+	delete(ttlvs, tagProtocolVersionUsed)
+	_, err = decodeProtocolVersion(ttlvs)
+	assert.True(errors.Is(err, ErrTLLVMissing))
+}
+
+func TestCheckProtocolVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		version  ProtocolVersion
+		accepted []uint32
+		min      uint32
+		ok       bool
+	}{
+		{"default", ProtocolVersion{Used: 1, Supported: []uint32{1}}, nil, 0, true},
+		{"not accepted by default", ProtocolVersion{Used: 2, Supported: []uint32{1, 2}}, nil, 0, false},
+		{"accepted", ProtocolVersion{Used: 2, Supported: []uint32{1, 2}}, []uint32{1, 2}, 0, true},
+		{"below minimum", ProtocolVersion{Used: 1, Supported: []uint32{1, 2}}, []uint32{1, 2}, 2, false},
+		{"not supported by client", ProtocolVersion{Used: 2, Supported: []uint32{1}}, []uint32{1, 2}, 0, false},
+		{"no supported versions", ProtocolVersion{Used: 1}, nil, 1, true},
+	}
+	for _, test := range tests {
+		err := checkProtocolVersion(&test.version, test.accepted, test.min)
+		if test.ok {
+			assert.NoError(t, err, test.name)
+		} else {
+			assert.True(t, errors.Is(err, ErrProtocolVersion), test.name)
+		}
+	}
+}
+
+func TestGenCKC_ProtocolVersion(t *testing.T) {
+	assert := assert.New(t)
+
+	spcMessage := readBin("../testdata/FPS/spc1.bin")
+
+	metrics := &countingMetrics{}
+	version := &ProtocolVersion{}
+	k := testKsm(t)
+	k.Rck, k.Metrics = VersionContentKey{Version: version}, metrics
+
+	_, err := k.GenCKC(spcMessage)
+	assert.NoError(err)
+	assert.Equal(&ProtocolVersion{Used: 1, Supported: []uint32{1}}, version)
+	assert.Equal(1, metrics.accepted[1])
+
+	k.ProtocolVersions = []uint32{1, 2}
+	k.MinProtocolVersion = 2
+	_, err = k.GenCKC(spcMessage)
+	assert.True(errors.Is(err, ErrProtocolVersion))
+	assert.Equal(1, metrics.rejected[1])
+}
@@ -0,0 +1,177 @@
+package ksm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultReplayTTL is how long a ReplayGuard without creation time window remembers an SPC.
+const DefaultReplayTTL = 24 * time.Hour
+
+// ReplayStore records the SPCs already seen. Implementations must be safe for concurrent use,
+// and a store shared by several servers must test and record the keys of an SPC in one atomic operation.
+type ReplayStore interface {
+	// Seen returns the keys already recorded and not expired. If there is none, Seen records every key
+	// for ttl, otherwise it records nothing.
+	Seen(keys []string, ttl time.Duration) ([]string, error)
+	// Contains reports whether key is recorded and hasn't expired, without recording it.
+	Contains(key string) (bool, error)
+}
+
+// ReplayGuard rejects SPCs that were already seen, identified by their transaction ID and
+// anti-replay seed, and SPCs whose creation time is outside a window around the current time.
+type ReplayGuard struct {
+	Store ReplayStore
+
+	// Window is the maximum difference between the SPC creation time, sent in the Media Playback State TLLV,
+	// and the current time. Zero doesn't check the creation time. SPCs without creation time are accepted.
+	Window time.Duration
+
+	// TTL is how long an SPC is remembered. Zero is twice Window, or DefaultReplayTTL without Window.
+	TTL time.Duration
+
+	now func() time.Time
+}
+
+// Check returns ErrSPCReplayed if spc was already seen or ErrSPCExpired if its creation time is outside
+// the window. Check doesn't record spc: call Commit once the CKC answering spc is generated, so that
+// a request failing after Check can be retried.
+func (g *ReplayGuard) Check(spc *SPC) error {
+	now := time.Now()
+	if g.now != nil {
+		now = g.now()
+	}
+
+	if g.Window > 0 && spc.PlaybackState != nil {
+		created := spc.PlaybackState.CreationTime
+		if created.Before(now.Add(-g.Window)) || created.After(now.Add(g.Window)) {
+			return fmt.Errorf("%w: created at %s, %s window", ErrSPCExpired, created.UTC().Format(time.RFC3339), g.Window)
+		}
+	}
+
+	var replayed []string
+	for _, key := range replayKeys(spc) {
+		seen, err := g.Store.Contains(key)
+		if err != nil {
+			return err
+		}
+		if seen {
+			replayed = append(replayed, key)
+		}
+	}
+	if len(replayed) > 0 {
+		return fmt.Errorf("%w: %v", ErrSPCReplayed, replayed)
+	}
+	return nil
+}
+
+// Commit records spc. It returns ErrSPCReplayed if spc was recorded since Check, by a concurrent request
+// with the same transaction ID or anti-replay seed: the CKC answering spc must then be discarded, and neither
+// key of spc is recorded.
+func (g *ReplayGuard) Commit(spc *SPC) error {
+	replayed, err := g.Store.Seen(replayKeys(spc), g.ttl())
+	if err != nil {
+		return err
+	}
+	if len(replayed) > 0 {
+		return fmt.Errorf("%w: %v", ErrSPCReplayed, replayed)
+	}
+	return nil
+}
+
+// replayKeys returns the keys identifying spc: its transaction ID, if any, and its anti-replay seed.
+func replayKeys(spc *SPC) []string {
+	var keys []string
+	if spc.TransactionID != 0 {
+		keys = append(keys, "tx:"+strconv.FormatUint(spc.TransactionID, 16))
+	}
+	seed := sha256.Sum256(spc.AntiReplaySeed)
+	return append(keys, "ar:"+hex.EncodeToString(seed[:]))
+}
+
+func (g *ReplayGuard) ttl() time.Duration {
+	switch {
+	case g.TTL > 0:
+		return g.TTL
+	case g.Window > 0:
+		return 2 * g.Window
+	default:
+		return DefaultReplayTTL
+	}
+}
+
+// MemoryReplayStore is a ReplayStore kept in memory, for tests and single instance deployments.
+type MemoryReplayStore struct {
+	mu      sync.Mutex
+	expires map[string]time.Time
+	inserts int
+
+	now func() time.Time
+}
+
+// memoryReplaySweep is the number of inserts between two sweeps of the expired keys.
+const memoryReplaySweep = 1024
+
+// NewMemoryReplayStore creates an empty MemoryReplayStore.
+func NewMemoryReplayStore() *MemoryReplayStore {
+	return &MemoryReplayStore{expires: make(map[string]time.Time)}
+}
+
+// Seen implements ReplayStore.
+func (s *MemoryReplayStore) Seen(keys []string, ttl time.Duration) ([]string, error) {
+	now := time.Now()
+	if s.now != nil {
+		now = s.now()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var seen []string
+	for _, key := range keys {
+		if expires, ok := s.expires[key]; ok && now.Before(expires) {
+			seen = append(seen, key)
+		}
+	}
+	if len(seen) > 0 {
+		return seen, nil
+	}
+
+	for _, key := range keys {
+		s.expires[key] = now.Add(ttl)
+		s.inserts++
+		if s.inserts%memoryReplaySweep == 0 {
+			for k, expires := range s.expires {
+				if !now.Before(expires) {
+					delete(s.expires, k)
+				}
+			}
+		}
+	}
+	return nil, nil
+}
+
+// Contains implements ReplayStore.
+func (s *MemoryReplayStore) Contains(key string) (bool, error) {
+	now := time.Now()
+	if s.now != nil {
+		now = s.now()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expires, ok := s.expires[key]
+	return ok && now.Before(expires), nil
+}
+
+// Len returns the number of keys recorded, including expired keys not swept yet.
+func (s *MemoryReplayStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.expires)
+}
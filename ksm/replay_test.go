@@ -0,0 +1,131 @@
+package ksm
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryReplayStore(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Unix(1700000000, 0)
+	s := NewMemoryReplayStore()
+	s.now = func() time.Time { return now }
+
+	seen, err := s.Contains("key")
+	assert.NoError(err)
+	assert.False(seen)
+
+	replayed, err := s.Seen([]string{"key"}, time.Minute)
+	assert.NoError(err)
+	assert.Empty(replayed)
+
+	replayed, _ = s.Seen([]string{"key"}, time.Minute)
+	assert.Equal([]string{"key"}, replayed)
+	seen, _ = s.Contains("key")
+	assert.True(seen)
+
+	// Keys are recorded together or not at all.
+	replayed, _ = s.Seen([]string{"other", "key"}, time.Minute)
+	assert.Equal([]string{"key"}, replayed)
+	seen, _ = s.Contains("other")
+	assert.False(seen, "no key is recorded if one was already seen")
+
+	now = now.Add(time.Minute)
+	replayed, _ = s.Seen([]string{"key"}, time.Minute)
+	assert.Empty(replayed, "an expired key must be recorded again")
+
+	// Expired keys are swept.
+	for i := 0; i < memoryReplaySweep; i++ {
+		s.Seen([]string{fmt.Sprint(i)}, time.Second)
+	}
+	now = now.Add(time.Hour)
+	for i := 0; i < memoryReplaySweep; i++ {
+		s.Seen([]string{fmt.Sprint("new", i)}, time.Second)
+	}
+	assert.LessOrEqual(s.Len(), memoryReplaySweep+1)
+}
+
+func TestReplayGuard(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Unix(1700000000, 0)
+	g := &ReplayGuard{Store: NewMemoryReplayStore(), Window: 5 * time.Minute, now: func() time.Time { return now }}
+	assert.Equal(10*time.Minute, g.ttl())
+
+	spc := func(transactionID uint64, seed string, created time.Time) *SPC {
+		return &SPC{
+			TransactionID:  transactionID,
+			AntiReplaySeed: []byte(seed),
+			PlaybackState:  &MediaPlaybackState{CreationTime: created},
+		}
+	}
+
+	checkAndCommit := func(spc *SPC) error {
+		if err := g.Check(spc); err != nil {
+			return err
+		}
+		return g.Commit(spc)
+	}
+
+	assert.NoError(g.Check(spc(1, "seed-1", now)))
+	assert.NoError(g.Check(spc(1, "seed-1", now)), "an SPC is only recorded by Commit")
+	assert.NoError(g.Commit(spc(1, "seed-1", now)))
+	assert.True(errors.Is(g.Check(spc(1, "seed-1", now)), ErrSPCReplayed))
+	assert.True(errors.Is(g.Check(spc(1, "seed-2", now)), ErrSPCReplayed), "same transaction ID")
+	assert.True(errors.Is(g.Check(spc(2, "seed-1", now)), ErrSPCReplayed), "same anti-replay seed")
+	assert.NoError(checkAndCommit(spc(3, "seed-3", now.Add(-4*time.Minute))))
+	assert.NoError(checkAndCommit(&SPC{AntiReplaySeed: []byte("seed-4")}), "no creation time and no transaction ID")
+
+	// Of two concurrent requests with the same SPC, only the first to commit succeeds.
+	assert.NoError(g.Check(spc(7, "seed-8", now)))
+	assert.NoError(g.Check(spc(7, "seed-8", now)))
+	assert.NoError(g.Commit(spc(7, "seed-8", now)))
+	assert.True(errors.Is(g.Commit(spc(7, "seed-8", now)), ErrSPCReplayed))
+
+	// A commit refused for one key doesn't record the other key.
+	assert.NoError(g.Check(spc(8, "seed-9", now)))
+	assert.NoError(g.Check(spc(9, "seed-9", now)))
+	assert.NoError(g.Commit(spc(8, "seed-9", now)))
+	assert.True(errors.Is(g.Commit(spc(9, "seed-9", now)), ErrSPCReplayed))
+	assert.NoError(checkAndCommit(spc(9, "seed-10", now)), "the transaction ID of the refused commit isn't recorded")
+
+	assert.True(errors.Is(g.Check(spc(4, "seed-5", now.Add(-6*time.Minute))), ErrSPCExpired))
+	assert.True(errors.Is(g.Check(spc(5, "seed-6", now.Add(6*time.Minute))), ErrSPCExpired))
+
+	g.Window = 0
+	assert.Equal(DefaultReplayTTL, g.ttl())
+	assert.NoError(checkAndCommit(spc(6, "seed-7", now.Add(-time.Hour))))
+}
+
+func TestGenCKC_Replay(t *testing.T) {
+	assert := assert.New(t)
+
+	playback := readBin("../testdata/FPS/spc1.bin")
+
+	k := testKsm(t)
+	k.Replay = &ReplayGuard{Store: NewMemoryReplayStore()}
+
+	_, err := k.GenCKC(playback)
+	assert.NoError(err)
+	_, err = k.GenCKC(playback)
+	assert.True(errors.Is(err, ErrSPCReplayed))
+
+	// A request failing after the replay check doesn't record the SPC, so it can be retried.
+	k.Replay = &ReplayGuard{Store: NewMemoryReplayStore()}
+	k.Rck = failingContentKey{}
+	_, err = k.GenCKC(playback)
+	assert.True(errors.Is(err, ErrAssetNotFound))
+	k.Rck = RandomContentKey{}
+	_, err = k.GenCKC(playback)
+	assert.NoError(err)
+
+	// The capture was created in September 2025.
+	k.Replay = &ReplayGuard{Store: NewMemoryReplayStore(), Window: time.Hour}
+	_, err = k.GenCKC(playback)
+	assert.True(errors.Is(err, ErrSPCExpired))
+}
@@ -0,0 +1,271 @@
+package ksm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// PlaybackState represents the playback state of the Media Playback State TLLV.
+type PlaybackState uint32
+
+const (
+	PlaybackStateReadyToStart    PlaybackState = playbackStateReadyToStart    // The playback session is ready to start.
+	PlaybackStatePlayingOrPaused PlaybackState = playbackStatePlayingOrPaused // The playback session is playing or paused.
+	PlaybackStatePlaying         PlaybackState = playbackStatePlaying         // The playback session is playing.
+	PlaybackStateHalted          PlaybackState = playbackStateHalted          // The playback session is halted.
+)
+
+// String returns the name of the playback state.
+func (s PlaybackState) String() string {
+	switch s {
+	case PlaybackStateReadyToStart:
+		return "ReadyToStart"
+	case PlaybackStatePlayingOrPaused:
+		return "PlayingOrPaused"
+	case PlaybackStatePlaying:
+		return "Playing"
+	case PlaybackStateHalted:
+		return "Halted"
+	default:
+		return fmt.Sprintf("PlaybackState(0x%x)", uint32(s))
+	}
+}
+
+// MediaPlaybackState represents the decoded Media Playback State TLLV.
+type MediaPlaybackState struct {
+	CreationTime time.Time     // The time the SPC was created, with second precision.
+	State        PlaybackState // The state of the playback session.
+	SessionID    uint64        // The playback session ID.
+}
+
+// StreamingIndicator represents the value of the Streaming Indicator TLLV.
+type StreamingIndicator uint64
+
+const (
+	StreamingIndicatorAirPlay   StreamingIndicator = 0xabb0256a31843974 // The content is sent to an Apple TV with AirPlay.
+	StreamingIndicatorAVAdapter StreamingIndicator = 0x5f9c8132b59f2fde // The content is sent through an Apple digital AV adapter.
+)
+
+// Output returns the output path of the streaming indicator. Any value other than AirPlay
+// and the Apple digital AV adapter, including an absent indicator, means local playback.
+func (i StreamingIndicator) Output() OutputPath {
+	switch i {
+	case StreamingIndicatorAirPlay:
+		return OutputAirPlay
+	case StreamingIndicatorAVAdapter:
+		return OutputAVAdapter
+	default:
+		return OutputLocal
+	}
+}
+
+// OutputPath represents where the client plays the content.
+type OutputPath int
+
+const (
+	OutputLocal     OutputPath = iota // The content is played on the device.
+	OutputAirPlay                     // The content is sent to an Apple TV with AirPlay.
+	OutputAVAdapter                   // The content is sent through an Apple digital AV adapter.
+)
+
+// String returns the name of the output path.
+func (o OutputPath) String() string {
+	switch o {
+	case OutputLocal:
+		return "local"
+	case OutputAirPlay:
+		return "airplay"
+	case OutputAVAdapter:
+		return "av_adapter"
+	default:
+		return fmt.Sprintf("OutputPath(%d)", int(o))
+	}
+}
+
+// SPC represents a decoded SPC payload.
+//
+// The fields are decoded from the TLLVs of the SPC. Optional TLLVs the client didn't send are left zero (or nil).
+type SPC struct {
+	Container *SPCContainer // The SPC container the SPC is decoded from.
+
+	AssetID            []byte               // The asset ID, 2 to 200 bytes.
+	TransactionID      uint64               // The transaction ID, zero if absent.
+	ProtocolVersion    ProtocolVersion      // The protocol versions used and supported by the client.
+	PlaybackState      *MediaPlaybackState  // The media playback state, nil if absent.
+	StreamingIndicator StreamingIndicator   // The streaming indicator, zero if absent.
+	ReturnRequestTags  []uint64             // The tags of the TLLVs the client requests back in the CKC.
+	Capabilities       Capabilities         // The capabilities of the client, zero if absent.
+	SecurityLevel      *SecurityLevelReport // The security level of the client, nil if absent.
+	Unknown            []TLLVBlock          // The TLLVs this package doesn't decode, in payload order.
+
+	SKR1           *SKR1TLLVBlock // The encrypted [SK..R1] block.
+	SKR1Integrity  []byte         // The 16-byte [SK..R1] integrity bytes.
+	AntiReplaySeed []byte         // The 16-byte anti-replay seed.
+	R2             []byte         // The R2 value used to compute DASk.
+
+	// DeviceID is the HU, the 20-byte hashed device ID. It is encrypted in [SK..R1],
+	// so DecodeSPC leaves it nil and GenCKC sets it once [SK..R1] is decrypted.
+	DeviceID []byte
+}
+
+// knownSPCTags are the tags of the TLLVs DecodeSPC decodes into SPC fields.
+var knownSPCTags = map[uint64]bool{
+	tagSessionKeyR1:              true,
+	tagSessionKeyR1Integrity:     true,
+	tagAntiReplaySeed:            true,
+	tagR2:                        true,
+	tagReturnRequest:             true,
+	tagAssetID:                   true,
+	tagTransactionID:             true,
+	tagProtocolVersionsSupported: true,
+	tagProtocolVersionUsed:       true,
+	tagTreamingIndicator:         true,
+	tagMediaPlaybackState:        true,
+	tagCapabilities:              true,
+	tagSecurityLevelReport:       true,
+}
+
+// DecodeSPC decodes the TLLVs of a parsed SPC container into a SPC.
+// DecodeSPC returns an error if a required TLLV is missing or a TLLV value has the wrong length.
+func DecodeSPC(container *SPCContainer) (*SPC, error) {
+	ttlvs := container.TTLVS
+	spc := &SPC{Container: container}
+
+	skr1, err := parseSKR1(ttlvs[tagSessionKeyR1])
+	if err != nil {
+		return nil, err
+	}
+	spc.SKR1 = skr1
+
+	if spc.SKR1Integrity, err = requiredValue(ttlvs, tagSessionKeyR1Integrity, "tagSessionKeyR1Integrity", 16); err != nil {
+		return nil, err
+	}
+	if spc.AntiReplaySeed, err = requiredValue(ttlvs, tagAntiReplaySeed, "tagAntiReplaySeed", 16); err != nil {
+		return nil, err
+	}
+	if spc.R2, err = requiredValue(ttlvs, tagR2, "tagR2", 0); err != nil {
+		return nil, err
+	}
+
+	assetID, ok := ttlvs[tagAssetID]
+	if !ok {
+		return nil, fmt.Errorf("%w: tagAssetID", ErrTLLVMissing)
+	}
+	// assetID its length can range from 2 to 200 bytes
+	if len(assetID.Value) < 2 || len(assetID.Value) > 200 {
+		return nil, fmt.Errorf("%w: tagAssetID value length %d, must range from 2 to 200 bytes", ErrTLLVBlockLength, len(assetID.Value))
+	}
+	spc.AssetID = assetID.Value
+
+	if transactionID, ok := ttlvs[tagTransactionID]; ok {
+		if len(transactionID.Value) != 8 {
+			return nil, fmt.Errorf("%w: tagTransactionID value length %d", ErrTLLVBlockLength, len(transactionID.Value))
+		}
+		spc.TransactionID = binary.BigEndian.Uint64(transactionID.Value)
+	}
+
+	protocolVersion, err := decodeProtocolVersion(ttlvs)
+	if err != nil {
+		return nil, err
+	}
+	spc.ProtocolVersion = *protocolVersion
+
+	if playbackState, ok := ttlvs[tagMediaPlaybackState]; ok {
+		if spc.PlaybackState, err = decodeMediaPlaybackState(playbackState.Value); err != nil {
+			return nil, err
+		}
+	}
+
+	if indicator, ok := ttlvs[tagTreamingIndicator]; ok {
+		if len(indicator.Value) != 8 {
+			return nil, fmt.Errorf("%w: tagTreamingIndicator value length %d", ErrTLLVBlockLength, len(indicator.Value))
+		}
+		spc.StreamingIndicator = StreamingIndicator(binary.BigEndian.Uint64(indicator.Value))
+	}
+
+	if capabilities, ok := ttlvs[tagCapabilities]; ok {
+		if spc.Capabilities, err = decodeCapabilities(capabilities.Value); err != nil {
+			return nil, err
+		}
+	}
+
+	if report, ok := ttlvs[tagSecurityLevelReport]; ok {
+		if spc.SecurityLevel, err = decodeSecurityLevelReport(report.Value); err != nil {
+			return nil, err
+		}
+	}
+
+	returnRequest := ttlvs[tagReturnRequest].Value
+	if len(returnRequest)%fieldTagLength != 0 {
+		return nil, fmt.Errorf("%w: tagReturnRequest value length %d", ErrTLLVBlockLength, len(returnRequest))
+	}
+	for offset := 0; offset < len(returnRequest); offset += fieldTagLength {
+		spc.ReturnRequestTags = append(spc.ReturnRequestTags, binary.BigEndian.Uint64(returnRequest[offset:offset+fieldTagLength]))
+	}
+
+	for _, tllv := range container.Blocks {
+		if !knownSPCTags[tllv.Tag] {
+			spc.Unknown = append(spc.Unknown, tllv)
+		}
+	}
+
+	return spc, nil
+}
+
+// decodeMediaPlaybackState decodes the Media Playback State TLLV value:
+// creation time(4), playback state(4) and playback session ID(8).
+func decodeMediaPlaybackState(value []byte) (*MediaPlaybackState, error) {
+	if len(value) != 16 {
+		return nil, fmt.Errorf("%w: tagMediaPlaybackState value length %d, must be 16", ErrTLLVBlockLength, len(value))
+	}
+
+	return &MediaPlaybackState{
+		CreationTime: time.Unix(int64(binary.BigEndian.Uint32(value[0:4])), 0),
+		State:        PlaybackState(binary.BigEndian.Uint32(value[4:8])),
+		SessionID:    binary.BigEndian.Uint64(value[8:16]),
+	}, nil
+}
+
+// requiredValue returns the value of the tag TLLV, which must be length bytes long unless length is zero.
+func requiredValue(ttlvs map[uint64]TLLVBlock, tag uint64, name string, length int) ([]byte, error) {
+	tllv, ok := ttlvs[tag]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTLLVMissing, name)
+	}
+	if length != 0 && len(tllv.Value) != length {
+		return nil, fmt.Errorf("%w: %s value length %d, must be %d", ErrTLLVBlockLength, name, len(tllv.Value), length)
+	}
+	return tllv.Value, nil
+}
+
+// DuplicateTagPolicy represents what GenCKC does with an SPC containing a duplicated TLLV tag.
+type DuplicateTagPolicy int
+
+const (
+	// DuplicateTagWarn logs the duplicated tags and uses the last block of each tag.
+	DuplicateTagWarn DuplicateTagPolicy = iota
+	// DuplicateTagReject rejects the SPC with a *DuplicateTagError.
+	DuplicateTagReject
+)
+
+// ParseDuplicateTagPolicy parses a duplicate tag policy name ("warn" or "reject"). An empty name returns DuplicateTagWarn.
+func ParseDuplicateTagPolicy(name string) (DuplicateTagPolicy, error) {
+	switch strings.ToLower(name) {
+	case "", "warn":
+		return DuplicateTagWarn, nil
+	case "reject":
+		return DuplicateTagReject, nil
+	default:
+		return 0, fmt.Errorf("unknown duplicate tag policy %q, must be warn or reject", name)
+	}
+}
+
+// Level returns the security level of the client, SecurityLevelNone if it doesn't report one.
+func (s *SPC) Level() SecurityLevel {
+	if s.SecurityLevel == nil {
+		return SecurityLevelNone
+	}
+	return s.SecurityLevel.Level
+}
@@ -0,0 +1,190 @@
+package ksm
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/minsoo-gold/fairplay-ksm/cryptos"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeSPC(t *testing.T) {
+	assert := assert.New(t)
+
+	k := testKsm(t)
+
+	container, err := ParseSPC(readBin("../testdata/FPS/spc1.bin"), k.Pub, k.Pri)
+	assert.NoError(err)
+
+	spc, err := DecodeSPC(container)
+	assert.NoError(err)
+
+	assert.Equal(container, spc.Container)
+	assert.Contains(string(spc.AssetID), "skd://")
+	assert.Equal(uint64(0x5b57423066a855e9), spc.TransactionID)
+	assert.Equal(ProtocolVersion{Used: 1, Supported: []uint32{1}}, spc.ProtocolVersion)
+	assert.Equal(&MediaPlaybackState{
+		CreationTime: time.Unix(0x68cf6a1f, 0),
+		State:        PlaybackStateReadyToStart,
+		SessionID:    0x5cfbf285bd8b66d0,
+	}, spc.PlaybackState)
+	assert.Equal(StreamingIndicator(0x33299075b3fe8b7d), spc.StreamingIndicator)
+	assert.Equal([]uint64{tagAssetID, tagTransactionID}, spc.ReturnRequestTags[:2])
+	assert.Len(spc.SKR1.Payload, 96)
+	assert.Len(spc.SKR1Integrity, 16)
+	assert.Len(spc.AntiReplaySeed, 16)
+	assert.NotEmpty(spc.R2)
+
+	assert.NotEmpty(spc.Unknown)
+	for _, tllv := range spc.Unknown {
+		assert.False(knownSPCTags[tllv.Tag], "known tag %x in Unknown", tllv.Tag)
+	}
+	assert.Equal(Capabilities(0x7f), spc.Capabilities)
+	assert.Equal(&SecurityLevelReport{Version: 1, Value: securityLevelMain, Level: SecurityLevelMain}, spc.SecurityLevel)
+	assert.Equal(len(container.Blocks)-len(spc.Unknown), 13)
+}
+
+func TestDecodeSPC_Malformed(t *testing.T) {
+	k := testKsm(t)
+
+	tests := []struct {
+		name   string
+		modify func(ttlvs map[uint64]TLLVBlock)
+		err    error
+	}{
+		{"no anti-replay seed", func(m map[uint64]TLLVBlock) { delete(m, tagAntiReplaySeed) }, ErrTLLVMissing},
+		{"no R2", func(m map[uint64]TLLVBlock) { delete(m, tagR2) }, ErrTLLVMissing},
+		{"no asset ID", func(m map[uint64]TLLVBlock) { delete(m, tagAssetID) }, ErrTLLVMissing},
+		{"short asset ID", func(m map[uint64]TLLVBlock) {
+			m[tagAssetID] = TLLVBlock{Tag: tagAssetID, Value: []byte{1}}
+		}, ErrTLLVBlockLength},
+		{"short transaction ID", func(m map[uint64]TLLVBlock) {
+			m[tagTransactionID] = TLLVBlock{Tag: tagTransactionID, Value: []byte{1, 2, 3, 4}}
+		}, ErrTLLVBlockLength},
+		{"short playback state", func(m map[uint64]TLLVBlock) {
+			m[tagMediaPlaybackState] = TLLVBlock{Tag: tagMediaPlaybackState, Value: make([]byte, 12)}
+		}, ErrTLLVBlockLength},
+		{"odd return request", func(m map[uint64]TLLVBlock) {
+			m[tagReturnRequest] = TLLVBlock{Tag: tagReturnRequest, Value: make([]byte, 12)}
+		}, ErrTLLVBlockLength},
+	}
+	for _, test := range tests {
+		container, err := ParseSPC(readBin("../testdata/FPS/spc1.bin"), k.Pub, k.Pri)
+		assert.NoError(t, err)
+
+		test.modify(container.TTLVS)
+		_, err = DecodeSPC(container)
+		assert.True(t, errors.Is(err, test.err), "%s: %v", test.name, err)
+	}
+}
+
+func TestPlaybackStateString(t *testing.T) {
+	assert.Equal(t, "Playing", PlaybackStatePlaying.String())
+	assert.Equal(t, "PlaybackState(0x1)", PlaybackState(1).String())
+}
+
+func TestIndexTLLVs(t *testing.T) {
+	assert := assert.New(t)
+
+	blocks := []TLLVBlock{
+		{Tag: tagAssetID, Value: []byte("first")},
+		{Tag: tagR2, Value: []byte("r2")},
+		{Tag: tagAssetID, Value: []byte("second")},
+		{Tag: tagTransactionID, Value: []byte("tx")},
+		{Tag: tagAssetID, Value: []byte("third")},
+	}
+
+	m, duplicates := indexTLLVs(blocks)
+	assert.Len(m, 3)
+	assert.Equal([]byte("third"), m[tagAssetID].Value)
+	assert.Equal([]*DuplicateTagError{{Tag: tagAssetID, Indexes: []int{0, 2, 4}}}, duplicates)
+	assert.True(errors.Is(duplicates[0], ErrDuplicateTag))
+
+	container := &SPCContainer{TTLVS: m, Blocks: blocks}
+	block, ok := container.Block(tagAssetID)
+	assert.True(ok)
+	assert.Equal([]byte("third"), block.Value)
+	_, ok = container.Block(tagAntiReplaySeed)
+	assert.False(ok)
+	assert.Equal([]TLLVBlock{blocks[0], blocks[2], blocks[4]}, container.BlocksByTag(tagAssetID))
+}
+
+func TestGenCKC_DuplicateTags(t *testing.T) {
+	assert := assert.New(t)
+
+	k := testKsm(t)
+	playback := readBin("../testdata/FPS/spc1.bin")
+
+	container, err := ParseSPC(playback, k.Pub, k.Pri)
+	assert.NoError(err)
+	assert.Empty(container.DuplicateTags)
+
+	tampered := resealSPC(t, playback, func(blocks []TLLVBlock) []TLLVBlock {
+		return append(blocks, container.TTLVS[tagTransactionID])
+	})
+
+	container, err = ParseSPC(tampered, k.Pub, k.Pri)
+	assert.NoError(err)
+	assert.Len(container.DuplicateTags, 1)
+	assert.Equal(uint64(tagTransactionID), container.DuplicateTags[0].Tag)
+	assert.Len(container.BlocksByTag(tagTransactionID), 2)
+
+	_, err = k.GenCKC(tampered)
+	assert.NoError(err, "duplicated tags are only logged by default")
+
+	k.DuplicateTags = DuplicateTagReject
+	_, err = k.GenCKC(tampered)
+	var duplicateErr *DuplicateTagError
+	assert.True(errors.As(err, &duplicateErr))
+	assert.Equal(uint64(tagTransactionID), duplicateErr.Tag)
+
+	_, err = k.GenCKC(playback)
+	assert.NoError(err)
+}
+
+func TestParseDuplicateTagPolicy(t *testing.T) {
+	for name, want := range map[string]DuplicateTagPolicy{"": DuplicateTagWarn, "warn": DuplicateTagWarn, "Reject": DuplicateTagReject} {
+		policy, err := ParseDuplicateTagPolicy(name)
+		assert.NoError(t, err)
+		assert.Equal(t, want, policy)
+	}
+
+	_, err := ParseDuplicateTagPolicy("ignore")
+	assert.Error(t, err)
+}
+
+// resealSPC returns playback with its payload re-encrypted after modify changed the TLLV blocks.
+func resealSPC(t *testing.T, playback []byte, modify func([]TLLVBlock) []TLLVBlock) []byte {
+	t.Helper()
+
+	k := testKsm(t)
+
+	container, err := ParseSPC(playback, k.Pub, k.Pri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spck, err := decryptSPCK(k.Pri, container.EncryptedAesKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var payload []byte
+	for _, block := range modify(container.Blocks) {
+		out, err := NewTLLVBlock(block.Tag, block.Value).Serialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		payload = append(payload, out...)
+	}
+	encryptedPayload, err := cryptos.AESCBCEncrypt(spck, container.AesKeyIV, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headerLength := spcLayouts[container.Version].headerLength()
+	out := append([]byte{}, playback[:headerLength]...)
+	binary.BigEndian.PutUint32(out[headerLength-4:], uint32(len(encryptedPayload)))
+	return append(out, encryptedPayload...)
+}
@@ -0,0 +1,86 @@
+/*
+ * Stand-in of a licensed D function library for the dlopen tests.
+ * It returns the hash value of the reference D function, without the final AES encryption with ASk.
+ */
+#include <stdint.h>
+#include <string.h>
+
+#define PRIME 813416437u
+#define NB_RD 16
+
+/* Minimal SHA-1 of a single 64-byte block, enough for the 64-byte padded R2. */
+static uint32_t rol(uint32_t v, int n) { return (v << n) | (v >> (32 - n)); }
+
+static void sha1_block(const uint8_t block[64], uint8_t out[20]) {
+	uint32_t h[5] = {0x67452301, 0xEFCDAB89, 0x98BADCFE, 0x10325476, 0xC3D2E1F0};
+	uint8_t msg[128];
+	uint32_t w[80];
+	int b, i;
+
+	memset(msg, 0, sizeof(msg));
+	memcpy(msg, block, 64);
+	msg[64] = 0x80;
+	msg[126] = 0x02; /* length 512 bits */
+
+	for (b = 0; b < 2; b++) {
+		uint32_t a, bb, c, d, e, f, k, t;
+		for (i = 0; i < 16; i++)
+			w[i] = (uint32_t)msg[b * 64 + 4 * i] << 24 | (uint32_t)msg[b * 64 + 4 * i + 1] << 16 |
+			       (uint32_t)msg[b * 64 + 4 * i + 2] << 8 | msg[b * 64 + 4 * i + 3];
+		for (i = 16; i < 80; i++)
+			w[i] = rol(w[i - 3] ^ w[i - 8] ^ w[i - 14] ^ w[i - 16], 1);
+
+		a = h[0]; bb = h[1]; c = h[2]; d = h[3]; e = h[4];
+		for (i = 0; i < 80; i++) {
+			if (i < 20) { f = (bb & c) | (~bb & d); k = 0x5A827999; }
+			else if (i < 40) { f = bb ^ c ^ d; k = 0x6ED9EBA1; }
+			else if (i < 60) { f = (bb & c) | (bb & d) | (c & d); k = 0x8F1BBCDC; }
+			else { f = bb ^ c ^ d; k = 0xCA62C1D6; }
+			t = rol(a, 5) + f + e + k + w[i];
+			e = d; d = c; c = rol(bb, 30); bb = a; a = t;
+		}
+		h[0] += a; h[1] += bb; h[2] += c; h[3] += d; h[4] += e;
+	}
+
+	for (i = 0; i < 5; i++) {
+		out[4 * i] = h[i] >> 24;
+		out[4 * i + 1] = h[i] >> 16;
+		out[4 * i + 2] = h[i] >> 8;
+		out[4 * i + 3] = h[i];
+	}
+}
+
+int fps_d_function(const uint8_t *r2, uint32_t r2_len, const uint8_t *ask, uint32_t ask_len, uint8_t *dask) {
+	uint8_t pad[64], hash[20];
+	uint32_t m[14], i, r;
+
+	(void)ask;
+	(void)ask_len;
+	if (r2_len == 0 || r2_len > 55)
+		return 1;
+
+	memset(pad, 0, sizeof(pad));
+	memcpy(pad, r2, r2_len);
+	pad[r2_len] = 0x80;
+
+	for (i = 0; i < 14; i++)
+		m[i] = (uint32_t)pad[4 * i] << 24 ^ (uint32_t)pad[4 * i + 1] << 16 ^ (uint32_t)pad[4 * i + 2] << 8 ^ pad[4 * i + 3];
+	for (i = 1; i < 7; i++)
+		m[0] += m[i];
+	m[1] = 0;
+	for (i = 0; i < 7; i++)
+		m[1] += m[i + 7];
+
+	for (i = 0; i < 2; i++)
+		for (r = 0; r < NB_RD; r++)
+			m[i] = (m[i] & 1) ? m[i] >> 1 : (3 * m[i] + 1) % PRIME;
+
+	for (i = 0; i < 4; i++) {
+		pad[56 + i] = (uint8_t)(m[0] >> (8 * i));
+		pad[60 + i] = (uint8_t)(m[1] >> (8 * i));
+	}
+
+	sha1_block(pad, hash);
+	memcpy(dask, hash, 16);
+	return 0;
+}
@@ -1,9 +1,12 @@
 package ksm
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/binary"
 	"errors"
+	"fmt"
+	"strings"
 
 	"github.com/minsoo-gold/fairplay-ksm/logger"
 )
@@ -67,8 +70,7 @@ func (t *TLLVBlock) check() error {
 		return errors.New("tag not found")
 	}
 	if len(t.Value) == 0 {
-		logger.Printf("tag: %x :value not found\n", t.Tag)
-		logger.Printf("tag.ValueLength: %x \n", t.ValueLength)
+		logger.Debug(context.Background(), "tllv value is empty", "tag", fmt.Sprintf("%x", t.Tag), "value_length", t.ValueLength)
 
 		//return fmt.Errorf("tag: %x :value not found", t.Tag)
 	}
@@ -109,16 +111,111 @@ type CkcEncryptedPayload struct {
 type CkcContentKeyDurationBlock struct {
 	*TLLVBlock
 
-	LeaseDuration  uint32 // 16-19, The duration of the lease, if any, in seconds.
-	RentalDuration uint32 // 20-23, The duration of the rental, if any, in seconds.
-	KeyType        uint32 // 24-27,The key type.
+	LeaseDuration  uint32         // 16-19, The duration of the lease, if any, in seconds.
+	RentalDuration uint32         // 20-23, The duration of the rental, if any, in seconds.
+	KeyType        ContentKeyType // 24-27,The key type.
 	//Reserved       uint32 // Reserved; set to a fixed value of 0x86d34a3a.
 	//Padding        []byte // Random values to fill out the TLLV to a multiple of 16 bytes.
 
 }
 
+// ContentKeyType represents the key type of a content key duration block.
+type ContentKeyType uint32
+
+const (
+	KeyTypeLease              ContentKeyType = contentKeyValidForLease        // Streaming key valid for the lease duration.
+	KeyTypeRental             ContentKeyType = contentKeyValidForRental       // Streaming key valid for the rental duration.
+	KeyTypeLeaseAndRental     ContentKeyType = contentKeyValidForBoth         // Streaming key valid for both the lease and rental durations.
+	KeyTypePersisted          ContentKeyType = contentKeyPersisted            // Persistable key with unlimited validity.
+	KeyTypePersistedWithLimit ContentKeyType = contentKeyPersistedWithlimited // Persistable key valid for the rental duration.
+)
+
+// ParseContentKeyType parses a stored key type name
+// ("lease", "rental", "lease_and_rental", "persisted" or "persisted_limited").
+// An empty name returns 0, which means the key type is inferred from the durations.
+func ParseContentKeyType(name string) (ContentKeyType, error) {
+	switch strings.ToLower(name) {
+	case "":
+		return 0, nil
+	case "lease":
+		return KeyTypeLease, nil
+	case "rental":
+		return KeyTypeRental, nil
+	case "lease_and_rental":
+		return KeyTypeLeaseAndRental, nil
+	case "persisted":
+		return KeyTypePersisted, nil
+	case "persisted_limited":
+		return KeyTypePersistedWithLimit, nil
+	default:
+		return 0, fmt.Errorf("%w: unknown key type %q", ErrContentKeyType, name)
+	}
+}
+
+// InferContentKeyType returns the streaming key type matching the configured lease and rental durations.
+// Without any duration it returns 0: a persistable key type is never inferred, it must be set explicitly.
+func InferContentKeyType(LeaseDuration, RentalDuration uint32) ContentKeyType {
+	switch {
+	case LeaseDuration > 0 && RentalDuration > 0:
+		return KeyTypeLeaseAndRental
+	case LeaseDuration > 0:
+		return KeyTypeLease
+	case RentalDuration > 0:
+		return KeyTypeRental
+	default:
+		return 0
+	}
+}
+
+// Persistable reports whether the key type lets the client persist the key, which is only allowed
+// for assets whose policy allows offline playback.
+func (t ContentKeyType) Persistable() bool {
+	return t == KeyTypePersisted || t == KeyTypePersistedWithLimit
+}
+
+// validate checks the key type against the lease and rental durations.
+func (t ContentKeyType) validate(LeaseDuration, RentalDuration uint32) error {
+	var ok bool
+	switch t {
+	case KeyTypeLease:
+		ok = LeaseDuration > 0 && RentalDuration == 0
+	case KeyTypeRental:
+		ok = LeaseDuration == 0 && RentalDuration > 0
+	case KeyTypeLeaseAndRental:
+		ok = LeaseDuration > 0 && RentalDuration > 0
+	case KeyTypePersisted:
+		ok = LeaseDuration == 0 && RentalDuration == 0
+	case KeyTypePersistedWithLimit:
+		ok = LeaseDuration == 0 && RentalDuration > 0
+	default:
+		return fmt.Errorf("%w: unknown key type 0x%x", ErrContentKeyType, uint32(t))
+	}
+
+	if !ok {
+		return fmt.Errorf("%w: key type 0x%x with lease %ds and rental %ds", ErrContentKeyType, uint32(t), LeaseDuration, RentalDuration)
+	}
+	return nil
+}
+
 // NewCkcContentKeyDurationBlock creates a new a ckc content key duration block object using the specified lease duration and rental duration.
+// The key type is inferred from the durations, see InferContentKeyType.
+// NewCkcContentKeyDurationBlock returns nil without any duration, so no content key duration TLLV is sent.
 func NewCkcContentKeyDurationBlock(LeaseDuration, RentalDuration uint32) *CkcContentKeyDurationBlock {
+	keyType := InferContentKeyType(LeaseDuration, RentalDuration)
+	if keyType == 0 {
+		return nil
+	}
+	block, _ := NewCkcContentKeyDurationBlockWithKeyType(LeaseDuration, RentalDuration, keyType)
+	return block
+}
+
+// NewCkcContentKeyDurationBlockWithKeyType creates a new a ckc content key duration block object using the specified lease duration, rental duration and key type.
+// NewCkcContentKeyDurationBlockWithKeyType returns an error if the key type doesn't match the durations.
+func NewCkcContentKeyDurationBlockWithKeyType(LeaseDuration, RentalDuration uint32, KeyType ContentKeyType) (*CkcContentKeyDurationBlock, error) {
+	if err := KeyType.validate(LeaseDuration, RentalDuration); err != nil {
+		return nil, err
+	}
+
 	var value []byte
 
 	LeaseDurationOut := make([]byte, 4)
@@ -128,9 +225,7 @@ func NewCkcContentKeyDurationBlock(LeaseDuration, RentalDuration uint32) *CkcCon
 	binary.BigEndian.PutUint32(rentalDurationOut, RentalDuration)
 
 	keyTypeOut := make([]byte, 4)
-
-	//binary.BigEndian.PutUint32(keyTypeOut, contentKeyValidForLease)
-	binary.BigEndian.PutUint32(keyTypeOut, contentKeyPersisted)
+	binary.BigEndian.PutUint32(keyTypeOut, uint32(KeyType))
 
 	value = append(value, LeaseDurationOut...)
 	value = append(value, rentalDurationOut...)
@@ -143,8 +238,41 @@ func NewCkcContentKeyDurationBlock(LeaseDuration, RentalDuration uint32) *CkcCon
 		TLLVBlock:      tllv,
 		LeaseDuration:  LeaseDuration,
 		RentalDuration: RentalDuration,
-		KeyType:        contentKeyValidForLease, //TODO: KeyType does not use
+		KeyType:        KeyType,
+	}, nil
+}
+
+// NewHdcpEnforcementBlock creates a new HDCP enforcement TLLV block using the specified HDCP type.
+func NewHdcpEnforcementBlock(hdcpType HDCPType) *TLLVBlock {
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint64(value, uint64(hdcpType))
+
+	return NewTLLVBlock(tagHdcpEnforcement, value)
+}
+
+// NewOfflineKeyBlock creates a new offline key TLLV block using the specified 16-byte content ID, optional 16-byte title ID,
+// storage duration and playback duration. A title ID selects the version 2 layout.
+func NewOfflineKeyBlock(contentID, titleID []byte, storageDuration, playbackDuration uint32) (*TLLVBlock, error) {
+	if len(contentID) != 16 {
+		return nil, fmt.Errorf("offline key content ID must be 16 bytes, got %d", len(contentID))
+	}
+	if titleID != nil && len(titleID) != 16 {
+		return nil, fmt.Errorf("offline key title ID must be 16 bytes, got %d", len(titleID))
 	}
+
+	version := uint32(offlineKeyVersion1)
+	if titleID != nil {
+		version = offlineKeyVersion2
+	}
+
+	value := make([]byte, 32, 48)
+	binary.BigEndian.PutUint32(value[0:4], version) // 4-7 reserved
+	copy(value[8:24], contentID)
+	binary.BigEndian.PutUint32(value[24:28], storageDuration)
+	binary.BigEndian.PutUint32(value[28:32], playbackDuration)
+	value = append(value, titleID...)
+
+	return NewTLLVBlock(tagOfflineKey, value), nil
 }
 
 const (
@@ -159,6 +287,8 @@ const (
 	tagProtocolVersionUsed       = 0x5d81bcbcc7f61703
 	tagTreamingIndicator         = 0xabb0256a31843974
 	tagMediaPlaybackState        = 0xeb8efdf2b25ab3a0
+	tagCapabilities              = 0x9c02af3253c07fb2
+	tagSecurityLevelReport       = 0xb18ee16ea50f6c02
 
 	playbackStateReadyToStart    = 0xf4dee5a2
 	playbackStatePlayingOrPaused = 0xa5d6739e
@@ -166,6 +296,23 @@ const (
 	playbackStateHalted          = 0x5991bf20
 )
 
+// spcTagNames are the names of the SPC tags in the logs.
+var spcTagNames = map[uint64]string{
+	tagSessionKeyR1:              "tagSessionKeyR1",
+	tagSessionKeyR1Integrity:     "tagSessionKeyR1Integrity",
+	tagAntiReplaySeed:            "tagAntiReplaySeed",
+	tagR2:                        "tagR2",
+	tagReturnRequest:             "tagReturnRequest",
+	tagAssetID:                   "tagAssetID",
+	tagTransactionID:             "tagTransactionID",
+	tagProtocolVersionsSupported: "tagProtocolVersionsSupported",
+	tagProtocolVersionUsed:       "tagProtocolVersionUsed",
+	tagTreamingIndicator:         "tagTreamingIndicator",
+	tagMediaPlaybackState:        "tagMediaPlaybackState",
+	tagCapabilities:              "tagCapabilities",
+	tagSecurityLevelReport:       "tagSecurityLevelReport",
+}
+
 const (
 	fieldTagLength   = 8
 	fieldBlockLength = 4
@@ -177,6 +324,7 @@ const (
 	tagR1                 = 0xea74c4645d5efee9
 	tagContentKeyDuration = 0x47acf6a418cd091a
 	tagHdcpEnforcement    = 0x2e52f1530d8ddb4a
+	tagOfflineKey         = 0x6375d9727060218c
 
 	contentKeyValidForLease  = 0x1a4bde7e //Content key valid for lease only
 	contentKeyValidForRental = 0x3dfe45a0 //Content key valid for rental only
@@ -185,6 +333,9 @@ const (
 
 const (
 	//Offline
+	offlineKeyVersion1 = 1 // Offline key TLLV without title ID
+	offlineKeyVersion2 = 2 // Offline key TLLV with title ID
+
 	contentKeyPersisted            = 0x3df2d9fb //Content key can be persisted with unlimited validity duration
 	contentKeyPersistedWithlimited = 0x18f06048 //Content key can be persisted, and it’s validity duration is limited to the “Rental Duration” value
 )
@@ -1,6 +1,8 @@
 package ksm
 
 import (
+	"encoding/binary"
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -29,3 +31,81 @@ func TestTLLVBlock_Serialize_error(t *testing.T) {
 	_, err2 := b2.Serialize()
 	assert.Error(t, err2)
 }
+
+func TestNewCkcContentKeyDurationBlock_KeyType(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		lease, rental uint32
+		keyType       ContentKeyType
+	}{
+		{3600, 0, KeyTypeLease},
+		{0, 86400, KeyTypeRental},
+		{3600, 86400, KeyTypeLeaseAndRental},
+	}
+
+	for _, test := range tests {
+		block := NewCkcContentKeyDurationBlock(test.lease, test.rental)
+		assert.Equal(test.keyType, block.KeyType)
+		assert.False(block.KeyType.Persistable())
+		assert.Equal(uint32(test.keyType), binary.BigEndian.Uint32(block.Value[8:12]), "serialized key type must match KeyType")
+	}
+
+	// Without durations no key type is inferred, a persistable key type is never a default.
+	assert.Zero(InferContentKeyType(0, 0))
+	assert.Nil(NewCkcContentKeyDurationBlock(0, 0))
+}
+
+func TestNewCkcContentKeyDurationBlockWithKeyType(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		lease, rental uint32
+		keyType       ContentKeyType
+		valid         bool
+	}{
+		{3600, 0, KeyTypeLease, true},
+		{0, 0, KeyTypeLease, false},
+		{3600, 86400, KeyTypeLease, false},
+		{0, 86400, KeyTypeRental, true},
+		{3600, 0, KeyTypeRental, false},
+		{3600, 86400, KeyTypeLeaseAndRental, true},
+		{3600, 0, KeyTypeLeaseAndRental, false},
+		{0, 0, KeyTypePersisted, true},
+		{0, 86400, KeyTypePersisted, false},
+		{0, 86400, KeyTypePersistedWithLimit, true},
+		{0, 0, KeyTypePersistedWithLimit, false},
+		{0, 0, ContentKeyType(0x12345678), false},
+	}
+
+	for _, test := range tests {
+		block, err := NewCkcContentKeyDurationBlockWithKeyType(test.lease, test.rental, test.keyType)
+		if !test.valid {
+			assert.Truef(errors.Is(err, ErrContentKeyType), "key type 0x%x, lease %d, rental %d", uint32(test.keyType), test.lease, test.rental)
+			continue
+		}
+
+		assert.NoError(err)
+		assert.Equal(test.keyType, block.KeyType)
+		assert.Equal(test.lease, binary.BigEndian.Uint32(block.Value[0:4]))
+		assert.Equal(test.rental, binary.BigEndian.Uint32(block.Value[4:8]))
+		assert.Equal(uint32(test.keyType), binary.BigEndian.Uint32(block.Value[8:12]))
+	}
+}
+
+func TestParseContentKeyType(t *testing.T) {
+	keyType, err := ParseContentKeyType("persisted_limited")
+	assert.NoError(t, err)
+	assert.Equal(t, KeyTypePersistedWithLimit, keyType)
+
+	assert.True(t, keyType.Persistable())
+	assert.True(t, KeyTypePersisted.Persistable())
+	assert.False(t, KeyTypeRental.Persistable())
+
+	keyType, err = ParseContentKeyType("")
+	assert.NoError(t, err)
+	assert.Zero(t, keyType)
+
+	_, err = ParseContentKeyType("forever")
+	assert.True(t, errors.Is(err, ErrContentKeyType))
+}
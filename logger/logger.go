@@ -1,25 +1,195 @@
+// Package logger is the leveled, structured logger of the KSM, built on log/slog.
+//
+// Key material, such as session keys, DASk, ASk, content keys and decrypted payloads, must be logged
+// as a Secret. Secrets are written as [REDACTED] unless secret logging was unlocked with UnlockSecrets,
+// and even then only in debug records.
+//
+// Attributes attached to a context with With, such as the tenant or the asset ID of a request,
+// are added to every record logged with that context.
 package logger
 
 import (
+	"context"
+	"encoding/hex"
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
+	"strings"
+	"sync/atomic"
 )
 
-var logger *log.Logger
+// Redacted replaces the value of a Secret in the logs.
+const Redacted = "[REDACTED]"
+
+var (
+	level    = new(slog.LevelVar) // slog.LevelInfo unless SetLevel is called.
+	unlocked atomic.Bool
+	current  atomic.Pointer[slog.Logger]
+)
 
 func init() {
-	logger = log.New(os.Stdout, "", 0)
+	SetHandler(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: level}))
+}
+
+// SetHandler sends the logs to h, after redaction and with the context attributes.
+// h should use the package level, see Level.
+func SetHandler(h slog.Handler) {
+	current.Store(slog.New(&handler{next: h}))
+}
+
+// SetLogger sends the logs to the writer of l as text.
+func SetLogger(l *log.Logger) {
+	SetHandler(slog.NewTextHandler(l.Writer(), &slog.HandlerOptions{Level: level}))
+}
+
+// Logger returns the package logger.
+func Logger() *slog.Logger {
+	return current.Load()
+}
+
+// Level returns the level of the package, to use in the options of a handler given to SetHandler.
+func Level() slog.Leveler {
+	return level
+}
+
+// SetLevel sets the minimum level of the records written.
+func SetLevel(l slog.Level) {
+	level.Set(l)
+}
+
+// ParseLevel parses a level name ("debug", "info", "warn" or "error"). An empty name returns slog.LevelInfo.
+func ParseLevel(name string) (slog.Level, error) {
+	var l slog.Level
+	if name == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := l.UnmarshalText([]byte(name)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q, must be debug, info, warn or error", name)
+	}
+	return l, nil
+}
+
+// UnlockSecrets allows debug records to contain the values of secrets. It must only be used
+// to debug with test credentials: the logs then contain keys that decrypt content.
+func UnlockSecrets(unlock bool) {
+	unlocked.Store(unlock)
+}
+
+// Secret is key material. It is logged as [REDACTED] unless secrets are unlocked and the record is a debug record.
+type Secret []byte
+
+// LogValue implements slog.LogValuer. It always redacts, the package handler reveals unlocked secrets.
+func (s Secret) LogValue() slog.Value {
+	return slog.StringValue(Redacted)
+}
+
+type contextKey struct{}
+
+// With returns a copy of ctx carrying the attributes of args, given as to slog.Logger.With.
+func With(ctx context.Context, args ...any) context.Context {
+	parent, _ := ctx.Value(contextKey{}).([]slog.Attr)
+
+	var r slog.Record
+	r.Add(args...)
+	attrs := make([]slog.Attr, len(parent), len(parent)+r.NumAttrs())
+	copy(attrs, parent)
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	return context.WithValue(ctx, contextKey{}, attrs)
+}
+
+// Debug logs a debug record with the attributes of ctx.
+func Debug(ctx context.Context, msg string, args ...any) {
+	Logger().DebugContext(ctx, msg, args...)
+}
+
+// Info logs an info record with the attributes of ctx.
+func Info(ctx context.Context, msg string, args ...any) {
+	Logger().InfoContext(ctx, msg, args...)
 }
 
+// Warn logs a warning record with the attributes of ctx.
+func Warn(ctx context.Context, msg string, args ...any) {
+	Logger().WarnContext(ctx, msg, args...)
+}
+
+// Error logs an error record with the attributes of ctx.
+func Error(ctx context.Context, msg string, args ...any) {
+	Logger().ErrorContext(ctx, msg, args...)
+}
+
+// Println logs a debug record of the arguments.
+//
+// Deprecated: use Debug with attributes, and Secret for key material.
 func Println(args ...interface{}) {
-	logger.Println(args...)
+	Logger().Debug(strings.TrimSuffix(fmt.Sprintln(args...), "\n"))
 }
 
+// Printf logs a debug record of the formatted arguments.
+//
+// Deprecated: use Debug with attributes, and Secret for key material.
 func Printf(format string, args ...interface{}) {
-	logger.Println(fmt.Sprintf(format, args...))
+	Logger().Debug(strings.TrimSpace(fmt.Sprintf(format, args...)))
 }
 
-func SetLogger(l *log.Logger) {
-	logger = l
+// handler adds the context attributes to the records and redacts their secrets.
+type handler struct {
+	next slog.Handler
+}
+
+func (h *handler) Enabled(ctx context.Context, l slog.Level) bool {
+	return h.next.Enabled(ctx, l)
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	reveal := r.Level <= slog.LevelDebug && unlocked.Load()
+
+	out := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	if attrs, ok := ctx.Value(contextKey{}).([]slog.Attr); ok {
+		for _, a := range attrs {
+			out.AddAttrs(redact(a, reveal))
+		}
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		out.AddAttrs(redact(a, reveal))
+		return true
+	})
+	return h.next.Handle(ctx, out)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		// The level of the records isn't known yet, so secrets are always redacted.
+		redacted[i] = redact(a, false)
+	}
+	return &handler{next: h.next.WithAttrs(redacted)}
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return &handler{next: h.next.WithGroup(name)}
+}
+
+// redact replaces the secrets of a, including in groups, with their hex value if reveal is set.
+func redact(a slog.Attr, reveal bool) slog.Attr {
+	switch a.Value.Kind() {
+	case slog.KindLogValuer:
+		if secret, ok := a.Value.Any().(Secret); ok {
+			if reveal {
+				return slog.String(a.Key, hex.EncodeToString(secret))
+			}
+			return slog.String(a.Key, Redacted)
+		}
+	case slog.KindGroup:
+		group := a.Value.Group()
+		attrs := make([]any, len(group))
+		for i, g := range group {
+			attrs[i] = redact(g, reveal)
+		}
+		return slog.Group(a.Key, attrs...)
+	}
+	return a
 }
@@ -0,0 +1,86 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// captureLogs sends the logs to a buffer at level l until the end of the test.
+func captureLogs(t *testing.T, l slog.Level) *bytes.Buffer {
+	var buf bytes.Buffer
+	previous, previousLevel := Logger(), level.Level()
+	SetLevel(l)
+	SetHandler(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: level}))
+	t.Cleanup(func() {
+		current.Store(previous)
+		SetLevel(previousLevel)
+		UnlockSecrets(false)
+	})
+	return &buf
+}
+
+func TestSecretRedacted(t *testing.T) {
+	assert := assert.New(t)
+	key := Secret{0xde, 0xad, 0xbe, 0xef}
+
+	buf := captureLogs(t, slog.LevelDebug)
+	Debug(context.Background(), "keys", "sk", key, slog.Group("r1", "value", key))
+	assert.Contains(buf.String(), "sk="+Redacted)
+	assert.Contains(buf.String(), "r1.value="+Redacted)
+	assert.NotContains(buf.String(), "deadbeef")
+
+	// Unlocked secrets are only revealed in debug records.
+	UnlockSecrets(true)
+	buf.Reset()
+	Info(context.Background(), "keys", "sk", key)
+	assert.Contains(buf.String(), "sk="+Redacted)
+
+	buf.Reset()
+	Debug(context.Background(), "keys", "sk", key, slog.Group("r1", "value", key))
+	assert.Contains(buf.String(), "sk=deadbeef")
+	assert.Contains(buf.String(), "r1.value=deadbeef")
+
+	// Attributes bound to the logger don't know the record level.
+	buf.Reset()
+	Logger().With("sk", key).Debug("keys")
+	assert.Contains(buf.String(), "sk="+Redacted)
+}
+
+func TestSecretUnlockedAboveDebug(t *testing.T) {
+	buf := captureLogs(t, slog.LevelInfo)
+	UnlockSecrets(true)
+
+	Debug(context.Background(), "keys", "sk", Secret{0xde, 0xad})
+	Info(context.Background(), "keys", "sk", Secret{0xde, 0xad})
+	assert.NotContains(t, buf.String(), "dead")
+}
+
+func TestWith(t *testing.T) {
+	assert := assert.New(t)
+	buf := captureLogs(t, slog.LevelInfo)
+
+	ctx := With(context.Background(), "tenant", "customer-1")
+	child := With(ctx, "asset_id", "asset-1", "ask", Secret{1})
+	Info(child, "ckc generated", "output", "hdcp")
+	assert.Contains(buf.String(), "tenant=customer-1 asset_id=asset-1 ask="+Redacted+" output=hdcp")
+
+	// The parent context is unchanged.
+	buf.Reset()
+	Warn(ctx, "failed")
+	assert.Contains(buf.String(), "tenant=customer-1")
+	assert.NotContains(buf.String(), "asset_id")
+}
+
+func TestParseLevel(t *testing.T) {
+	for name, want := range map[string]slog.Level{"": slog.LevelInfo, "debug": slog.LevelDebug, "WARN": slog.LevelWarn, "error": slog.LevelError} {
+		l, err := ParseLevel(name)
+		assert.NoError(t, err, name)
+		assert.Equal(t, want, l, name)
+	}
+	_, err := ParseLevel("verbose")
+	assert.Error(t, err)
+}